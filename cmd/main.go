@@ -3,9 +3,10 @@ package main
 import (
 	"github.com/andreposman/capital-gains/internal/infra/cli"
 	"github.com/andreposman/capital-gains/pkg/helpers"
+	"os"
 )
 
 func main() {
 	helpers.Greeting()
-	cli.Handle()
+	os.Exit(cli.Handle(os.Args[1:]))
 }
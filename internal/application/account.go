@@ -0,0 +1,16 @@
+package application
+
+import "github.com/andreposman/capital-gains/internal/domain"
+
+// Account is the state of the portfolios of one account after its last operation: a portfolio per
+// ticker and how many operations it has processed. It is a projection of the operation log
+type Account struct {
+	ID         string                           `json:"id"`
+	Operations int                              `json:"operations"`
+	Portfolios map[string]domain.PortfolioState `json:"portfolios"`
+}
+
+// NewAccount returns an account with no operations
+func NewAccount(id string) Account {
+	return Account{ID: id, Portfolios: make(map[string]domain.PortfolioState)}
+}
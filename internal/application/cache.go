@@ -0,0 +1,73 @@
+package application
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultSessionCacheSize is the number of accounts whose session is cached when NewSessionCache gets 0
+const DefaultSessionCacheSize = 1000
+
+// SessionCache keeps the session of the accounts recently updated by AppendTo, with its checkpoints,
+// so the operation log of an account is only replayed when its session is not cached or is behind
+// the log, e.g. after a restart. The least recently used session is dropped when it is full.
+// It is safe for concurrent use
+type SessionCache struct {
+	mu       sync.Mutex
+	size     int
+	sessions map[string]*list.Element
+	order    *list.List // of *cachedSession, most recently used first
+}
+
+type cachedSession struct {
+	id      string
+	session *Session
+}
+
+// NewSessionCache returns a cache of up to size sessions, DefaultSessionCacheSize when size is 0
+func NewSessionCache(size int) *SessionCache {
+	if size <= 0 {
+		size = DefaultSessionCacheSize
+	}
+	return &SessionCache{size: size, sessions: make(map[string]*list.Element), order: list.New()}
+}
+
+// take removes the session of account id from the cache and returns it when it has processed the
+// operations up to sequence, the last one of the log, and nil otherwise
+func (c *SessionCache) take(id string, sequence int) *Session {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.sessions[id]
+	if !ok {
+		return nil
+	}
+	c.order.Remove(element)
+	delete(c.sessions, id)
+	if session := element.Value.(*cachedSession).session; session.count == sequence {
+		return session
+	}
+	return nil
+}
+
+// put caches session as the session of account id
+func (c *SessionCache) put(id string, session *Session) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.sessions[id]; ok {
+		c.order.Remove(element)
+	}
+	c.sessions[id] = c.order.PushFront(&cachedSession{id: id, session: session})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.sessions, oldest.Value.(*cachedSession).id)
+	}
+}
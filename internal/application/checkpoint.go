@@ -0,0 +1,83 @@
+package application
+
+import (
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"sort"
+)
+
+// DefaultCheckpointEvery is the number of trades between checkpoints when CheckpointEvery is not set
+const DefaultCheckpointEvery = 1000
+
+// checkpoint is the state of every portfolio of a session before the trade at position
+type checkpoint struct {
+	position   int // index in Session.trades
+	portfolios map[string]domain.PortfolioState
+}
+
+// checkpointDue reports whether a checkpoint is taken before next, the trade that goes at position
+// after trades[:position]
+func (op *OperationProcessor) checkpointDue(trades []trade, position int, next Operation) bool {
+	if position == 0 {
+		return false
+	}
+	every := op.CheckpointEvery
+	if every <= 0 {
+		every = DefaultCheckpointEvery
+	}
+	if position%every == 0 {
+		return true
+	}
+	return op.CheckpointMonthEnd && monthChanged(trades[position-1].operation.Date, next.Date)
+}
+
+// monthChanged reports whether two YYYY-MM-DD dates are in different months, false when either is missing
+func monthChanged(previous, next string) bool {
+	if len(previous) < len("2006-01") || len(next) < len("2006-01") {
+		return false
+	}
+	return previous[:len("2006-01")] != next[:len("2006-01")]
+}
+
+func snapshot(portfolios map[string]*domain.Portfolio, position int) checkpoint {
+	states := make(map[string]domain.PortfolioState, len(portfolios))
+	for ticker, portfolio := range portfolios {
+		states[ticker] = portfolio.Snapshot()
+	}
+	return checkpoint{position: position, portfolios: states}
+}
+
+// restore returns the portfolios of the checkpoint. tickers that had no portfolio yet at the checkpoint
+// start empty, so every ticker of the session keeps its portfolio. Every portfolio is set up by configure,
+// the restored ones first so the empty ones share the accumulated loss of their loss group
+func (c checkpoint) restore(tickers map[string]*domain.Portfolio, configure func(portfolios map[string]*domain.Portfolio, ticker string, portfolio *domain.Portfolio)) (map[string]*domain.Portfolio, error) {
+	portfolios := make(map[string]*domain.Portfolio, len(tickers))
+	restored := make([]string, 0, len(c.portfolios))
+	for ticker := range c.portfolios {
+		restored = append(restored, ticker)
+	}
+	sort.Strings(restored)
+	for _, ticker := range restored {
+		portfolio, err := domain.RestorePortfolio(c.portfolios[ticker])
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint before trade %d: %s: %w", c.position+1, ticker, err)
+		}
+		configure(portfolios, ticker, portfolio)
+		portfolios[ticker] = portfolio
+	}
+
+	for ticker := range tickers {
+		if _, ok := portfolios[ticker]; !ok {
+			portfolio := &domain.Portfolio{}
+			configure(portfolios, ticker, portfolio)
+			portfolios[ticker] = portfolio
+		}
+	}
+	return portfolios, nil
+}
+
+// checkpointBefore returns how many checkpoints are at or before position, the last of them being the
+// nearest one to replay from
+func (s *Session) checkpointBefore(position int) int {
+	return sort.Search(len(s.checkpoints), func(i int) bool { return s.checkpoints[i].position > position })
+}
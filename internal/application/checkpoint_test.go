@@ -0,0 +1,293 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// history generates n trades over three tickers, one per day, that never sell more shares than held
+func history(n int) []Operation {
+	random := rand.New(rand.NewSource(42))
+	tickers := []string{"PETR4", "VALE3", "ITSA4"}
+	shares := make(map[string]int)
+	date := time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	operations := make([]Operation, n)
+	for i := range operations {
+		ticker := tickers[random.Intn(len(tickers))]
+		operation := Operation{
+			ID:       fmt.Sprintf("t-%d", i+1),
+			Type:     "buy",
+			UnitCost: float64(500+random.Intn(3500)) / 100,
+			Quantity: 100 * (1 + random.Intn(20)),
+			Ticker:   ticker,
+			Date:     date.AddDate(0, 0, i).Format("2006-01-02"),
+		}
+		if shares[ticker] > 0 && random.Intn(2) == 0 {
+			operation.Type = "sell"
+			operation.Quantity = 1 + random.Intn(shares[ticker])
+			shares[ticker] -= operation.Quantity
+		} else {
+			shares[ticker] += operation.Quantity
+		}
+		operations[i] = operation
+	}
+	return operations
+}
+
+// corrections only cancel sells and raise the quantity of buys, so no sale is left without shares
+func corrections(operations []Operation) []Operation {
+	var sells, buys []Operation
+	for _, operation := range operations {
+		if operation.Type == "sell" {
+			sells = append(sells, operation)
+		} else {
+			buys = append(buys, operation)
+		}
+	}
+	amended := buys[len(buys)/3]
+	return []Operation{
+		{Type: "amend", Ref: amended.ID, UnitCost: amended.UnitCost + 1, Quantity: amended.Quantity + 100},
+		{Type: "cancel", Ref: sells[len(sells)*3/4].ID},
+		{Type: "cancel", Ref: sells[10].ID},
+		{Type: "amend", Ref: sells[len(sells)/2].ID, UnitCost: 50.00, Quantity: 1},
+	}
+}
+
+func TestSession_CheckpointReplayMatchesFullReplay(t *testing.T) {
+	operations := append(history(2000), corrections(history(2000))...)
+	lossGroups := map[string]func(ticker string) string{
+		"one loss group":        nil,
+		"loss group per ticker": func(ticker string) string { return ticker },
+	}
+
+	for name, lossGroup := range lossGroups {
+		t.Run(name, func(t *testing.T) {
+			checkpointed := &OperationProcessor{Explain: true, CheckpointEvery: 64, CheckpointMonthEnd: true, LossGroup: lossGroup}
+			full := &OperationProcessor{Explain: true, CheckpointEvery: math.MaxInt, LossGroup: lossGroup}
+			session, reference := checkpointed.NewSession(), full.NewSession()
+
+			for i, operation := range operations {
+				result, err := session.Process(context.Background(), operation)
+				expected, expectedErr := reference.Process(context.Background(), operation)
+				if err != nil || expectedErr != nil {
+					t.Fatalf("Checkpoint failed: operation %d returned %v, full replay %v", i+1, err, expectedErr)
+				}
+				if !reflect.DeepEqual(result, expected) {
+					t.Fatalf("Checkpoint failed: operation %d Expected %+v, got %+v", i+1, expected, result)
+				}
+			}
+
+			if len(session.checkpoints) < 2000/64 || len(reference.checkpoints) != 0 {
+				t.Fatalf("Checkpoint failed: Expected checkpoints only with CheckpointEvery, got %d and %d", len(session.checkpoints), len(reference.checkpoints))
+			}
+			if !reflect.DeepEqual(session.trades, reference.trades) {
+				t.Errorf("Checkpoint failed: Expected the recomputed trades to match the full replay")
+			}
+			if !reflect.DeepEqual(session.Account("alice"), reference.Account("alice")) {
+				t.Errorf("Checkpoint failed: Expected %+v, got %+v", reference.Account("alice"), session.Account("alice"))
+			}
+			if !reflect.DeepEqual(session.Ledgers(), reference.Ledgers()) {
+				t.Errorf("Checkpoint failed: Expected the loss ledgers to match the full replay")
+			}
+		})
+	}
+}
+
+func TestSession_CheckpointsMatchStateOfFullReplay(t *testing.T) {
+	operations := history(500)
+	processor := &OperationProcessor{CheckpointEvery: 50, CheckpointMonthEnd: true}
+	session := processor.NewSession()
+	for _, operation := range append(operations, corrections(operations)...) {
+		if _, err := session.Process(context.Background(), operation); err != nil {
+			t.Fatalf("Checkpoint failed: %v", err)
+		}
+	}
+
+	for _, checkpoint := range session.checkpoints {
+		// the trades before the checkpoint, replayed from the start with their sequence
+		reference := processor.NewSession()
+		for _, trade := range session.trades[:checkpoint.position] {
+			if _, _, err := processor.execute(reference.portfolios, trade.sequence, trade.operation); err != nil {
+				t.Fatalf("Checkpoint failed: %v", err)
+			}
+		}
+		expected := snapshot(reference.portfolios, checkpoint.position)
+		if !reflect.DeepEqual(checkpoint.portfolios, expected.portfolios) {
+			t.Errorf("Checkpoint failed: checkpoint at %d Expected %+v, got %+v", checkpoint.position, expected.portfolios, checkpoint.portfolios)
+		}
+	}
+}
+
+func TestSession_CheckpointAtMonthEnd(t *testing.T) {
+	processor := &OperationProcessor{CheckpointMonthEnd: true}
+	session := processor.NewSession()
+
+	for _, date := range []string{"2024-01-30", "2024-01-31", "2024-02-01", "", "2024-03-01"} {
+		session.Process(context.Background(), Operation{Type: "buy", UnitCost: 10.00, Quantity: 100, Date: date})
+	}
+
+	// before the first trade of February; undated trades are not compared
+	var positions []int
+	for _, checkpoint := range session.checkpoints {
+		positions = append(positions, checkpoint.position)
+	}
+	if !reflect.DeepEqual(positions, []int{2}) {
+		t.Errorf("Checkpoint failed: Expected a checkpoint before trade 2, got %v", positions)
+	}
+}
+
+func TestSession_CorrectionReplaysFromNearestCheckpoint(t *testing.T) {
+	processor := &OperationProcessor{CheckpointEvery: 10}
+	session := processor.NewSession()
+	operations := history(100)
+	for _, operation := range operations {
+		session.Process(context.Background(), operation)
+	}
+	checkpoints := append([]checkpoint(nil), session.checkpoints...)
+
+	// t-95 is after the checkpoint at 90, every checkpoint up to it is kept as it was
+	if _, err := session.Process(context.Background(), Operation{Type: "cancel", Ref: "t-95"}); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(session.checkpoints, checkpoints) {
+		t.Errorf("Checkpoint failed: Expected the checkpoints before the cancelled trade to be kept")
+	}
+}
+
+// backdated moves every 7th sell of operations to the end, so it arrives after later trades. Only sells
+// are moved, so the trades processed without them never run out of shares
+func backdated(operations []Operation) []Operation {
+	var inOrder, late []Operation
+	sells := 0
+	for _, operation := range operations {
+		if operation.Type == "sell" {
+			sells++
+			if sells%7 == 0 {
+				late = append(late, operation)
+				continue
+			}
+		}
+		inOrder = append(inOrder, operation)
+	}
+	return append(inOrder, late...)
+}
+
+func TestSession_BackdatedTradesMatchFullReplay(t *testing.T) {
+	operations := history(2000)
+	buy := operations[1500]
+	for i := 1501; buy.Type != "buy"; i++ {
+		buy = operations[i]
+	}
+	operations = append(backdated(operations), corrections(operations)...)
+	// a buy amended to an earlier date only adds shares to the sales in between
+	operations = append(operations, Operation{Type: "amend", Ref: buy.ID, UnitCost: buy.UnitCost, Quantity: buy.Quantity, Date: "2022-06-01"})
+
+	checkpointed := &OperationProcessor{Explain: true, CheckpointEvery: 64, CheckpointMonthEnd: true}
+	full := &OperationProcessor{Explain: true, CheckpointEvery: math.MaxInt}
+	session, reference := checkpointed.NewSession(), full.NewSession()
+
+	for i, operation := range operations {
+		result, err := session.Process(context.Background(), operation)
+		expected, expectedErr := reference.Process(context.Background(), operation)
+		if err != nil || expectedErr != nil {
+			t.Fatalf("Backdated failed: operation %d returned %v, full replay %v", i+1, err, expectedErr)
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Backdated failed: operation %d Expected %+v, got %+v", i+1, expected, result)
+		}
+	}
+
+	if !reflect.DeepEqual(session.trades, reference.trades) {
+		t.Errorf("Backdated failed: Expected the recomputed trades to match the full replay")
+	}
+	if !reflect.DeepEqual(session.Account("alice"), reference.Account("alice")) {
+		t.Errorf("Backdated failed: Expected %+v, got %+v", reference.Account("alice"), session.Account("alice"))
+	}
+	for i := 1; i < len(session.trades); i++ {
+		if session.trades[i-1].operation.Date > session.trades[i].operation.Date {
+			t.Fatalf("Backdated failed: trade %d is dated before trade %d", i+1, i)
+		}
+	}
+}
+
+func TestSession_BackdatedTradesMatchDateOrder(t *testing.T) {
+	operations := history(1000)
+	processor := &OperationProcessor{CheckpointEvery: 32}
+	session, inOrder := processor.NewSession(), processor.NewSession()
+
+	for _, operation := range backdated(operations) {
+		if _, err := session.Process(context.Background(), operation); err != nil {
+			t.Fatalf("Backdated failed: %v", err)
+		}
+	}
+	for _, operation := range operations {
+		inOrder.Process(context.Background(), operation)
+	}
+
+	// the trades are numbered in the order they arrived, so only their taxes and the positions are compared
+	for i, trade := range session.trades {
+		expected := inOrder.trades[i]
+		if trade.operation != expected.operation || trade.tax.Tax != expected.tax.Tax {
+			t.Fatalf("Backdated failed: trade %d Expected %s with tax %.2f, got %s with %.2f",
+				i+1, expected.operation.ID, expected.tax.Tax, trade.operation.ID, trade.tax.Tax)
+		}
+	}
+	for ticker, expected := range inOrder.Account("alice").Portfolios {
+		state := session.Account("alice").Portfolios[ticker]
+		if state.TotalShares != expected.TotalShares || state.AverageCost != expected.AverageCost || state.AccumulatedLoss != expected.AccumulatedLoss {
+			t.Errorf("Backdated failed: %s Expected %+v, got %+v", ticker, expected, state)
+		}
+	}
+}
+
+func TestSession_BackdatedTradeAdjustsLaterSales(t *testing.T) {
+	processor := &OperationProcessor{}
+	session := processor.NewSession()
+	ctx := context.Background()
+	session.Process(ctx, Operation{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 10000, Date: "2024-01-10"})
+	session.Process(ctx, Operation{ID: "s1", Type: "sell", UnitCost: 20.00, Quantity: 5000, Date: "2024-02-01"}) // Tax 10k
+
+	result, err := session.Process(ctx, Operation{ID: "b2", Type: "buy", UnitCost: 20.00, Quantity: 10000, Date: "2024-01-15"}) // WAC 15 -> Tax 5k
+
+	expected := []domain.Adjustment{{Operation: 2, ID: "s1", Before: 10000, After: 5000, Difference: -5000}}
+	if err != nil || !reflect.DeepEqual(result.Adjustments, expected) {
+		t.Fatalf("Backdated failed: Expected %+v, got %+v (%v)", expected, result.Adjustments, err)
+	}
+	if ids := tradeIDs(session); !reflect.DeepEqual(ids, []string{"b1", "b2", "s1"}) {
+		t.Errorf("Backdated failed: Expected the trades in date order, got %v", ids)
+	}
+}
+
+func TestSession_AmendMovesTradeToItsDate(t *testing.T) {
+	processor := &OperationProcessor{}
+	session := processor.NewSession()
+	ctx := context.Background()
+	session.Process(ctx, Operation{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 10000, Date: "2024-01-10"})
+	session.Process(ctx, Operation{ID: "s1", Type: "sell", UnitCost: 20.00, Quantity: 5000, Date: "2024-02-01"}) // Tax 10k
+	session.Process(ctx, Operation{ID: "b2", Type: "buy", UnitCost: 20.00, Quantity: 10000, Date: "2024-02-15"})
+
+	result, err := session.Process(ctx, Operation{Type: "amend", Ref: "b2", UnitCost: 20.00, Quantity: 10000, Date: "2024-01-15"}) // WAC 15 -> Tax 5k
+
+	if err != nil || len(result.Adjustments) != 1 || result.Adjustments[0].After != 5000 {
+		t.Fatalf("Amend failed: Expected the sale recomputed with the moved buy, got %+v (%v)", result, err)
+	}
+	if ids := tradeIDs(session); !reflect.DeepEqual(ids, []string{"b1", "b2", "s1"}) {
+		t.Errorf("Amend failed: Expected the trades in date order, got %v", ids)
+	}
+}
+
+func tradeIDs(session *Session) []string {
+	ids := make([]string, len(session.trades))
+	for i, trade := range session.trades {
+		ids[i] = trade.operation.ID
+	}
+	return ids
+}
@@ -0,0 +1,43 @@
+package application
+
+import (
+	"github.com/andreposman/capital-gains/internal/domain"
+)
+
+// Event is a domain event with the operation that raised it
+type Event struct {
+	Operation int    // 1-based position of the operation in the session
+	ID        string // id of the operation, when it has one
+	Ticker    string
+	Payload   domain.Event
+}
+
+// Subscriber is notified of the events of every operation processed, in the order they happened.
+// Events are not sent again when a log is replayed or a cancel, amend or back-dated trade recomputes
+// later trades; the correction sends a domain.TradeCorrected with the changes in their taxes instead
+type Subscriber interface {
+	Notify(event Event)
+}
+
+// SubscriberFunc adapts a function to a Subscriber
+type SubscriberFunc func(event Event)
+
+func (f SubscriberFunc) Notify(event Event) {
+	f(event)
+}
+
+// Subscribe registers subscriber for the events of the operations processed from now on
+func (op *OperationProcessor) Subscribe(subscriber Subscriber) {
+	op.subscribers = append(op.subscribers, subscriber)
+}
+
+// dispatch notifies every subscriber of the events of operation, each subscriber in turn. ticker is
+// the ticker of the portfolio the events happened to
+func (op *OperationProcessor) dispatch(index int, operation Operation, ticker string, events []domain.Event) {
+	for _, payload := range events {
+		event := Event{Operation: index, ID: operation.ID, Ticker: ticker, Payload: payload}
+		for _, subscriber := range op.subscribers {
+			subscriber.Notify(event)
+		}
+	}
+}
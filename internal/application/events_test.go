@@ -0,0 +1,108 @@
+package application
+
+import (
+	"context"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"reflect"
+	"testing"
+)
+
+// recorder keeps the type, operation and ticker of every event
+type recorder []string
+
+func (r *recorder) Notify(event Event) {
+	*r = append(*r, event.Payload.EventType()+" "+event.ID+" "+event.Ticker)
+}
+
+func TestOperationProcessor_DispatchesEventsInOrder(t *testing.T) {
+	processor := OperationProcessor{}
+	var first, second recorder
+	processor.Subscribe(&first)
+	processor.Subscribe(&second)
+
+	processor.ProcessOperations(context.Background(), []Operation{
+		{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{ID: "s1", Type: "sell", UnitCost: 5.00, Quantity: 5000, Ticker: "PETR4"},  // Loss 25k
+		{ID: "s2", Type: "sell", UnitCost: 20.00, Quantity: 3000, Ticker: "PETR4"}, // Profit 30k - 25k -> Tax 1k
+	})
+
+	expected := recorder{
+		"SharesBought b1 PETR4",
+		"SharesSold s1 PETR4",
+		"LossAccumulated s1 PETR4",
+		"TaxAssessed s1 PETR4",
+		"SharesSold s2 PETR4",
+		"LossConsumed s2 PETR4",
+		"TaxAssessed s2 PETR4",
+	}
+	if !reflect.DeepEqual(first, expected) || !reflect.DeepEqual(second, expected) {
+		t.Errorf("Events failed: Expected %v, got %v and %v", expected, first, second)
+	}
+}
+
+func TestOperationProcessor_EventPayload(t *testing.T) {
+	processor := OperationProcessor{}
+	var events []Event
+	processor.Subscribe(SubscriberFunc(func(event Event) { events = append(events, event) }))
+
+	processor.ProcessOperations(context.Background(), []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 100, Date: "2024-02-01"},
+		{Type: "sell", UnitCost: 15.00, Quantity: 100, Date: "2024-03-01"},
+	})
+
+	expected := Event{
+		Operation: 2,
+		Payload:   domain.ExemptionApplied{Origin: domain.Origin{Operation: 2, Date: "2024-03-01"}, SaleValue: 1500, Threshold: domain.MAX_SALE_VALUE, GrossProfit: 500},
+	}
+	if len(events) != 4 || !reflect.DeepEqual(events[2], expected) {
+		t.Errorf("Events failed: Expected %+v as the third event, got %+v", expected, events)
+	}
+	if bought, ok := events[0].Payload.(domain.SharesBought); !ok || bought.Origin != (domain.Origin{Operation: 1, Date: "2024-02-01"}) {
+		t.Errorf("Events failed: Expected the buy with its origin as the first event, got %+v", events[0])
+	}
+}
+
+func TestOperationProcessor_ReplayDoesNotDispatchAgain(t *testing.T) {
+	processor := OperationProcessor{}
+	session := processor.NewSession()
+	record, _, _ := session.apply(context.Background(), Operation{Type: "buy", UnitCost: 10.00, Quantity: 100})
+	var events recorder
+	processor.Subscribe(&events)
+
+	replayed, _ := processor.Replay(context.Background(), []OperationRecord{record})
+	replayed.Process(context.Background(), Operation{ID: "s1", Type: "sell", UnitCost: 10.00, Quantity: 10})
+	replayed.Process(context.Background(), Operation{Type: "cancel", Ref: "s1"})
+
+	// the correction recomputes no trade after s1, and s1 is gone
+	expected := recorder{"SharesSold s1 ", "ExemptionApplied s1 ", "TaxAssessed s1 ", "TradeCorrected  "}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Events failed: Expected %v, got %v", expected, events)
+	}
+}
+
+func TestOperationProcessor_CorrectionDispatchesAdjustments(t *testing.T) {
+	processor := OperationProcessor{}
+	var events []Event
+	processor.Subscribe(SubscriberFunc(func(event Event) { events = append(events, event) }))
+
+	processor.ProcessOperations(context.Background(), []Operation{
+		{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{ID: "s1", Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"}, // Tax 10k
+		{ID: "a1", Type: "amend", Ref: "b1", UnitCost: 15.00, Quantity: 10000},     // Tax 5k
+	})
+
+	// the recomputed sale sends no events of its own
+	expected := Event{
+		Operation: 3,
+		ID:        "a1",
+		Ticker:    "PETR4",
+		Payload: domain.TradeCorrected{
+			Correction:  "amend",
+			Ref:         "b1",
+			Adjustments: []domain.Adjustment{{Operation: 2, ID: "s1", Before: 10000, After: 5000, Difference: -5000}},
+		},
+	}
+	if len(events) != 4 || !reflect.DeepEqual(events[3], expected) {
+		t.Errorf("Events failed: Expected %+v as the last event, got %+v", expected, events)
+	}
+}
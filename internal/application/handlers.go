@@ -0,0 +1,131 @@
+package application
+
+import (
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"strings"
+	"sync"
+)
+
+// OperationHandler processes one type of operation against the portfolio of its ticker
+type OperationHandler interface {
+	// Name is the operation type the handler processes, e.g. "buy"
+	Name() string
+	// Validate rejects an operation the handler cannot process with a *PayloadError,
+	// before the portfolio is touched
+	Validate(operation Operation) error
+	// Handle processes a valid operation, origin being its position in the session and its date
+	Handle(portfolio *domain.Portfolio, origin domain.Origin, operation Operation) (domain.Tax, error)
+}
+
+// correctionTypes are handled by the session itself, since they change earlier operations
+var correctionTypes = []string{"cancel", "amend"}
+
+var (
+	// mu guards handlers and order, which the servers read while a handler may be registered
+	mu       sync.RWMutex
+	handlers = make(map[string]OperationHandler)
+	// order is the registration order, used in error messages
+	order []string
+)
+
+// RegisterHandler makes a handler available by its name. Registering a name twice replaces the handler.
+// It panics for cancel and amend, which the session handles itself
+func RegisterHandler(handler OperationHandler) {
+	if isCorrection(handler.Name()) {
+		panic(fmt.Sprintf("application: %q operations are handled by the session and cannot be registered", handler.Name()))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := handlers[handler.Name()]; !ok {
+		order = append(order, handler.Name())
+	}
+	handlers[handler.Name()] = handler
+}
+
+// LookupHandler returns the handler registered with name
+func LookupHandler(name string) (OperationHandler, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	handler, ok := handlers[name]
+	return handler, ok
+}
+
+// OperationTypes returns the registered operation types in registration order, then cancel and amend
+func OperationTypes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append(append([]string(nil), order...), correctionTypes...)
+}
+
+func isCorrection(operationType string) bool {
+	for _, correction := range correctionTypes {
+		if operationType == correction {
+			return true
+		}
+	}
+	return false
+}
+
+// UnknownOperationError is an operation whose type has no registered handler
+type UnknownOperationError struct {
+	Type string
+}
+
+func (e *UnknownOperationError) Error() string {
+	types := OperationTypes()
+	quoted := make([]string, len(types))
+	for i, name := range types {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return fmt.Sprintf("unknown operation type %q, want one of %s", e.Type, strings.Join(quoted, ", "))
+}
+
+// PayloadError is an operation whose Field a handler cannot process
+type PayloadError struct {
+	Type    string
+	Field   string // json name of the field, e.g. "unit-cost"
+	Message string
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("%s: %s %s", e.Type, e.Field, e.Message)
+}
+
+func init() {
+	RegisterHandler(buyHandler{})
+	RegisterHandler(sellHandler{})
+}
+
+// validateTrade checks the fields every buy and sell needs, with the rules of strict validation
+func validateTrade(operation Operation) error {
+	switch {
+	case operation.Quantity <= 0:
+		return &PayloadError{Type: operation.Type, Field: "quantity", Message: "must be > 0"}
+	case operation.UnitCost <= 0:
+		return &PayloadError{Type: operation.Type, Field: "unit-cost", Message: "must be > 0"}
+	case operation.Fees < 0:
+		return &PayloadError{Type: operation.Type, Field: "fees", Message: "must be >= 0"}
+	}
+	return nil
+}
+
+type buyHandler struct{}
+
+func (buyHandler) Name() string { return "buy" }
+
+func (buyHandler) Validate(operation Operation) error { return validateTrade(operation) }
+
+func (buyHandler) Handle(portfolio *domain.Portfolio, origin domain.Origin, operation Operation) (domain.Tax, error) {
+	return portfolio.ExplainBuy(origin, operation.Quantity, operation.UnitCost, operation.Fees), nil
+}
+
+type sellHandler struct{}
+
+func (sellHandler) Name() string { return "sell" }
+
+func (sellHandler) Validate(operation Operation) error { return validateTrade(operation) }
+
+func (sellHandler) Handle(portfolio *domain.Portfolio, origin domain.Origin, operation Operation) (domain.Tax, error) {
+	return portfolio.SellAt(origin, operation.Quantity, operation.UnitCost, operation.Fees)
+}
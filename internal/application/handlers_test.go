@@ -0,0 +1,128 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"sync"
+	"testing"
+)
+
+// bonusHandler adds shares received at no cost, e.g. a bonificação
+type bonusHandler struct{}
+
+func (bonusHandler) Name() string { return "bonus" }
+
+func (bonusHandler) Validate(operation Operation) error {
+	if operation.UnitCost != 0 {
+		return &PayloadError{Type: "bonus", Field: "unit-cost", Message: "must be 0"}
+	}
+	return nil
+}
+
+func (bonusHandler) Handle(portfolio *domain.Portfolio, origin domain.Origin, operation Operation) (domain.Tax, error) {
+	return portfolio.ExplainBuy(origin, operation.Quantity, 0, 0), nil
+}
+
+func TestRegisterHandler_NewOperationType(t *testing.T) {
+	RegisterHandler(bonusHandler{})
+	operations := []Operation{
+		op("buy", 20.00, 10000),
+		op("bonus", 0, 10000), // average cost 10
+		op("sell", 20.00, 5000),
+	}
+
+	processor := OperationProcessor{}
+	taxes, err := processor.ProcessOperations(context.Background(), operations)
+
+	if err != nil || taxes[2].Tax != 10000.0 {
+		t.Errorf("Handler failed: Expected tax 10000, got %v (%v)", taxes, err)
+	}
+	if types := OperationTypes(); types[len(types)-3] != "bonus" {
+		t.Errorf("Handler failed: Expected bonus among %v", types)
+	}
+}
+
+func TestOperationProcessor_Process_UnknownType(t *testing.T) {
+	operations := []Operation{op("buy", 10.00, 100), op("split", 0, 2)}
+
+	processor := OperationProcessor{}
+	_, err := processor.ProcessOperations(context.Background(), operations)
+
+	var operationError *OperationError
+	var unknown *UnknownOperationError
+	if !errors.As(err, &operationError) || operationError.Operation != 2 || !errors.As(err, &unknown) || unknown.Type != "split" {
+		t.Errorf("Unknown type failed: Expected an UnknownOperationError at operation 2, got %v", err)
+	}
+}
+
+func TestOperationProcessor_Process_InvalidPayload(t *testing.T) {
+	tests := []struct {
+		operation Operation
+		field     string
+	}{
+		{op("buy", 10.00, 0), "quantity"},
+		{op("sell", -1.00, 100), "unit-cost"},
+		{op("buy", 0, 100), "unit-cost"},
+		{Operation{Type: "buy", UnitCost: 10.00, Quantity: 100, Fees: -1}, "fees"},
+	}
+
+	for _, tt := range tests {
+		processor := OperationProcessor{}
+		_, err := processor.ProcessOperations(context.Background(), []Operation{tt.operation})
+
+		var payload *PayloadError
+		if !errors.As(err, &payload) || payload.Field != tt.field || payload.Type != tt.operation.Type {
+			t.Errorf("Payload failed: Expected a PayloadError for %s, got %v", tt.field, err)
+		}
+	}
+}
+
+func TestRegisterHandler_RejectsCorrectionTypes(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Handler failed: Expected registering cancel to panic")
+		}
+	}()
+
+	RegisterHandler(namedHandler{bonusHandler{}, "cancel"})
+}
+
+func TestRegisterHandler_ConcurrentLookups(t *testing.T) {
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterHandler(bonusHandler{})
+		}()
+		go func() {
+			defer wg.Done()
+			if _, ok := LookupHandler("buy"); !ok || len(OperationTypes()) < 4 {
+				t.Errorf("Handler failed: Expected buy to stay registered")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// namedHandler is a handler registered under another name
+type namedHandler struct {
+	OperationHandler
+	name string
+}
+
+func (h namedHandler) Name() string { return h.name }
+
+func TestSession_RejectedPayloadKeepsState(t *testing.T) {
+	session := (&OperationProcessor{}).NewSession()
+	session.Process(context.Background(), op("buy", 10.00, 100))
+
+	if _, err := session.Process(context.Background(), op("sell", 10.00, 0)); err == nil {
+		t.Fatalf("Payload failed: Expected the sell without quantity to be rejected")
+	}
+
+	if shares := session.Account("").Portfolios[""].TotalShares; shares != 100 {
+		t.Errorf("Payload failed: Expected 100 shares, got %d", shares)
+	}
+}
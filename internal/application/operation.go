@@ -0,0 +1,13 @@
+package application
+
+// Operation is a stock market operation, independent of the format it was read from
+type Operation struct {
+	ID       string // optional, identifies the trade so a re-submission is not processed twice
+	Type     string // "buy", "sell", or "cancel" and "amend" to correct the operation with id Ref
+	UnitCost float64
+	Quantity int
+	Ticker   string // optional, each ticker keeps its own portfolio
+	Date     string // optional, YYYY-MM-DD
+	Fees     float64
+	Ref      string // id of the operation a cancel or amend corrects
+}
@@ -1,38 +1,171 @@
 package application
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/andreposman/capital-gains/internal/domain"
-	"github.com/andreposman/capital-gains/internal/infra/json"
-	"log"
+	"log/slog"
 )
 
-type OperationProcessor struct{}
+type OperationProcessor struct {
+	// Explain keeps the Explanation of every result, the audit trail of how its tax was reached
+	Explain bool
+	// CheckpointEvery snapshots the portfolios every N buys and sells of a session, so a cancel or
+	// amend only replays from the nearest snapshot before the trade it corrects.
+	// DefaultCheckpointEvery when 0
+	CheckpointEvery int
+	// CheckpointMonthEnd also snapshots the portfolios at the end of every month, between the last
+	// trade of a month and the first of the next one. Only dated trades are checked
+	CheckpointMonthEnd bool
+	// Policy returns the tax rules of the portfolio of a ticker, e.g. by its asset class.
+	// domain.DefaultPolicy for every ticker when nil
+	Policy func(ticker string) domain.Policy
+	// LossGroup returns the group of a ticker. The tickers of a group share one accumulated loss, so a loss
+	// on one of them offsets the profits of the others, e.g. every stock but not the real estate funds.
+	// Every ticker is in the same group when nil
+	LossGroup func(ticker string) string
+	// Logger receives the debug traces of every operation and calculation step. slog.Default when nil
+	Logger *slog.Logger
+	// Sessions keeps the sessions of the accounts between calls to AppendTo, which replays the whole
+	// log of the account when nil. The processors that share it must only differ in Explain
+	Sessions *SessionCache
 
-func (op *OperationProcessor) ProcessOperations(operations []json.Operation) []domain.Tax {
-	portfolio := domain.Portfolio{}
-	results := make([]domain.Tax, len(operations))
+	subscribers []Subscriber
+}
 
-	for i, operation := range operations {
-		var currentTax = 0.0
-		var err error
+func (op *OperationProcessor) policyOf(ticker string) domain.Policy {
+	if op.Policy == nil {
+		return domain.DefaultPolicy
+	}
+	return op.Policy(ticker)
+}
+
+func (op *OperationProcessor) lossGroupOf(ticker string) string {
+	if op.LossGroup == nil {
+		return ""
+	}
+	return op.LossGroup(ticker)
+}
 
-		switch operation.Operation {
-		case "buy":
-			portfolio.Buy(operation.Quantity, operation.UnitCost)
-			currentTax = 0.0
+func (op *OperationProcessor) logger() *slog.Logger {
+	if op.Logger == nil {
+		return slog.Default()
+	}
+	return op.Logger
+}
 
-		case "sell":
-			currentTax, err = portfolio.Sell(operation.Quantity, operation.UnitCost)
-			if err != nil {
-				log.Fatalf("fatal error: Unexpected error during sell operation %d, assumption violated: %v", i+1, err)
-			}
+// LossLedger is the loss ledger of one loss group, empty when the processor has no LossGroup
+type LossLedger struct {
+	Group   string
+	Entries []domain.LossEntry
+}
 
-		default:
-			log.Printf("Warning: Unknown operation type '%s' at index %d", operation.Operation, i)
+// OperationError is an operation the portfolio rejected, e.g. selling more shares than it has
+type OperationError struct {
+	Operation int // 1-based position of the operation
+	Err       error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Operation, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError is processing stopped by its context between two operations. The results of the
+// operations processed before it are returned with it
+type CanceledError struct {
+	Processed int   // number of operations processed
+	Total     int   // number of operations given
+	Err       error // the error of the context, context.Canceled or context.DeadlineExceeded
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("processing canceled after %d of %d operations: %v", e.Processed, e.Total, e.Err)
+}
 
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// atPosition renumbers an *OperationError to the position of the operation in its batch,
+// which differs from its position in the session after a re-submitted id
+func atPosition(err error, position int) error {
+	var operationError *OperationError
+	if errors.As(err, &operationError) {
+		return &OperationError{Operation: position, Err: operationError.Err}
+	}
+	return err
+}
+
+// ProcessOperations returns the tax of each operation. Every ticker keeps its own
+// portfolio, sharing the accumulated loss of its LossGroup; operations without a ticker all share
+// the same one. A rejected operation returns
+// an *OperationError. When ctx is done it stops before the next operation and returns the
+// results so far with a *CanceledError
+func (op *OperationProcessor) ProcessOperations(ctx context.Context, operations []Operation) ([]domain.Tax, error) {
+	results, _, err := op.ProcessWithLedger(ctx, operations)
+	return results, err
+}
+
+// ProcessWithLedger is ProcessOperations also returning where the accumulated losses came from
+// and which sales used them, for every loss group that had a loss, sorted by group
+func (op *OperationProcessor) ProcessWithLedger(ctx context.Context, operations []Operation) ([]domain.Tax, []LossLedger, error) {
+	results := make([]domain.Tax, 0, len(operations))
+	session, err := op.each(ctx, operations, func(record OperationRecord) {
+		results = append(results, op.results([]OperationRecord{record})[0])
+	})
+	var canceled *CanceledError
+	if err != nil && !errors.As(err, &canceled) {
+		return nil, nil, err
+	}
+	return results, session.Ledgers(), err
+}
+
+// ProcessRecords is ProcessWithLedger returning the record of every operation: its result, always
+// explained, and the state of the portfolio of its ticker right after it
+func (op *OperationProcessor) ProcessRecords(ctx context.Context, operations []Operation) ([]OperationRecord, []LossLedger, error) {
+	records := make([]OperationRecord, 0, len(operations))
+	session, err := op.each(ctx, operations, func(record OperationRecord) {
+		records = append(records, record)
+	})
+	var canceled *CanceledError
+	if err != nil && !errors.As(err, &canceled) {
+		return nil, nil, err
+	}
+	return records, session.Ledgers(), err
+}
+
+// each processes operations in a new session, passing the record of each one to collect, so the
+// callers keep only what they return
+func (op *OperationProcessor) each(ctx context.Context, operations []Operation, collect func(OperationRecord)) (*Session, error) {
+	session := op.NewSession()
+	for i, operation := range operations {
+		record, err := session.Record(ctx, operation)
+		if ctx.Err() != nil && err != nil {
+			// the operation was not processed, the session is as it was before it
+			op.logger().Debug("processing canceled", "processed", i, "total", len(operations), "err", ctx.Err())
+			return session, &CanceledError{Processed: i, Total: len(operations), Err: ctx.Err()}
 		}
+		if err != nil {
+			return session, atPosition(err, i+1)
+		}
+		collect(record)
+	}
+	return session, nil
+}
 
-		results[i] = domain.Tax{Tax: currentTax}
+// results returns the result of every record, with its explanation only when Explain is set
+func (op *OperationProcessor) results(records []OperationRecord) []domain.Tax {
+	results := make([]domain.Tax, len(records))
+	for i, record := range records {
+		results[i] = record.Tax
+		if !op.Explain {
+			results[i].Explanation = nil
+		}
 	}
 	return results
 }
@@ -1,14 +1,18 @@
 package application
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"github.com/andreposman/capital-gains/internal/domain"
-	"github.com/andreposman/capital-gains/internal/infra/json"
+	"log/slog"
 	"reflect"
+	"strings"
 	"testing"
 )
 
-func op(opType string, cost float64, qty int) json.Operation {
-	return json.Operation{Operation: opType, UnitCost: cost, Quantity: qty}
+func op(opType string, cost float64, qty int) Operation {
+	return Operation{Type: opType, UnitCost: cost, Quantity: qty}
 }
 
 func taxResult(taxAmount float64) domain.Tax {
@@ -20,7 +24,7 @@ func TestOperationProcessor_ProcessOperations_Case1(t *testing.T) {
 	// {"operation":"sell", "unit-cost":15.00, "quantity": 50},
 	// {"operation":"sell", "unit-cost":15.00, "quantity": 50}]
 	// valor venda <= 20k
-	operations := []json.Operation{
+	operations := []Operation{
 		op("buy", 10.00, 100),
 		op("sell", 15.00, 50), // Total = 750 <= 20k -> Exempt, Profit = 50*(15-10)=250. Loss becomes max(0, 0-250)=0
 		op("sell", 15.00, 50), // Total = 750 <= 20k -> Exempt, Profit = 50*(15-10)=250. Loss becomes max(0, 0-250)=0
@@ -32,7 +36,10 @@ func TestOperationProcessor_ProcessOperations_Case1(t *testing.T) {
 	}
 
 	processor := OperationProcessor{}
-	result := processor.ProcessOperations(operations)
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Case 1 failed: Expected %v, got %v", expected, result)
@@ -43,7 +50,7 @@ func TestOperationProcessor_ProcessOperations_Case2(t *testing.T) {
 	// [{"operation":"buy", "unit-cost":10.00, "quantity": 10000},
 	// {"operation":"sell", "unit-cost":20.00, "quantity": 5000}, -> Taxable Profit 50k -> Tax 10k
 	// {"operation":"sell", "unit-cost":5.00, "quantity": 5000}] -> Taxable Loss 25k -> Acc Loss 25k
-	operations := []json.Operation{
+	operations := []Operation{
 		op("buy", 10.00, 10000),
 		op("sell", 20.00, 5000),
 		op("sell", 5.00, 5000),
@@ -56,7 +63,10 @@ func TestOperationProcessor_ProcessOperations_Case2(t *testing.T) {
 	}
 
 	processor := OperationProcessor{}
-	result := processor.ProcessOperations(operations)
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Case 2 failed: Expected %v, got %v", expected, result)
@@ -67,7 +77,7 @@ func TestOperationProcessor_ProcessOperations_Case3(t *testing.T) {
 	// [{"operation":"buy", "unit-cost":10.00, "quantity": 10000},
 	// {"operation":"sell", "unit-cost":5.00, "quantity": 5000}, -> Taxable Loss 25k -> Acc Loss 25k
 	// {"operation":"sell", "unit-cost":20.00, "quantity": 3000}] -> Taxable Profit 3k*(20-10)=30k. Net=30k-25k=5k. Tax=1k
-	operations := []json.Operation{
+	operations := []Operation{
 		op("buy", 10.00, 10000),
 		op("sell", 5.00, 5000),
 		op("sell", 20.00, 3000),
@@ -80,7 +90,10 @@ func TestOperationProcessor_ProcessOperations_Case3(t *testing.T) {
 	}
 
 	processor := OperationProcessor{}
-	result := processor.ProcessOperations(operations)
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Case 3 failed: Expected %v, got %v", expected, result)
@@ -91,7 +104,7 @@ func TestOperationProcessor_ProcessOperations_Case4(t *testing.T) {
 	// [{"operation":"buy", "unit-cost":10.00, "quantity": 10000}, -> WAC 10
 	// {"operation":"buy", "unit-cost":25.00, "quantity": 5000}, -> WAC (100k+125k)/15k = 225k/15k = 15
 	// {"operation":"sell", "unit-cost":15.00, "quantity": 10000}] -> Taxable Breakeven -> Tax 0
-	operations := []json.Operation{
+	operations := []Operation{
 		op("buy", 10.00, 10000),
 		op("buy", 25.00, 5000),
 		op("sell", 15.00, 10000),
@@ -103,7 +116,10 @@ func TestOperationProcessor_ProcessOperations_Case4(t *testing.T) {
 	}
 
 	processor := OperationProcessor{}
-	result := processor.ProcessOperations(operations)
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Case 4 failed: Expected %v, got %v", expected, result)
@@ -115,7 +131,7 @@ func TestOperationProcessor_ProcessOperations_Case5(t *testing.T) {
 	// {"operation":"buy", "unit-cost":25.00, "quantity": 5000}, -> WAC 15
 	// {"operation":"sell", "unit-cost":15.00, "quantity": 10000}, -> Taxable Break even -> Tax 0
 	// {"operation":"sell", "unit-cost":25.00, "quantity": 5000}] -> Taxable Profit 5k*(25-15)=50k -> Tax 10k
-	operations := []json.Operation{
+	operations := []Operation{
 		op("buy", 10.00, 10000),
 		op("buy", 25.00, 5000),
 		op("sell", 15.00, 10000),
@@ -129,7 +145,10 @@ func TestOperationProcessor_ProcessOperations_Case5(t *testing.T) {
 	}
 
 	processor := OperationProcessor{}
-	result := processor.ProcessOperations(operations)
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Case 5 failed: Expected %v, got %v", expected, result)
@@ -143,7 +162,7 @@ func TestOperationProcessor_ProcessOperations_Case6(t *testing.T) {
 	// {"operation":"sell", "unit-cost":20.00, "quantity": 2000}, -> Taxable Profit 2k*(20-10)=20k. Net=max(0,20k-40k)=0. Tax=0. Rem Loss=20k
 	// {"operation":"sell", "unit-cost":20.00, "quantity": 2000}, -> Taxable Profit 2k*(20-10)=20k. Net=max(0,20k-20k)=0. Tax=0. Rem Loss=0
 	// {"operation":"sell", "unit-cost":25.00, "quantity": 1000}] -> Taxable Profit 1k*(25-10)=15k. Net=max(0,15k-0)=15k. Tax=3k
-	operations := []json.Operation{
+	operations := []Operation{
 		op("buy", 10.00, 10000),
 		op("sell", 2.00, 5000),
 		op("sell", 20.00, 2000),
@@ -159,9 +178,487 @@ func TestOperationProcessor_ProcessOperations_Case6(t *testing.T) {
 	}
 
 	processor := OperationProcessor{}
-	result := processor.ProcessOperations(operations)
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Case 6 failed: Expected %v, got %v", expected, result)
 	}
 }
+
+// Each ticker has its own average cost, while the accumulated loss is shared
+func TestOperationProcessor_ProcessOperations_MultipleTickers(t *testing.T) {
+	operations := []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{Type: "buy", UnitCost: 30.00, Quantity: 10000, Ticker: "VALE3"},
+		{Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"}, // WAC 10 -> Profit 50k -> Tax 10k
+		{Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "VALE3"}, // WAC 30 -> Loss 50k
+		{Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"}, // Profit 50k offset by the VALE3 loss -> Tax 0
+	}
+	expected := []domain.Tax{
+		taxResult(0.0),
+		taxResult(0.0),
+		taxResult(10000.0),
+		taxResult(0.0),
+		taxResult(0.0),
+	}
+
+	processor := OperationProcessor{}
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Multiple tickers failed: Expected %v, got %v", expected, result)
+	}
+}
+
+func TestOperationProcessor_ProcessOperations_Fees(t *testing.T) {
+	operations := []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 10000, Fees: 100.00}, // WAC (100k + 100) / 10k = 10.01
+		{Type: "sell", UnitCost: 20.00, Quantity: 5000, Fees: 50.00},  // Profit 5k*(20-10.01) - 50 = 49,900 -> Tax 9,980
+	}
+	expected := []domain.Tax{
+		taxResult(0.0),
+		taxResult(9980.0),
+	}
+
+	processor := OperationProcessor{}
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Fees failed: Expected %v, got %v", expected, result)
+	}
+}
+
+func TestOperationProcessor_ProcessOperations_Explain(t *testing.T) {
+	operations := []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 10000},
+		{Type: "sell", UnitCost: 5.00, Quantity: 5000},  // Loss 25k
+		{Type: "sell", UnitCost: 15.00, Quantity: 1000}, // 15k sale, exempt, loss 20k
+		{Type: "sell", UnitCost: 20.00, Quantity: 1500}, // Profit 15k offset, loss 5k
+		{Type: "sell", UnitCost: 20.00, Quantity: 2500}, // Profit 25k - 5k = 20k -> Tax 4k
+	}
+	expected := []string{
+		domain.ReasonBuyNoTax,
+		domain.ReasonSaleAtLoss,
+		domain.ReasonExemptUnderThreshold,
+		domain.ReasonLossOffset,
+		domain.ReasonTaxedProfit,
+	}
+
+	processor := OperationProcessor{Explain: true}
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
+
+	for i, reason := range expected {
+		if result[i].Explanation == nil || result[i].Explanation.Reason != reason {
+			t.Errorf("Explain failed: operation %d expected reason %s, got %+v", i+1, reason, result[i].Explanation)
+		}
+	}
+	if last := result[4]; last.Tax != 4000.0 || last.Explanation.LossUsed != 5000.0 || last.Explanation.TaxableBase != 20000.0 {
+		t.Errorf("Explain failed: expected tax 4000 on a 20000 base using 5000 of loss, got %v %+v", last.Tax, *last.Explanation)
+	}
+}
+
+func TestOperationProcessor_ProcessOperations_NoExplanationByDefault(t *testing.T) {
+	operations := []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 100},
+		{Type: "sell", UnitCost: 15.00, Quantity: 50},
+	}
+
+	processor := OperationProcessor{}
+	result, err := processor.ProcessOperations(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessOperations failed: %v", err)
+	}
+
+	for i, tax := range result {
+		if tax.Explanation != nil {
+			t.Errorf("Explain failed: operation %d should have no explanation, got %+v", i+1, *tax.Explanation)
+		}
+	}
+}
+
+func TestOperationProcessor_ProcessWithLedger(t *testing.T) {
+	operations := []Operation{
+		{Type: "buy", UnitCost: 20.00, Quantity: 10000, Ticker: "VALE3"},
+		{Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{Type: "sell", UnitCost: 10.00, Quantity: 5000, Ticker: "VALE3", Date: "2024-03-01"}, // Loss 50k
+		{Type: "sell", UnitCost: 20.00, Quantity: 2000, Ticker: "VALE3", Date: "2024-03-15"}, // Profit 0
+		{Type: "sell", UnitCost: 30.00, Quantity: 2000, Ticker: "VALE3", Date: "2024-04-02"}, // Profit 20k, uses 20k
+		{Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4", Date: "2024-04-03"}, // Profit 50k, uses the other 30k
+	}
+	expected := []LossLedger{
+		{
+			Entries: []domain.LossEntry{
+				{
+					Origin:    domain.Origin{Operation: 3, Ticker: "VALE3", Date: "2024-03-01"},
+					Amount:    50000.00,
+					Remaining: 0.00,
+					Consumptions: []domain.LossConsumption{
+						{Origin: domain.Origin{Operation: 5, Ticker: "VALE3", Date: "2024-04-02"}, Amount: 20000.00},
+						{Origin: domain.Origin{Operation: 6, Ticker: "PETR4", Date: "2024-04-03"}, Amount: 30000.00},
+					},
+				},
+			},
+		},
+	}
+
+	processor := OperationProcessor{}
+	taxes, ledgers, err := processor.ProcessWithLedger(context.Background(), operations)
+	if err != nil {
+		t.Fatalf("ProcessWithLedger failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(ledgers, expected) {
+		t.Errorf("Ledger failed: Expected %+v, got %+v", expected, ledgers)
+	}
+	if taxes[4].Tax != 0.0 || taxes[5].Tax != 4000.0 {
+		t.Errorf("Ledger failed: Expected taxes 0 and 4000, got %v", taxes)
+	}
+}
+
+func TestOperationProcessor_LossSharedAcrossTickers(t *testing.T) {
+	operations := []Operation{
+		{Type: "buy", UnitCost: 20.00, Quantity: 10000, Ticker: "VALE3"},
+		{Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{Type: "buy", UnitCost: 100.00, Quantity: 1000, Ticker: "HGLG11"},
+		{Type: "sell", UnitCost: 10.00, Quantity: 5000, Ticker: "VALE3"},  // Loss 50k
+		{Type: "sell", UnitCost: 20.00, Quantity: 2500, Ticker: "PETR4"},  // Profit 25k
+		{Type: "sell", UnitCost: 150.00, Quantity: 500, Ticker: "HGLG11"}, // Profit 25k
+	}
+	tests := []struct {
+		name      string
+		lossGroup func(ticker string) string
+		expected  []float64
+		groups    []string
+	}{
+		{name: "one group", expected: []float64{0, 0, 0, 0, 0, 0}, groups: []string{""}},
+		{
+			name: "stocks and funds",
+			lossGroup: func(ticker string) string {
+				if strings.HasSuffix(ticker, "11") {
+					return "funds"
+				}
+				return "stocks"
+			},
+			expected: []float64{0, 0, 0, 0, 0, 5000},
+			groups:   []string{"stocks"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			processor := OperationProcessor{LossGroup: test.lossGroup}
+			taxes, ledgers, err := processor.ProcessWithLedger(context.Background(), operations)
+			if err != nil {
+				t.Fatalf("ProcessWithLedger failed: %v", err)
+			}
+
+			for i, tax := range taxes {
+				if tax.Tax != test.expected[i] {
+					t.Errorf("LossGroup failed: operation %d: Expected tax %.2f, got %.2f", i+1, test.expected[i], tax.Tax)
+				}
+			}
+			var groups []string
+			for _, ledger := range ledgers {
+				groups = append(groups, ledger.Group)
+			}
+			if !reflect.DeepEqual(groups, test.groups) {
+				t.Errorf("LossGroup failed: Expected ledgers of %q, got %q", test.groups, groups)
+			}
+		})
+	}
+}
+
+func TestOperationProcessor_ProcessRecords(t *testing.T) {
+	operations := []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{Type: "buy", UnitCost: 20.00, Quantity: 100, Ticker: "VALE3"},
+		{Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"},
+	}
+
+	processor := OperationProcessor{}
+	records, _, err := processor.ProcessRecords(context.Background(), operations)
+
+	if err != nil || len(records) != 3 || records[2].Sequence != 3 || records[2].Tax.Tax != 10000.0 || records[2].Tax.Explanation == nil {
+		t.Fatalf("Records failed: Expected 3 explained records, got %+v", records)
+	}
+	// the portfolio of the ticker of each operation
+	if records[1].Portfolio.TotalShares != 100 || records[2].Portfolio.TotalShares != 5000 {
+		t.Errorf("Records failed: Expected 100 and 5000 shares, got %+v and %+v", records[1].Portfolio, records[2].Portfolio)
+	}
+}
+
+func TestOperationProcessor_ProcessOperations_CanceledReturnsPartialResults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	processor := OperationProcessor{}
+	// cancels while the second operation is processed, so it completes and the third is not started
+	processor.Subscribe(SubscriberFunc(func(event Event) {
+		if event.Operation == 2 {
+			cancel()
+		}
+	}))
+	operations := []Operation{op("buy", 10.00, 10000), op("sell", 20.00, 5000), op("sell", 20.00, 5000)}
+
+	taxes, err := processor.ProcessOperations(ctx, operations)
+
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) || canceled.Processed != 2 || canceled.Total != 3 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Cancel failed: Expected a CanceledError after 2 of 3 operations, got %v", err)
+	}
+	if !reflect.DeepEqual(taxes, []domain.Tax{taxResult(0), taxResult(10000)}) {
+		t.Errorf("Cancel failed: Expected the results of the first 2 operations, got %v", taxes)
+	}
+}
+
+func TestOperationProcessor_ProcessWithLedger_CanceledReturnsPartialLedger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	processor := OperationProcessor{}
+	processor.Subscribe(SubscriberFunc(func(event Event) {
+		if event.Operation == 2 {
+			cancel()
+		}
+	}))
+	operations := []Operation{op("buy", 10.00, 10000), op("sell", 5.00, 5000), op("sell", 20.00, 5000)}
+
+	taxes, ledgers, err := processor.ProcessWithLedger(ctx, operations)
+
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) || canceled.Processed != 2 {
+		t.Fatalf("Cancel failed: Expected a CanceledError after 2 operations, got %v", err)
+	}
+	if len(taxes) != 2 || len(ledgers) != 1 || ledgers[0].Entries[0].Remaining != 25000.00 {
+		t.Errorf("Cancel failed: Expected the results and the loss of the first 2 operations, got %v and %+v", taxes, ledgers)
+	}
+}
+
+func TestSession_CanceledOperationKeepsState(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := (&OperationProcessor{}).NewSession()
+	session.Process(ctx, Operation{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 100})
+	cancel()
+
+	_, err := session.Process(ctx, Operation{Type: "cancel", Ref: "b1"})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancel failed: Expected context.Canceled, got %v", err)
+	}
+	if shares := session.Account("").Portfolios[""].TotalShares; shares != 100 {
+		t.Errorf("Cancel failed: Expected 100 shares, got %d", shares)
+	}
+}
+
+func TestOperationProcessor_Process_InsufficientShares(t *testing.T) {
+	operations := []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 100},
+		{Type: "sell", UnitCost: 10.00, Quantity: 200},
+	}
+
+	processor := OperationProcessor{}
+	result, err := processor.ProcessOperations(context.Background(), operations)
+
+	var operationError *OperationError
+	if !errors.As(err, &operationError) || operationError.Operation != 2 {
+		t.Fatalf("Insufficient shares failed: Expected an error for operation 2, got %v", err)
+	}
+	if !errors.Is(err, domain.ErrInsufficientShares) {
+		t.Errorf("Insufficient shares failed: Expected ErrInsufficientShares, got %v", err)
+	}
+	if result != nil {
+		t.Errorf("Insufficient shares failed: Expected no results, got %v", result)
+	}
+}
+
+func TestSession_ContinuesAfterRejectedOperation(t *testing.T) {
+	processor := OperationProcessor{}
+	session := processor.NewSession()
+
+	session.Process(context.Background(), Operation{Type: "buy", UnitCost: 10.00, Quantity: 10000})
+	if _, err := session.Process(context.Background(), Operation{Type: "sell", UnitCost: 20.00, Quantity: 20000}); !errors.Is(err, domain.ErrInsufficientShares) {
+		t.Fatalf("Session failed: Expected ErrInsufficientShares, got %v", err)
+	}
+	result, err := session.Process(context.Background(), Operation{Type: "sell", UnitCost: 20.00, Quantity: 5000})
+
+	if err != nil || result.Tax != 10000.0 {
+		t.Errorf("Session failed: Expected tax 10000 on the kept portfolio, got %v, %v", result.Tax, err)
+	}
+}
+
+func TestSession_ResubmittedIDReturnsOriginalResult(t *testing.T) {
+	processor := OperationProcessor{}
+	session := processor.NewSession()
+	sell := Operation{ID: "s1", Type: "sell", UnitCost: 20.00, Quantity: 5000}
+
+	session.Process(context.Background(), Operation{Type: "buy", UnitCost: 10.00, Quantity: 10000})
+	first, _ := session.Process(context.Background(), sell)
+	second, err := session.Process(context.Background(), sell)
+	third, _ := session.Process(context.Background(), Operation{Type: "sell", UnitCost: 20.00, Quantity: 5000})
+
+	if err != nil || first.Tax != 10000.0 || second.Tax != 10000.0 {
+		t.Errorf("Session failed: Expected the original tax twice, got %v and %v (%v)", first.Tax, second.Tax, err)
+	}
+	// the re-submission did not sell, so 5000 shares were left
+	if third.Tax != 10000.0 {
+		t.Errorf("Session failed: Expected the last 5000 shares to be sold, got %v", third.Tax)
+	}
+}
+
+func TestSession_ResubmittedIDAfterCorrection(t *testing.T) {
+	processor := OperationProcessor{}
+	session := processor.NewSession()
+	buy := Operation{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 10000}
+	sell := Operation{ID: "s1", Type: "sell", UnitCost: 5.00, Quantity: 5000}  // Loss 25k
+	last := Operation{ID: "s2", Type: "sell", UnitCost: 20.00, Quantity: 3000} // Profit 30k - 25k -> Tax 1k
+
+	session.Process(context.Background(), buy)
+	session.Process(context.Background(), sell)
+	session.Process(context.Background(), last)
+	session.Process(context.Background(), Operation{Type: "cancel", Ref: "s1"}) // without the loss -> Tax 6k
+	resubmitted, err := session.Process(context.Background(), last)
+	cancelled, _ := session.Process(context.Background(), sell)
+
+	if err != nil || resubmitted.Tax != 6000.0 {
+		t.Errorf("Session failed: Expected the recomputed tax 6000, got %v (%v)", resubmitted.Tax, err)
+	}
+	if cancelled.Tax != 0 || cancelled.Explanation != nil {
+		t.Errorf("Session failed: Expected no tax for the cancelled sale, got %+v", cancelled)
+	}
+}
+
+func TestOperationProcessor_Replay(t *testing.T) {
+	processor := OperationProcessor{}
+	session := processor.NewSession()
+	var log []OperationRecord
+	for _, operation := range []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{Type: "sell", UnitCost: 5.00, Quantity: 2000, Ticker: "PETR4"},
+		{Type: "buy", UnitCost: 30.00, Quantity: 100, Ticker: "VALE3", ID: "v1"},
+	} {
+		record, _, _ := session.apply(context.Background(), operation)
+		log = append(log, record)
+	}
+
+	replayed, err := processor.Replay(context.Background(), log)
+
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if !reflect.DeepEqual(replayed.Account("alice"), session.Account("alice")) {
+		t.Errorf("Replay failed: Expected %+v, got %+v", session.Account("alice"), replayed.Account("alice"))
+	}
+	if _, err := replayed.Process(context.Background(), Operation{Type: "buy", UnitCost: 31.00, Quantity: 100, Ticker: "VALE3", ID: "v1"}); err == nil {
+		t.Errorf("Replay failed: Expected the ids of the log to be known after the replay")
+	}
+}
+
+func TestOperationProcessor_CancelRecomputesLaterSales(t *testing.T) {
+	processor := OperationProcessor{}
+	operations := []Operation{
+		{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 10000},
+		{ID: "s1", Type: "sell", UnitCost: 5.00, Quantity: 5000},  // Loss 25k
+		{ID: "s2", Type: "sell", UnitCost: 20.00, Quantity: 3000}, // Profit 30k - 25k -> Tax 1k
+		{Type: "cancel", Ref: "s1"},                               // without the loss -> Tax 6k
+	}
+	expected := []domain.Adjustment{{Operation: 3, ID: "s2", Before: 1000.0, After: 6000.0, Difference: 5000.0}}
+
+	results, err := processor.ProcessOperations(context.Background(), operations)
+
+	if err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if !reflect.DeepEqual(results[3].Adjustments, expected) || results[3].Tax != 0 {
+		t.Errorf("Cancel failed: Expected %+v, got %+v", expected, results[3])
+	}
+}
+
+func TestOperationProcessor_AmendRecomputesAverageCost(t *testing.T) {
+	processor := OperationProcessor{}
+	session := processor.NewSession()
+
+	session.Process(context.Background(), Operation{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"})
+	session.Process(context.Background(), Operation{Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"}) // Tax 10k
+	result, err := session.Process(context.Background(), Operation{Type: "amend", Ref: "b1", UnitCost: 15.00, Quantity: 10000})
+	next, _ := session.Process(context.Background(), Operation{Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"})
+
+	expected := []domain.Adjustment{{Operation: 2, Before: 10000.0, After: 5000.0, Difference: -5000.0}}
+	if err != nil || !reflect.DeepEqual(result.Adjustments, expected) {
+		t.Errorf("Amend failed: Expected %+v, got %+v (%v)", expected, result.Adjustments, err)
+	}
+	// the amended buy keeps its ticker, so the remaining shares cost 15.00
+	if next.Tax != 5000.0 {
+		t.Errorf("Amend failed: Expected the next sale to use the amended average cost, got %v", next.Tax)
+	}
+}
+
+func TestSession_CorrectionOfUnknownID(t *testing.T) {
+	processor := OperationProcessor{}
+	session := processor.NewSession()
+	session.Process(context.Background(), Operation{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 100})
+	session.Process(context.Background(), Operation{Type: "cancel", Ref: "b1"})
+
+	_, err := session.Process(context.Background(), Operation{Type: "cancel", Ref: "b1"})
+
+	var operationError *OperationError
+	if !errors.Is(err, ErrUnknownReference) || !errors.As(err, &operationError) || operationError.Operation != 3 {
+		t.Errorf("Cancel failed: Expected ErrUnknownReference at operation 3, got %v", err)
+	}
+}
+
+func TestSession_RejectedCorrectionKeepsState(t *testing.T) {
+	processor := OperationProcessor{}
+	session := processor.NewSession()
+	session.Process(context.Background(), Operation{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 100})
+	session.Process(context.Background(), Operation{Type: "sell", UnitCost: 10.00, Quantity: 100})
+
+	_, err := session.Process(context.Background(), Operation{Type: "cancel", Ref: "b1"})
+
+	if !errors.Is(err, domain.ErrInsufficientShares) {
+		t.Errorf("Cancel failed: Expected the sale without shares to be rejected, got %v", err)
+	}
+	if account := session.Account("alice"); account.Operations != 2 || account.Portfolios[""].TotalShares != 0 {
+		t.Errorf("Cancel failed: Expected the session to be unchanged, got %+v", account)
+	}
+}
+
+func TestOperationProcessor_Logger_TracesOperationsByTicker(t *testing.T) {
+	var logs bytes.Buffer
+	processor := OperationProcessor{Logger: slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))}
+
+	processor.ProcessOperations(context.Background(), []Operation{
+		{Type: "buy", Ticker: "PETR4", UnitCost: 10.00, Quantity: 10000},
+		{Type: "sell", Ticker: "PETR4", UnitCost: 20.00, Quantity: 5000},
+	})
+
+	for _, trace := range []string{
+		`msg="processing operation" operation=2 type=sell ticker=PETR4`,
+		`msg="tax assessed" ticker=PETR4 sale-value=100000`,
+		`msg="operation processed" operation=2 tax=10000`,
+	} {
+		if !strings.Contains(logs.String(), trace) {
+			t.Errorf("Logger failed: Expected the trace %q, got %q", trace, logs.String())
+		}
+	}
+}
+
+func TestOperationProcessor_Logger_NoTracesAboveDebug(t *testing.T) {
+	var logs bytes.Buffer
+	processor := OperationProcessor{Logger: slog.New(slog.NewTextHandler(&logs, nil))}
+
+	processor.ProcessOperations(context.Background(), []Operation{op("buy", 10.00, 100), op("sell", 15.00, 50)})
+
+	if logs.Len() != 0 {
+		t.Errorf("Logger failed: Expected no logs at info level, got %q", logs.String())
+	}
+}
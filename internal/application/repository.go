@@ -0,0 +1,101 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/domain"
+)
+
+// ErrAccountNotFound is returned for an account that has no operations yet
+var ErrAccountNotFound = errors.New("account not found")
+
+// OperationRecord is an entry of the operation log of an account: the operation with its result
+// and the state of the portfolio of its ticker right after it
+type OperationRecord struct {
+	Sequence  int                   `json:"sequence"` // 1-based position of the operation in the log
+	Operation Operation             `json:"operation"`
+	Tax       domain.Tax            `json:"tax"` // always has its explanation
+	Portfolio domain.PortfolioState `json:"portfolio"`
+}
+
+// Commit is everything one call to AppendTo changes in an account: the records appended to its
+// log and the account state after them
+type Commit struct {
+	Account Account
+	Records []OperationRecord
+}
+
+// PortfolioRepository keeps the operation log of every account, and the account state as a
+// projection of it for reads
+type PortfolioRepository interface {
+	// Get returns the account with id, or ErrAccountNotFound
+	Get(id string) (Account, error)
+	// Update calls fn with the operation log of the account, empty when it does not exist, and saves
+	// the commit fn returns in a single transaction: the account and the records are written together
+	// or not at all. Records are only ever appended. Nothing is written when fn fails.
+	// Updates of the same account are serialized
+	Update(id string, fn func(log []OperationRecord) (Commit, error)) error
+	Close() error
+}
+
+// OperationStore keeps the history of the operations of every account
+type OperationStore interface {
+	// History returns the operation log of account id in order, or ErrAccountNotFound
+	History(id string) ([]OperationRecord, error)
+}
+
+// AppendTo processes operations after the ones in the log of account id, whose state is taken from
+// Sessions or rebuilt by replaying the log, and appends them to the log. It returns their taxes; the records always keep the
+// explanation, the results only with Explain. A re-submitted id is not appended again and returns
+// its original result. When an operation is rejected nothing is appended and the *OperationError
+// counts the operations from the first one of this call. When ctx is done nothing is appended either
+// and a *CanceledError is returned
+func (op *OperationProcessor) AppendTo(ctx context.Context, repository PortfolioRepository, id string, operations []Operation) ([]domain.Tax, error) {
+	var results []domain.Tax
+	var updated *Session
+	err := repository.Update(id, func(log []OperationRecord) (Commit, error) {
+		sequence := 0
+		if len(log) > 0 {
+			sequence = log[len(log)-1].Sequence
+		}
+		// the session taken from the cache is left out of it until the commit is saved, since a
+		// rejected operation leaves it with the operations before it
+		session := op.Sessions.take(id, sequence)
+		if session == nil {
+			var err error
+			if session, err = op.Replay(ctx, log); err != nil {
+				return Commit{}, err
+			}
+		}
+		session.processor = op
+
+		var commit Commit
+		results = make([]domain.Tax, len(operations))
+		for i, operation := range operations {
+			if err := ctx.Err(); err != nil {
+				return Commit{}, &CanceledError{Processed: i, Total: len(operations), Err: err}
+			}
+			record, duplicate, err := session.apply(ctx, operation)
+			if err != nil {
+				return Commit{}, atPosition(err, i+1)
+			}
+			if !duplicate {
+				commit.Records = append(commit.Records, record)
+			}
+
+			results[i] = record.Tax
+			if !op.Explain {
+				results[i].Explanation = nil
+			}
+		}
+
+		commit.Account = session.Account(id)
+		updated = session
+		return commit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	op.Sessions.put(id, updated)
+	return results, nil
+}
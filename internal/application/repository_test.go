@@ -0,0 +1,187 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"reflect"
+	"testing"
+)
+
+// logRepository is a PortfolioRepository that keeps the log of a single account in memory
+type logRepository struct {
+	log     []OperationRecord
+	account *Account
+}
+
+func (r *logRepository) Get(string) (Account, error) {
+	if r.account == nil {
+		return Account{}, ErrAccountNotFound
+	}
+	return *r.account, nil
+}
+
+func (r *logRepository) Update(_ string, fn func(log []OperationRecord) (Commit, error)) error {
+	commit, err := fn(append([]OperationRecord(nil), r.log...))
+	if err != nil {
+		return err
+	}
+	r.log = append(r.log, commit.Records...)
+	r.account = &commit.Account
+	return nil
+}
+
+func (r *logRepository) Close() error { return nil }
+
+func TestOperationProcessor_AppendTo_ContinuesFromLog(t *testing.T) {
+	processor := OperationProcessor{}
+	repository := &logRepository{}
+
+	processor.AppendTo(context.Background(), repository, "alice", []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{Type: "sell", UnitCost: 5.00, Quantity: 5000, Ticker: "PETR4"}, // Loss 25k
+	})
+	result, err := processor.AppendTo(context.Background(), repository, "alice", []Operation{
+		{Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"}, // Profit 50k - 25k -> Tax 5k
+	})
+
+	if err != nil || !reflect.DeepEqual(result, []domain.Tax{{Tax: 5000.0}}) {
+		t.Fatalf("AppendTo failed: Expected tax 5000, got %v (%v)", result, err)
+	}
+	if len(repository.log) != 3 || repository.log[2].Sequence != 3 || repository.log[2].Tax.Explanation == nil {
+		t.Errorf("AppendTo failed: Expected 3 explained records, got %+v", repository.log)
+	}
+	account := *repository.account
+	if account.Operations != 3 || account.Portfolios["PETR4"].TotalShares != 0 {
+		t.Errorf("AppendTo failed: Expected an empty PETR4 position after 3 operations, got %+v", account)
+	}
+	if state := account.Portfolios["PETR4"]; state.AccumulatedLoss != 0 || state.Ledger != nil {
+		t.Errorf("AppendTo failed: Expected the loss used up and no ledger in the account, got %+v", state)
+	}
+}
+
+func TestOperationProcessor_AppendTo_RejectedOperationAppendsNothing(t *testing.T) {
+	processor := OperationProcessor{}
+	repository := &logRepository{}
+	processor.AppendTo(context.Background(), repository, "alice", []Operation{{Type: "buy", UnitCost: 10.00, Quantity: 100}})
+
+	_, err := processor.AppendTo(context.Background(), repository, "alice", []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 100},
+		{Type: "sell", UnitCost: 10.00, Quantity: 500},
+	})
+
+	var operationError *OperationError
+	if !errors.As(err, &operationError) || operationError.Operation != 2 || !errors.Is(err, domain.ErrInsufficientShares) {
+		t.Fatalf("AppendTo failed: Expected ErrInsufficientShares for the second operation, got %v", err)
+	}
+	if len(repository.log) != 1 || repository.account.Portfolios[""].TotalShares != 100 {
+		t.Errorf("AppendTo failed: Expected the account untouched, got %+v", repository.account)
+	}
+}
+
+func TestOperationProcessor_AppendTo_ResubmittedIDIsNotAppended(t *testing.T) {
+	processor := OperationProcessor{}
+	repository := &logRepository{}
+	trade := Operation{ID: "note-42/1", Type: "sell", UnitCost: 20.00, Quantity: 5000}
+	processor.AppendTo(context.Background(), repository, "alice", []Operation{{Type: "buy", UnitCost: 10.00, Quantity: 10000}, trade})
+
+	// the broker file is ingested again with one new trade
+	result, err := processor.AppendTo(context.Background(), repository, "alice", []Operation{trade, {ID: "note-43/1", Type: "sell", UnitCost: 20.00, Quantity: 1000}})
+
+	if err != nil || !reflect.DeepEqual(result, []domain.Tax{{Tax: 10000.0}, {Tax: 0.0}}) {
+		t.Fatalf("AppendTo failed: Expected the original tax then 0, got %v (%v)", result, err)
+	}
+	if len(repository.log) != 3 || repository.account.Portfolios[""].TotalShares != 4000 {
+		t.Errorf("AppendTo failed: Expected the re-submitted trade to be counted once, got %+v", repository.account)
+	}
+}
+
+func TestOperationProcessor_AppendTo_ReusedIDConflicts(t *testing.T) {
+	processor := OperationProcessor{}
+	repository := &logRepository{}
+	processor.AppendTo(context.Background(), repository, "alice", []Operation{{ID: "t1", Type: "buy", UnitCost: 10.00, Quantity: 100}})
+
+	_, err := processor.AppendTo(context.Background(), repository, "alice", []Operation{{ID: "t1", Type: "buy", UnitCost: 11.00, Quantity: 100}})
+
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.ID != "t1" || conflict.Original.UnitCost != 10.00 {
+		t.Fatalf("AppendTo failed: Expected a conflict on t1, got %v", err)
+	}
+	if len(repository.log) != 1 {
+		t.Errorf("AppendTo failed: Expected nothing appended, got %+v", repository.log)
+	}
+}
+
+func TestOperationProcessor_AppendTo_CachedSession(t *testing.T) {
+	sessions := NewSessionCache(0)
+	processor := OperationProcessor{Sessions: sessions, CheckpointEvery: 2}
+	repository := &logRepository{}
+	ctx := context.Background()
+	var cancel Operation
+	for _, operation := range history(10) {
+		if operation.Type == "sell" {
+			cancel = Operation{Type: "cancel", Ref: operation.ID}
+		}
+		if _, err := processor.AppendTo(ctx, repository, "alice", []Operation{operation}); err != nil {
+			t.Fatalf("AppendTo failed: %v", err)
+		}
+	}
+
+	// the session and its checkpoints are kept between calls instead of being replayed from the log
+	session := sessions.take("alice", 10)
+	if session == nil || len(session.checkpoints) != 4 {
+		t.Fatalf("AppendTo failed: Expected the cached session with 4 checkpoints, got %+v", session)
+	}
+	sessions.put("alice", session)
+
+	result, err := processor.AppendTo(ctx, repository, "alice", []Operation{cancel})
+	replayed, _ := (&OperationProcessor{}).Replay(ctx, repository.log[:10])
+	expected, _ := replayed.Process(ctx, cancel)
+	if err != nil || !reflect.DeepEqual(result, []domain.Tax{expected}) {
+		t.Errorf("AppendTo failed: Expected %+v from the full replay, got %+v (%v)", expected, result, err)
+	}
+}
+
+func TestOperationProcessor_AppendTo_CachedSessionSkipsRejectedCall(t *testing.T) {
+	processor := OperationProcessor{Sessions: NewSessionCache(0)}
+	repository := &logRepository{}
+	ctx := context.Background()
+	processor.AppendTo(ctx, repository, "alice", []Operation{{Type: "buy", UnitCost: 10.00, Quantity: 100}})
+	processor.AppendTo(ctx, repository, "alice", []Operation{
+		{Type: "buy", UnitCost: 10.00, Quantity: 100},
+		{Type: "sell", UnitCost: 10.00, Quantity: 500}, // rejected, so the buy before it is not kept either
+	})
+
+	_, err := processor.AppendTo(ctx, repository, "alice", []Operation{{Type: "sell", UnitCost: 10.00, Quantity: 150}})
+
+	if !errors.Is(err, domain.ErrInsufficientShares) {
+		t.Errorf("AppendTo failed: Expected ErrInsufficientShares with 100 shares, got %v", err)
+	}
+}
+
+func TestOperationProcessor_AppendTo_CachedSessionBehindLog(t *testing.T) {
+	processor := OperationProcessor{Sessions: NewSessionCache(0)}
+	repository := &logRepository{}
+	ctx := context.Background()
+	processor.AppendTo(ctx, repository, "alice", []Operation{{Type: "buy", UnitCost: 10.00, Quantity: 10000}})
+	// another server appends to the same log
+	(&OperationProcessor{}).AppendTo(ctx, repository, "alice", []Operation{{Type: "buy", UnitCost: 20.00, Quantity: 10000}})
+
+	result, err := processor.AppendTo(ctx, repository, "alice", []Operation{{Type: "sell", UnitCost: 20.00, Quantity: 10000}}) // WAC 15 -> Tax 10k
+
+	if err != nil || !reflect.DeepEqual(result, []domain.Tax{{Tax: 10000.0}}) {
+		t.Errorf("AppendTo failed: Expected the log replayed and tax 10000, got %v (%v)", result, err)
+	}
+}
+
+func TestSessionCache_DropsLeastRecentlyUsed(t *testing.T) {
+	sessions := NewSessionCache(2)
+	processor := OperationProcessor{}
+	for _, id := range []string{"alice", "bob", "alice", "carol"} {
+		sessions.put(id, processor.NewSession())
+	}
+
+	if sessions.take("bob", 0) != nil || sessions.take("alice", 0) == nil || sessions.take("carol", 0) == nil {
+		t.Errorf("SessionCache failed: Expected bob to be dropped")
+	}
+}
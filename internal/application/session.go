@@ -0,0 +1,414 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"github.com/andreposman/capital-gains/pkg/helpers"
+	"sort"
+)
+
+// ConflictError is an operation id that was already used for a different operation
+type ConflictError struct {
+	ID       string
+	Original Operation
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("id %q was already used for a different operation", e.ID)
+}
+
+// ErrUnknownReference is a cancel or amend whose Ref is not the id of a buy or sell in effect
+var ErrUnknownReference = errors.New("no buy or sell to correct with id")
+
+// Session processes operations one at a time, keeping the portfolios between calls,
+// e.g. for a stream of operations
+type Session struct {
+	processor  *OperationProcessor
+	portfolios map[string]*domain.Portfolio
+	count      int
+	// ids are the operations processed with an id, so a re-submission is not processed again
+	ids map[string]OperationRecord
+	// trades are the buys and sells in effect, in order, replayed when one of them is corrected
+	trades []trade
+	// checkpoints are snapshots of the portfolios between trades, in order, to replay from
+	checkpoints []checkpoint
+	// replaying is set while Replay rebuilds the session, whose events were already dispatched
+	replaying bool
+}
+
+// trade is a buy or sell of the session with its current result
+type trade struct {
+	sequence  int
+	operation Operation
+	tax       domain.Tax
+}
+
+// NewSession starts with empty portfolios
+func (op *OperationProcessor) NewSession() *Session {
+	return &Session{
+		processor:  op,
+		portfolios: make(map[string]*domain.Portfolio),
+		ids:        make(map[string]OperationRecord),
+	}
+}
+
+// Replay rebuilds a session from an operation log, oldest first. It stops with the error of ctx when it is done
+func (op *OperationProcessor) Replay(ctx context.Context, log []OperationRecord) (*Session, error) {
+	session := op.NewSession()
+	session.replaying = true
+	for _, record := range log {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, _, err := session.apply(ctx, record.Operation); err != nil {
+			return nil, fmt.Errorf("replaying operation %d: %w", record.Sequence, err)
+		}
+	}
+	session.replaying = false
+	return session, nil
+}
+
+// Process returns the tax of the next operation. A rejected operation returns an *OperationError
+// and leaves the portfolios unchanged, so the session can go on. An operation with the id of an
+// earlier one is not processed again: its current result is returned, as recomputed by any later
+// correction and zero once it was cancelled, or a *ConflictError when the operations differ. A cancel
+// or amend recomputes every later operation and returns the differences in their taxes as its
+// Adjustments. A trade dated before trades already processed is placed in date order, recomputing
+// the later ones the same way. When ctx is done the operation is not processed and the error of ctx
+// is returned
+func (s *Session) Process(ctx context.Context, operation Operation) (domain.Tax, error) {
+	record, err := s.Record(ctx, operation)
+	if err != nil {
+		return domain.Tax{}, err
+	}
+	return s.processor.results([]OperationRecord{record})[0], nil
+}
+
+// Record is Process returning the record of the operation, with its result always explained
+func (s *Session) Record(ctx context.Context, operation Operation) (OperationRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return OperationRecord{}, err
+	}
+	record, _, err := s.apply(ctx, operation)
+	return record, err
+}
+
+// apply processes operation and returns its record, always explained. For a re-submitted id
+// it returns the original record with the current result of the trade and duplicate is set
+func (s *Session) apply(ctx context.Context, operation Operation) (record OperationRecord, duplicate bool, err error) {
+	if operation.ID != "" {
+		if original, ok := s.ids[operation.ID]; ok {
+			if original.Operation != operation {
+				return OperationRecord{}, false, &OperationError{
+					Operation: s.count + 1,
+					Err:       &ConflictError{ID: operation.ID, Original: original.Operation},
+				}
+			}
+			return s.current(original), true, nil
+		}
+	}
+
+	index := s.count + 1
+	var result domain.Tax
+	ticker := operation.Ticker
+
+	if isCorrection(operation.Type) {
+		if result, ticker, err = s.correct(ctx, operation); err != nil {
+			if ctx.Err() != nil {
+				return OperationRecord{}, false, err
+			}
+			return OperationRecord{}, false, &OperationError{Operation: index, Err: err}
+		}
+		if !s.replaying {
+			s.processor.dispatch(index, operation, ticker, []domain.Event{domain.TradeCorrected{
+				Correction:  operation.Type,
+				Ref:         operation.Ref,
+				Adjustments: result.Adjustments,
+			}})
+		}
+	} else if position := datedPosition(s.trades, len(s.trades), operation.Date); position < len(s.trades) {
+		var events []domain.Event
+		if result, events, err = s.insert(ctx, index, operation, position); err != nil {
+			if ctx.Err() != nil {
+				return OperationRecord{}, false, err
+			}
+			return OperationRecord{}, false, &OperationError{Operation: index, Err: err}
+		}
+		if !s.replaying {
+			s.processor.dispatch(index, operation, ticker, events)
+			if len(result.Adjustments) > 0 {
+				s.processor.dispatch(index, operation, ticker, []domain.Event{domain.TradeCorrected{
+					Correction:  "insert",
+					Ref:         operation.ID,
+					Adjustments: result.Adjustments,
+				}})
+			}
+		}
+	} else {
+		due := s.processor.checkpointDue(s.trades, position, operation)
+		var before checkpoint
+		if due {
+			before = snapshot(s.portfolios, position)
+		}
+		var events []domain.Event
+		if result, events, err = s.processor.execute(s.portfolios, index, operation); err != nil {
+			return OperationRecord{}, false, &OperationError{Operation: index, Err: err}
+		}
+		if !s.replaying {
+			s.processor.dispatch(index, operation, ticker, events)
+		}
+		if due {
+			s.checkpoints = append(s.checkpoints, before)
+		}
+		s.trades = append(s.trades, trade{sequence: index, operation: operation, tax: result})
+	}
+
+	s.count = index
+	record = OperationRecord{
+		Sequence:  index,
+		Operation: operation,
+		Tax:       result,
+		Portfolio: s.processor.portfolioOf(s.portfolios, ticker).State(),
+	}
+	if operation.ID != "" {
+		s.ids[operation.ID] = record
+	}
+	return record, false, nil
+}
+
+// current is the record of a trade processed earlier with its result as it is now, after any correction
+// or back-dated trade recomputed it. A cancelled trade no longer has a tax
+func (s *Session) current(record OperationRecord) OperationRecord {
+	if isCorrection(record.Operation.Type) {
+		return record
+	}
+	for _, trade := range s.trades {
+		if trade.sequence == record.Sequence {
+			record.Tax = trade.tax
+			return record
+		}
+	}
+	record.Tax = domain.Tax{}
+	return record
+}
+
+// correct cancels or amends the trade with id correction.Ref and replays the trades from the nearest
+// checkpoint before it. An amend that changes the date of the trade moves it to its new place in date
+// order. It returns the adjustments of every trade whose tax changed and the ticker of the corrected
+// trade. The session is only changed when every trade is still valid and ctx is not done before the
+// replay ends
+func (s *Session) correct(ctx context.Context, correction Operation) (domain.Tax, string, error) {
+	position := -1
+	for i, trade := range s.trades {
+		if correction.Ref != "" && trade.operation.ID == correction.Ref {
+			position = i
+			break
+		}
+	}
+	if position < 0 {
+		return domain.Tax{}, "", fmt.Errorf("%w %q", ErrUnknownReference, correction.Ref)
+	}
+
+	trades := append([]trade(nil), s.trades...)
+	corrected := trades[position]
+	trades = append(trades[:position], trades[position+1:]...)
+	changed := position
+	if correction.Type == "amend" {
+		corrected.operation.UnitCost = correction.UnitCost
+		corrected.operation.Quantity = correction.Quantity
+		corrected.operation.Fees = correction.Fees
+		if correction.Ticker != "" {
+			corrected.operation.Ticker = correction.Ticker
+		}
+		if correction.Date != "" {
+			corrected.operation.Date = correction.Date
+		}
+		moved := datedPosition(trades, position, corrected.operation.Date)
+		trades = append(trades[:moved], append([]trade{corrected}, trades[moved:]...)...)
+		changed = min(position, moved)
+	}
+
+	s.processor.logger().Debug("replaying trades", "correction", correction.Type, "ref", correction.Ref, "from", changed+1)
+	adjustments, _, err := s.recompute(ctx, trades, changed, 0)
+	if err != nil {
+		if ctx.Err() != nil {
+			return domain.Tax{}, "", err
+		}
+		return domain.Tax{}, "", fmt.Errorf("%s of %q: %w", correction.Type, correction.Ref, err)
+	}
+	return domain.Tax{Adjustments: adjustments}, corrected.operation.Ticker, nil
+}
+
+// insert places a back-dated trade, numbered index, at position and replays the trades from the
+// nearest checkpoint before it. It returns the result of the trade, with the adjustments of the later
+// trades whose tax changed, and the events it raised
+func (s *Session) insert(ctx context.Context, index int, operation Operation, position int) (domain.Tax, []domain.Event, error) {
+	trades := append([]trade(nil), s.trades[:position]...)
+	trades = append(trades, trade{sequence: index, operation: operation})
+	trades = append(trades, s.trades[position:]...)
+
+	s.processor.logger().Debug("replaying trades", "inserted", index, "date", operation.Date, "from", position+1)
+	adjustments, events, err := s.recompute(ctx, trades, position, index)
+	if err != nil {
+		return domain.Tax{}, nil, err
+	}
+	result := s.trades[position].tax
+	result.Adjustments = adjustments
+	return result, events, nil
+}
+
+// recompute replaces the trades of the session with trades, which differ from them from position on,
+// replaying them from the nearest checkpoint before it. It returns the adjustments of every earlier trade
+// whose tax changed and the events of the trade numbered inserted, a trade that is new to the session.
+// The session is only changed when every trade is still valid and ctx is not done before the replay ends
+func (s *Session) recompute(ctx context.Context, trades []trade, position int, inserted int) ([]domain.Adjustment, []domain.Event, error) {
+	// the trades before the nearest checkpoint are not affected by the change
+	start := s.checkpointBefore(position)
+	from := checkpoint{}
+	if start > 0 {
+		from = s.checkpoints[start-1]
+	}
+	portfolios, err := from.restore(s.portfolios, s.processor.configure)
+	if err != nil {
+		return nil, nil, err
+	}
+	checkpoints := append([]checkpoint(nil), s.checkpoints[:start]...)
+
+	var events []domain.Event
+	after := make(map[int]float64, len(trades)-from.position)
+	for i := from.position; i < len(trades); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if i > from.position && s.processor.checkpointDue(trades, i, trades[i].operation) {
+			checkpoints = append(checkpoints, snapshot(portfolios, i))
+		}
+		tax, raised, err := s.processor.execute(portfolios, trades[i].sequence, trades[i].operation)
+		if err != nil {
+			if trades[i].sequence == inserted {
+				return nil, nil, err
+			}
+			return nil, nil, fmt.Errorf("operation %d: %w", trades[i].sequence, err)
+		}
+		if trades[i].sequence == inserted {
+			events = raised
+		}
+		trades[i].tax = tax
+		after[trades[i].sequence] = tax.Tax
+	}
+
+	var adjustments []domain.Adjustment
+	for _, trade := range s.trades[from.position:] {
+		before := trade.tax.Tax
+		if after[trade.sequence] != before {
+			adjustments = append(adjustments, domain.Adjustment{
+				Operation:  trade.sequence,
+				ID:         trade.operation.ID,
+				Before:     before,
+				After:      after[trade.sequence],
+				Difference: helpers.ToFixedDecimal(after[trade.sequence]-before, s.processor.policyOf(trade.operation.Ticker).Precision),
+			})
+		}
+	}
+
+	s.trades = trades
+	s.portfolios = portfolios
+	s.checkpoints = checkpoints
+	return adjustments, events, nil
+}
+
+// datedPosition returns where a trade dated date goes in trades, starting from position: after the trades
+// dated up to date and before the later ones. Undated trades keep their place, so a trade is not moved
+// past them, and an undated trade stays at position
+func datedPosition(trades []trade, position int, date string) int {
+	if date == "" {
+		return position
+	}
+	for position > 0 && trades[position-1].operation.Date > date {
+		position--
+	}
+	for position < len(trades) && trades[position].operation.Date != "" && trades[position].operation.Date <= date {
+		position++
+	}
+	return position
+}
+
+// execute validates an operation and processes it with the handler of its type against the portfolio
+// of its ticker, index being its position in the session. It returns the events the portfolio recorded
+func (op *OperationProcessor) execute(portfolios map[string]*domain.Portfolio, index int, operation Operation) (domain.Tax, []domain.Event, error) {
+	handler, ok := LookupHandler(operation.Type)
+	if !ok {
+		return domain.Tax{}, nil, &UnknownOperationError{Type: operation.Type}
+	}
+	if err := handler.Validate(operation); err != nil {
+		return domain.Tax{}, nil, err
+	}
+
+	op.logger().Debug("processing operation", "operation", index, "type", operation.Type, "ticker", operation.Ticker,
+		"quantity", operation.Quantity, "unit-cost", operation.UnitCost, "fees", operation.Fees)
+	portfolio := op.portfolioOf(portfolios, operation.Ticker)
+	origin := domain.Origin{Operation: index, Ticker: operation.Ticker, Date: operation.Date}
+	result, err := handler.Handle(portfolio, origin, operation)
+	if err != nil {
+		op.logger().Debug("operation rejected", "operation", index, "err", err)
+	} else {
+		op.logger().Debug("operation processed", "operation", index, "tax", result.Tax)
+	}
+	return result, portfolio.PullEvents(), err
+}
+
+// portfolioOf returns the portfolio of ticker, creating it when it has none yet
+func (op *OperationProcessor) portfolioOf(portfolios map[string]*domain.Portfolio, ticker string) *domain.Portfolio {
+	portfolio, ok := portfolios[ticker]
+	if !ok {
+		portfolio = &domain.Portfolio{}
+		op.configure(portfolios, ticker, portfolio)
+		portfolios[ticker] = portfolio
+	}
+	return portfolio
+}
+
+// configure gives the portfolio of ticker its policy, a logger that adds the ticker to its traces and
+// the accumulated loss of the portfolios of its loss group, when portfolios has one
+func (op *OperationProcessor) configure(portfolios map[string]*domain.Portfolio, ticker string, portfolio *domain.Portfolio) {
+	portfolio.SetPolicy(op.policyOf(ticker))
+	portfolio.SetLogger(op.logger().With("ticker", ticker))
+
+	group := op.lossGroupOf(ticker)
+	for other, peer := range portfolios {
+		if peer != portfolio && op.lossGroupOf(other) == group {
+			portfolio.SetLosses(peer.Losses())
+			return
+		}
+	}
+}
+
+// Ledgers returns the loss ledger of every loss group that had a loss, sorted by group
+func (s *Session) Ledgers() []LossLedger {
+	groups := make(map[string]bool)
+	var ledgers []LossLedger
+	for ticker, portfolio := range s.portfolios {
+		group := s.processor.lossGroupOf(ticker)
+		if groups[group] {
+			continue
+		}
+		groups[group] = true
+		if entries := portfolio.LossLedger(); len(entries) > 0 {
+			ledgers = append(ledgers, LossLedger{Group: group, Entries: entries})
+		}
+	}
+	sort.Slice(ledgers, func(i, j int) bool { return ledgers[i].Group < ledgers[j].Group })
+	return ledgers
+}
+
+// Account returns the state of the session as the account id
+func (s *Session) Account(id string) Account {
+	account := NewAccount(id)
+	account.Operations = s.count
+	for ticker, portfolio := range s.portfolios {
+		account.Portfolios[ticker] = portfolio.State()
+	}
+	return account
+}
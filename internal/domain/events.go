@@ -0,0 +1,106 @@
+package domain
+
+// Event is something that happened to a portfolio, see Portfolio.PullEvents
+type Event interface {
+	EventType() string
+}
+
+// EventType of each event
+const (
+	EventSharesBought     = "SharesBought"
+	EventSharesSold       = "SharesSold"
+	EventLossAccumulated  = "LossAccumulated"
+	EventLossConsumed     = "LossConsumed"
+	EventExemptionApplied = "ExemptionApplied"
+	EventTaxAssessed      = "TaxAssessed"
+	EventTradeCorrected   = "TradeCorrected"
+)
+
+// SharesBought is a buy added to the position
+type SharesBought struct {
+	Origin
+	Quantity          int     `json:"quantity"`
+	UnitCost          float64 `json:"unit-cost"`
+	Fees              float64 `json:"fees"`
+	AverageCostBefore float64 `json:"average-cost-before"`
+	AverageCostAfter  float64 `json:"average-cost-after"`
+	TotalShares       int     `json:"total-shares"` // after the buy
+}
+
+// SharesSold is a sale taken from the position
+type SharesSold struct {
+	Origin
+	Quantity    int     `json:"quantity"`
+	UnitCost    float64 `json:"unit-cost"`
+	Fees        float64 `json:"fees"`
+	SaleValue   float64 `json:"sale-value"`
+	AverageCost float64 `json:"average-cost"` // of the shares sold
+	GrossProfit float64 `json:"gross-profit"` // negative for a loss
+	TotalShares int     `json:"total-shares"` // left after the sale
+}
+
+// LossAccumulated is the loss of a sale carried forward to future profits
+type LossAccumulated struct {
+	Origin
+	Amount  float64 `json:"amount"`
+	Balance float64 `json:"balance"` // accumulated loss after the sale
+}
+
+// LossConsumed is accumulated loss deducted from the profit of a sale
+type LossConsumed struct {
+	Origin
+	Amount  float64      `json:"amount"`
+	Balance float64      `json:"balance"`           // accumulated loss after the sale
+	Sources []LossSource `json:"sources,omitempty"` // the ledger entries it was taken from, oldest first
+}
+
+// LossSource is the part of a LossConsumed taken from the loss of an earlier sale
+type LossSource struct {
+	Origin         // the sale that added the loss
+	Amount float64 `json:"amount"`
+}
+
+// ExemptionApplied is a sale not taxed because its value is not over the exemption threshold of the policy
+type ExemptionApplied struct {
+	Origin
+	SaleValue   float64 `json:"sale-value"`
+	Threshold   float64 `json:"threshold"`
+	GrossProfit float64 `json:"gross-profit"`
+}
+
+// TaxAssessed is the tax of a sale, zero when it is not taxed
+type TaxAssessed struct {
+	Origin
+	Tax         float64 `json:"tax"`
+	TaxableBase float64 `json:"taxable-base"`
+	Rate        float64 `json:"rate"`
+	Reason      string  `json:"reason"`
+}
+
+// TradeCorrected is a cancel or amend of an earlier trade, or a back-dated trade inserted before later
+// ones, after which the later trades were recomputed. It is raised by the session instead of the
+// portfolio, since the correction replays its trades
+type TradeCorrected struct {
+	Correction  string       `json:"correction"` // cancel, amend or insert
+	Ref         string       `json:"ref"`        // id of the trade corrected or inserted
+	Adjustments []Adjustment `json:"adjustments,omitempty"`
+}
+
+func (SharesBought) EventType() string     { return EventSharesBought }
+func (SharesSold) EventType() string       { return EventSharesSold }
+func (LossAccumulated) EventType() string  { return EventLossAccumulated }
+func (LossConsumed) EventType() string     { return EventLossConsumed }
+func (ExemptionApplied) EventType() string { return EventExemptionApplied }
+func (TaxAssessed) EventType() string      { return EventTaxAssessed }
+func (TradeCorrected) EventType() string   { return EventTradeCorrected }
+
+// PullEvents returns the events recorded since the last call, oldest first, and forgets them
+func (p *Portfolio) PullEvents() []Event {
+	events := p.events
+	p.events = nil
+	return events
+}
+
+func (p *Portfolio) record(event Event) {
+	p.events = append(p.events, event)
+}
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPortfolio_EventsOfExemptLoss(t *testing.T) {
+	p := Portfolio{}
+	p.Buy(10000, 20.00)
+	origin := Origin{Operation: 2, Date: "2024-01-10"}
+
+	p.PullEvents()
+	p.SellAt(origin, 1000, 10.00, 0) // loss 10k, exempt
+
+	expected := []Event{
+		SharesSold{Origin: origin, Quantity: 1000, UnitCost: 10.00, SaleValue: 10000.00, AverageCost: 20.00, GrossProfit: -10000.00, TotalShares: 9000},
+		ExemptionApplied{Origin: origin, SaleValue: 10000.00, Threshold: MAX_SALE_VALUE, GrossProfit: -10000.00},
+		LossAccumulated{Origin: origin, Amount: 10000.00, Balance: 10000.00},
+		TaxAssessed{Origin: origin, Reason: ReasonExemptUnderThreshold},
+	}
+	if events := p.PullEvents(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected events %+v, got %+v", expected, events)
+	}
+}
+
+func TestPortfolio_EventsOfTaxedProfitUsingLoss(t *testing.T) {
+	p := Portfolio{}
+	p.Buy(10000, 20.00)
+	p.SellAt(Origin{Operation: 2}, 1000, 10.00, 0) // loss 10k
+	p.SellAt(Origin{Operation: 3}, 2000, 15.00, 0) // loss 10k
+	origin := Origin{Operation: 4}
+
+	p.PullEvents()
+	p.SellAt(origin, 5000, 25.00, 0) // profit 25k, uses 20k, tax on 5k
+
+	expected := []Event{
+		SharesSold{Origin: origin, Quantity: 5000, UnitCost: 25.00, SaleValue: 125000.00, AverageCost: 20.00, GrossProfit: 25000.00, TotalShares: 2000},
+		LossConsumed{Origin: origin, Amount: 20000.00, Sources: []LossSource{
+			{Origin: Origin{Operation: 2}, Amount: 10000.00},
+			{Origin: Origin{Operation: 3}, Amount: 10000.00},
+		}},
+		TaxAssessed{Origin: origin, Tax: 1000.00, TaxableBase: 5000.00, Rate: TAX_RATE, Reason: ReasonTaxedProfit},
+	}
+	if events := p.PullEvents(); !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected events %+v, got %+v", expected, events)
+	}
+}
+
+func TestPortfolio_EventsOfBuy(t *testing.T) {
+	p := Portfolio{}
+	p.Buy(100, 10.00)
+
+	p.PullEvents()
+	p.BuyWithFees(100, 20.00, 10.00)
+	_, err := p.Sell(500, 10.00)
+
+	expected := []Event{
+		SharesBought{Quantity: 100, UnitCost: 20.00, Fees: 10.00, AverageCostBefore: 10.00, AverageCostAfter: 15.05, TotalShares: 200},
+	}
+	// the rejected sale records nothing
+	if events := p.PullEvents(); err == nil || !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected events %+v, got %+v", expected, events)
+	}
+	if events := p.PullEvents(); events != nil {
+		t.Errorf("Expected the pulled events to be forgotten, got %+v", events)
+	}
+}
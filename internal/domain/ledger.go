@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"math"
+)
+
+// Origin identifies the operation that changed the portfolio, for the loss ledger
+type Origin struct {
+	Operation int    `json:"operation"`        // 1-based position of the operation in its batch
+	Ticker    string `json:"ticker,omitempty"` // empty for operations without a ticker
+	Date      string `json:"date,omitempty"`   // trade date, empty when the input has none
+}
+
+// Losses is the ledger of the accumulated loss, whose balance is what remains of its entries. Portfolios
+// that share the same Losses offset the profits of each with the losses of all, e.g. the stocks of an investor
+type Losses struct {
+	ledger []LossEntry
+	// total is what remains of the entries, kept by add and consume so it is not summed on every sale
+	total float64
+	// start is the first entry with loss remaining, the ones before it are used up
+	start int
+}
+
+// newLosses returns the losses of ledger, summing what remains of its entries
+func newLosses(ledger []LossEntry) *Losses {
+	losses := &Losses{ledger: ledger}
+	for _, entry := range ledger {
+		losses.total += entry.Remaining
+	}
+	losses.skipUsed()
+	return losses
+}
+
+// balance is the loss not used yet
+func (l *Losses) balance() float64 {
+	return l.total
+}
+
+func (l *Losses) skipUsed() {
+	for l.start < len(l.ledger) && l.ledger[l.start].Remaining <= 0 {
+		l.start++
+	}
+}
+
+// Losses returns the accumulated loss of the portfolio, to share it with others with SetLosses
+func (p *Portfolio) Losses() *Losses {
+	if p.losses == nil {
+		p.losses = &Losses{}
+	}
+	return p.losses
+}
+
+// SetLosses makes the portfolio offset its profits with, and add its losses to, losses
+func (p *Portfolio) SetLosses(losses *Losses) {
+	p.losses = losses
+}
+
+func (p *Portfolio) accumulatedLoss() float64 {
+	return p.Policy().round(p.Losses().balance())
+}
+
+// LossEntry is a loss carried forward, from the sale that produced it to the gains that used it up
+type LossEntry struct {
+	Origin
+	Amount       float64           `json:"amount"`
+	Remaining    float64           `json:"remaining"`
+	Consumptions []LossConsumption `json:"consumptions,omitempty"`
+}
+
+// LossConsumption is the part of a LossEntry deducted from the profit of a later sale
+type LossConsumption struct {
+	Origin
+	Amount float64 `json:"amount"`
+}
+
+// LossLedger returns the losses accumulated by the portfolio, oldest first, including those of
+// the portfolios it shares its Losses with
+func (p *Portfolio) LossLedger() []LossEntry {
+	return copyLedger(p.Losses().ledger)
+}
+
+func copyLedger(ledger []LossEntry) []LossEntry {
+	copied := make([]LossEntry, len(ledger))
+	for i, entry := range ledger {
+		entry.Consumptions = append([]LossConsumption(nil), entry.Consumptions...)
+		copied[i] = entry
+	}
+	return copied
+}
+
+// add records the loss of a sale as a new entry of the ledger
+func (l *Losses) add(origin Origin, amount float64, policy Policy) {
+	if amount > 0 {
+		l.ledger = append(l.ledger, LossEntry{Origin: origin, Amount: amount, Remaining: amount})
+		l.total = policy.round(l.total + amount)
+	}
+}
+
+// consume deducts the used loss from the oldest entries, rounding what remains with policy, and
+// returns what it took from each
+func (l *Losses) consume(origin Origin, used float64, policy Policy) []LossSource {
+	var sources []LossSource
+
+	for i := l.start; i < len(l.ledger) && used > 0; i++ {
+		entry := &l.ledger[i]
+		if entry.Remaining <= 0 {
+			continue
+		}
+
+		amount := math.Min(entry.Remaining, used)
+		entry.Remaining = policy.round(entry.Remaining - amount)
+		entry.Consumptions = append(entry.Consumptions, LossConsumption{Origin: origin, Amount: amount})
+		sources = append(sources, LossSource{Origin: entry.Origin, Amount: amount})
+		used = policy.round(used - amount)
+		l.total = policy.round(l.total - amount)
+	}
+	l.skipUsed()
+	return sources
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLossLedger_ConsumedInOrder(t *testing.T) {
+	p := Portfolio{}
+	p.Buy(10000, 20.00)
+
+	p.SellAt(Origin{Operation: 2, Date: "2024-01-10"}, 1000, 10.00, 0) // loss 10k, exempt
+	p.SellAt(Origin{Operation: 3, Date: "2024-01-20"}, 2000, 15.00, 0) // loss 10k, taxable
+	p.Buy(10000, 10.00)                                                // WAC 14.12
+	p.SellAt(Origin{Operation: 5, Date: "2024-02-05"}, 5000, 17.12, 0) // profit 15k, uses 10k + 5k
+
+	expected := []LossEntry{
+		{
+			Origin:    Origin{Operation: 2, Date: "2024-01-10"},
+			Amount:    10000.00,
+			Remaining: 0.00,
+			Consumptions: []LossConsumption{
+				{Origin: Origin{Operation: 5, Date: "2024-02-05"}, Amount: 10000.00},
+			},
+		},
+		{
+			Origin:    Origin{Operation: 3, Date: "2024-01-20"},
+			Amount:    10000.00,
+			Remaining: 5000.00,
+			Consumptions: []LossConsumption{
+				{Origin: Origin{Operation: 5, Date: "2024-02-05"}, Amount: 5000.00},
+			},
+		},
+	}
+
+	if ledger := p.LossLedger(); !reflect.DeepEqual(ledger, expected) {
+		t.Errorf("Expected ledger %+v, got %+v", expected, ledger)
+	}
+	if !floatsAlmostEqual(p.accumulatedLoss(), 5000.00) {
+		t.Errorf("Expected accumulated loss 5000, got %f", p.accumulatedLoss())
+	}
+	if start := p.Losses().start; start != 1 {
+		t.Errorf("Expected the used up entry to be skipped, got start %d", start)
+	}
+}
+
+// openingLoss is an accumulated loss brought from before the portfolio, with no sale as its origin
+func openingLoss(amount float64) *Losses {
+	return newLosses([]LossEntry{{Amount: amount, Remaining: amount}})
+}
+
+func TestLossLedger_OpeningBalance(t *testing.T) {
+	p := Portfolio{losses: openingLoss(1000.0)}
+	p.Buy(100, 10.00)
+
+	p.SellAt(Origin{Operation: 2}, 100, 15.00, 0) // profit 500 uses the opening balance
+
+	expected := []LossEntry{
+		{Amount: 1000.00, Remaining: 500.00, Consumptions: []LossConsumption{{Origin: Origin{Operation: 2}, Amount: 500.00}}},
+	}
+	if ledger := p.LossLedger(); !reflect.DeepEqual(ledger, expected) {
+		t.Errorf("Expected ledger %+v, got %+v", expected, ledger)
+	}
+	if !floatsAlmostEqual(p.accumulatedLoss(), 500.00) {
+		t.Errorf("Expected accumulated loss 500, got %f", p.accumulatedLoss())
+	}
+}
+
+func TestLossLedger_SharedLosses(t *testing.T) {
+	petr, vale := Portfolio{}, Portfolio{}
+	vale.SetLosses(petr.Losses())
+	petr.Buy(10000, 10.00)
+	vale.Buy(10000, 20.00)
+
+	vale.SellAt(Origin{Operation: 3, Ticker: "VALE3"}, 5000, 10.00, 0)              // loss 50k
+	result, _ := petr.SellAt(Origin{Operation: 4, Ticker: "PETR4"}, 5000, 20.00, 0) // profit 50k offset by the VALE3 loss
+
+	if result.Tax != 0 || !floatsAlmostEqual(petr.accumulatedLoss(), 0) {
+		t.Errorf("Expected the VALE3 loss to offset the PETR4 profit, got tax %f and loss %f", result.Tax, petr.accumulatedLoss())
+	}
+	if ledger := vale.LossLedger(); len(ledger) != 1 || ledger[0].Consumptions[0].Ticker != "PETR4" {
+		t.Errorf("Expected the shared ledger to record the PETR4 sale, got %+v", ledger)
+	}
+}
@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SetLogger sets where the portfolio traces the steps of its calculations, at debug level
+func (p *Portfolio) SetLogger(logger *slog.Logger) {
+	p.logger = logger
+}
+
+// debug traces a calculation step, to slog.Default until SetLogger is called
+func (p *Portfolio) debug(msg string, args ...any) {
+	logger := p.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		logger.Debug(msg, args...)
+	}
+}
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestPortfolio_SetLogger_TracesCalculationSteps(t *testing.T) {
+	var logs bytes.Buffer
+	p := Portfolio{}
+	p.SetLogger(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	p.Buy(10000, 10.00)
+	if _, err := p.Sell(5000, 20.00); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var messages []string
+	var assessed map[string]any
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var record map[string]any
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("Expected a JSON log record, got %v", err)
+		}
+		messages = append(messages, record["msg"].(string))
+		if record["msg"] == "tax assessed" {
+			assessed = record
+		}
+	}
+	if len(messages) != 3 || messages[0] != "buy" || messages[1] != "sell" || messages[2] != "tax assessed" {
+		t.Fatalf("Expected the buy, sell and tax assessed steps, got %v", messages)
+	}
+	if assessed["net-profit"] != 50000.0 || assessed["tax"] != 10000.0 || assessed["reason"] != ReasonTaxedProfit {
+		t.Errorf("Expected a tax of 10000 on a net profit of 50000, got %v", assessed)
+	}
+}
+
+func TestPortfolio_SetLogger_NoTracesAboveDebug(t *testing.T) {
+	var logs bytes.Buffer
+	p := Portfolio{}
+	p.SetLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	p.Buy(100, 10.00)
+	if _, err := p.Sell(50, 15.00); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if logs.Len() != 0 {
+		t.Errorf("Expected no logs at info level, got %q", logs.String())
+	}
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "github.com/andreposman/capital-gains/pkg/helpers"
+
+// Policy is the tax rules a portfolio applies to its sales
+type Policy struct {
+	ExemptionThreshold float64 // sales whose value is not over it are not taxed
+	Rate               float64 // applied to the profit left after the accumulated losses
+	Precision          int     // decimal places average costs, values and taxes are rounded to
+}
+
+// DefaultPolicy is the rule for stocks: sales up to MAX_SALE_VALUE are exempt, profits pay TAX_RATE, in cents
+var DefaultPolicy = Policy{ExemptionThreshold: MAX_SALE_VALUE, Rate: TAX_RATE, Precision: 2}
+
+func (p Policy) round(value float64) float64 {
+	return helpers.ToFixedDecimal(value, p.Precision)
+}
+
+// SetPolicy changes the rules the portfolio applies from its next operation on
+func (p *Portfolio) SetPolicy(policy Policy) {
+	p.policy = &policy
+}
+
+// Policy returns the rules of the portfolio, DefaultPolicy until SetPolicy is called
+func (p *Portfolio) Policy() Policy {
+	if p.policy == nil {
+		return DefaultPolicy
+	}
+	return *p.policy
+}
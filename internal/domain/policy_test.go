@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestPortfolio_DefaultPolicy(t *testing.T) {
+	p := Portfolio{}
+	if p.Policy() != DefaultPolicy {
+		t.Errorf("Expected the default policy, got %+v", p.Policy())
+	}
+}
+
+func TestPortfolio_PolicyWithoutExemption(t *testing.T) {
+	p := Portfolio{}
+	p.SetPolicy(Policy{ExemptionThreshold: 0, Rate: 0.15, Precision: 2})
+	p.Buy(100, 10.00)
+
+	result, err := p.ExplainSell(100, 15.00, 0) // profit 500, under the default threshold
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !floatsAlmostEqual(result.Tax, 75.0) || result.Explanation.Reason != ReasonTaxedProfit {
+		t.Errorf("Expected tax 75 on a taxed profit, got %+v", result)
+	}
+}
+
+func TestPortfolio_PolicyPrecision(t *testing.T) {
+	p := Portfolio{}
+	p.SetPolicy(Policy{ExemptionThreshold: MAX_SALE_VALUE, Rate: TAX_RATE, Precision: 4})
+	p.Buy(3, 10.00)
+	p.Buy(1, 10.01)
+
+	if state := p.State(); !floatsAlmostEqual(state.AverageCost, 10.0025) {
+		t.Errorf("Expected average cost 10.0025, got %f", state.AverageCost)
+	}
+}
@@ -1,40 +1,108 @@
 package domain
 
 import (
+	"errors"
 	"fmt"
-	"github.com/andreposman/capital-gains/pkg/helpers"
+	"log/slog"
+	"math"
 )
 
+// ErrInsufficientShares is returned when a sale has more shares than the portfolio
+var ErrInsufficientShares = errors.New("insufficient shares")
+
+// ErrLedgerMismatch is returned when a saved accumulated loss does not match its loss ledger
+var ErrLedgerMismatch = errors.New("loss ledger mismatch")
+
+// ledgerTolerance absorbs the float error of summing the entries of a ledger
+const ledgerTolerance = 1e-6
+
 type Portfolio struct {
-	totalShares     int
-	accumulatedLoss float64
-	averageCost     float64
+	totalShares int
+	averageCost float64
+	losses      *Losses // may be shared with other portfolios, see SetLosses
+	events      []Event // not yet pulled, see PullEvents
+	policy      *Policy // nil for DefaultPolicy
+	logger      *slog.Logger
 }
 
 func (p *Portfolio) Buy(shareQuantity int, shareCost float64) {
+	p.BuyWithFees(shareQuantity, shareCost, 0)
+}
+
+// BuyWithFees is Buy with the brokerage fees added to the acquisition cost of the shares
+func (p *Portfolio) BuyWithFees(shareQuantity int, shareCost, fees float64) {
+	p.ExplainBuy(Origin{}, shareQuantity, shareCost, fees)
+}
+
+// ExplainBuy is BuyWithFees returning the result with its Explanation, origin being the buy in its session
+func (p *Portfolio) ExplainBuy(origin Origin, shareQuantity int, shareCost, fees float64) Tax {
+	averageCostBefore := p.averageCost
+
 	//calculo do valor total do ativo
-	totalCost := float64(p.totalShares)*p.averageCost + float64(shareQuantity)*shareCost
+	totalCost := float64(p.totalShares)*p.averageCost + float64(shareQuantity)*shareCost + fees
 	p.totalShares += shareQuantity
 
 	if p.totalShares > 0 {
-		p.averageCost = helpers.ToFixedDecimal(totalCost/float64(p.totalShares), 2)
+		p.averageCost = p.Policy().round(totalCost / float64(p.totalShares))
 	} else {
 		p.averageCost = 0
 	}
 
-	//log.Println("Total Cost is: R$", totalCost)
+	p.debug("buy",
+		"quantity", shareQuantity, "unit-cost", shareCost, "fees", fees, "total-cost", totalCost,
+		"average-cost-before", averageCostBefore, "average-cost-after", p.averageCost, "total-shares", p.totalShares)
+
+	p.record(SharesBought{
+		Origin:            origin,
+		Quantity:          shareQuantity,
+		UnitCost:          shareCost,
+		Fees:              fees,
+		AverageCostBefore: averageCostBefore,
+		AverageCostAfter:  p.averageCost,
+		TotalShares:       p.totalShares,
+	})
+	return Tax{
+		Tax: 0.00,
+		Explanation: &Explanation{
+			AverageCostBefore: averageCostBefore,
+			AverageCostAfter:  p.averageCost,
+			Reason:            ReasonBuyNoTax,
+		},
+	}
 }
 
 // Sell updates the portfolio after a sell op and return the calculated tax and an error
 func (p *Portfolio) Sell(shareQuantity int, shareCost float64) (float64, error) {
+	return p.SellWithFees(shareQuantity, shareCost, 0)
+}
+
+// SellWithFees is Sell with the brokerage fees deducted from the profit.
+// The exemption threshold still applies to the gross sale value
+func (p *Portfolio) SellWithFees(shareQuantity int, shareCost, fees float64) (float64, error) {
+	result, err := p.ExplainSell(shareQuantity, shareCost, fees)
+	return result.Tax, err
+}
+
+// ExplainSell is SellWithFees returning the result with its Explanation
+func (p *Portfolio) ExplainSell(shareQuantity int, shareCost, fees float64) (Tax, error) {
+	return p.SellAt(Origin{}, shareQuantity, shareCost, fees)
+}
+
+// SellAt is ExplainSell recording origin in the loss ledger as the sale that added or used the loss
+func (p *Portfolio) SellAt(origin Origin, shareQuantity int, shareCost, fees float64) (Tax, error) {
 	if shareQuantity > p.totalShares {
-		return 0.00, fmt.Errorf("insufficient shares: attempt to sell %d, but only %d have", shareQuantity, p.totalShares)
+		return Tax{Tax: 0.00}, fmt.Errorf("%w: attempt to sell %d, but only %d have", ErrInsufficientShares, shareQuantity, p.totalShares)
 	}
+	averageCostBefore := p.averageCost
 
 	//calc o valor total e custo baseado no pm
-	totalSellValue := helpers.ToFixedDecimal(float64(shareQuantity)*shareCost, 2)
-	costSoldShares := helpers.ToFixedDecimal(p.averageCost*float64(shareQuantity), 2)
-	profit := totalSellValue - costSoldShares
+	policy := p.Policy()
+	totalSellValue := policy.round(float64(shareQuantity) * shareCost)
+	costSoldShares := policy.round(p.averageCost * float64(shareQuantity))
+	profit := totalSellValue - costSoldShares - fees
+	p.debug("sell",
+		"quantity", shareQuantity, "unit-cost", shareCost, "fees", fees, "sale-value", totalSellValue,
+		"average-cost", p.averageCost, "cost", costSoldShares, "profit", profit)
 
 	//update qtd de acoes
 	p.totalShares -= shareQuantity
@@ -45,7 +113,69 @@ func (p *Portfolio) Sell(shareQuantity int, shareCost float64) (float64, error)
 	}
 
 	//calculo final de taxa
-	tax := CalculateTax(p, totalSellValue, profit)
+	tax, explanation, sources := assessTax(p, origin, totalSellValue, profit)
+	explanation.AverageCostBefore = averageCostBefore
+	explanation.AverageCostAfter = p.averageCost
 
-	return tax, nil
+	p.record(SharesSold{
+		Origin:      origin,
+		Quantity:    shareQuantity,
+		UnitCost:    shareCost,
+		Fees:        fees,
+		SaleValue:   totalSellValue,
+		AverageCost: averageCostBefore,
+		GrossProfit: explanation.GrossProfit,
+		TotalShares: p.totalShares,
+	})
+	if explanation.Reason == ReasonExemptUnderThreshold {
+		p.record(ExemptionApplied{Origin: origin, SaleValue: totalSellValue, Threshold: policy.ExemptionThreshold, GrossProfit: explanation.GrossProfit})
+	}
+	if explanation.LossUsed > 0 {
+		p.record(LossConsumed{Origin: origin, Amount: explanation.LossUsed, Balance: p.accumulatedLoss(), Sources: sources})
+	}
+	if explanation.LossAdded > 0 {
+		p.record(LossAccumulated{Origin: origin, Amount: explanation.LossAdded, Balance: p.accumulatedLoss()})
+	}
+	p.record(TaxAssessed{Origin: origin, Tax: tax, TaxableBase: explanation.TaxableBase, Rate: explanation.Rate, Reason: explanation.Reason})
+
+	return Tax{Tax: tax, Explanation: &explanation}, nil
+}
+
+// PortfolioState is the saved state of a Portfolio, to resume it later
+type PortfolioState struct {
+	TotalShares     int         `json:"total-shares"`
+	AverageCost     float64     `json:"average-cost"`
+	AccumulatedLoss float64     `json:"accumulated-loss"`
+	Ledger          []LossEntry `json:"ledger,omitempty"` // only in a Snapshot
+}
+
+// State returns the position and loss balance of the portfolio, without its ledger, which grows with
+// every loss. It cannot be restored when the balance is not zero, see Snapshot
+func (p *Portfolio) State() PortfolioState {
+	return PortfolioState{
+		TotalShares:     p.totalShares,
+		AverageCost:     p.averageCost,
+		AccumulatedLoss: p.accumulatedLoss(),
+	}
+}
+
+// Snapshot is State with a copy of the loss ledger, to resume the portfolio with RestorePortfolio
+func (p *Portfolio) Snapshot() PortfolioState {
+	state := p.State()
+	state.Ledger = p.LossLedger()
+	return state
+}
+
+// RestorePortfolio resumes a portfolio from its saved state. It fails when the accumulated loss of the
+// state is not what remains of its ledger
+func RestorePortfolio(state PortfolioState) (*Portfolio, error) {
+	p := &Portfolio{
+		totalShares: state.TotalShares,
+		averageCost: state.AverageCost,
+		losses:      newLosses(copyLedger(state.Ledger)),
+	}
+	if balance := p.Losses().balance(); math.Abs(balance-state.AccumulatedLoss) > ledgerTolerance {
+		return nil, fmt.Errorf("%w: accumulated loss is %.2f, but %.2f remains of the ledger", ErrLedgerMismatch, state.AccumulatedLoss, balance)
+	}
+	return p, nil
 }
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"math"
 	"testing"
 )
@@ -61,8 +62,8 @@ func TestPortfolio_Sell_Profit_Taxable_NoLoss(t *testing.T) {
 	if p.totalShares != expectedSharesLeft {
 		t.Errorf("Expected %d shares left, got %d", expectedSharesLeft, p.totalShares)
 	}
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLoss) {
-		t.Errorf("Expected accumulated loss %f, got %f", expectedLoss, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLoss) {
+		t.Errorf("Expected accumulated loss %f, got %f", expectedLoss, p.accumulatedLoss())
 	}
 }
 
@@ -89,8 +90,8 @@ func TestPortfolio_Sell_Profit_Exempt_NoLoss(t *testing.T) {
 	if p.totalShares != expectedSharesLeft {
 		t.Errorf("Expected %d shares left, got %d", expectedSharesLeft, p.totalShares)
 	}
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLoss) {
-		t.Errorf("Expected accumulated loss %f, got %f", expectedLoss, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLoss) {
+		t.Errorf("Expected accumulated loss %f, got %f", expectedLoss, p.accumulatedLoss())
 	}
 }
 
@@ -117,8 +118,8 @@ func TestPortfolio_Sell_Loss_Taxable_NoLoss(t *testing.T) {
 	if p.totalShares != expectedSharesLeft {
 		t.Errorf("Expected %d shares left, got %d", expectedSharesLeft, p.totalShares)
 	}
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLoss) {
-		t.Errorf("Expected accumulated loss %f, got %f", expectedLoss, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLoss) {
+		t.Errorf("Expected accumulated loss %f, got %f", expectedLoss, p.accumulatedLoss())
 	}
 }
 
@@ -145,14 +146,14 @@ func TestPortfolio_Sell_Loss_Exempt_NoLoss(t *testing.T) {
 	if p.totalShares != expectedSharesLeft {
 		t.Errorf("Expected %d shares left, got %d", expectedSharesLeft, p.totalShares)
 	}
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLoss) {
-		t.Errorf("Expected accumulated loss %f, got %f", expectedLoss, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLoss) {
+		t.Errorf("Expected accumulated loss %f, got %f", expectedLoss, p.accumulatedLoss())
 	}
 }
 
 func TestPortfolio_Sell_Profit_Taxable_WithLoss_Consumed(t *testing.T) {
-	p := Portfolio{accumulatedLoss: 25000.00} // Start with loss
-	p.Buy(10000, 10.00)                       // WAC = 10.00
+	p := Portfolio{losses: openingLoss(25000.00)} // Start with loss
+	p.Buy(10000, 10.00)                           // WAC = 10.00
 
 	// Sell 5000 @ 20.00. Total Sale = 100,000 (> 20k). Gross Profit = 50,000
 	// Net Profit = 50,000 - 25,000 = 25,000
@@ -174,14 +175,14 @@ func TestPortfolio_Sell_Profit_Taxable_WithLoss_Consumed(t *testing.T) {
 	if p.totalShares != expectedSharesLeft {
 		t.Errorf("Expected %d shares left, got %d", expectedSharesLeft, p.totalShares)
 	}
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLossAfter) {
-		t.Errorf("Expected accumulated loss %f, got %f", expectedLossAfter, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLossAfter) {
+		t.Errorf("Expected accumulated loss %f, got %f", expectedLossAfter, p.accumulatedLoss())
 	}
 }
 
 func TestPortfolio_Sell_Profit_Exempt_WithLoss_Consumed(t *testing.T) {
-	p := Portfolio{accumulatedLoss: 500.00} // Start with loss
-	p.Buy(100, 10.00)                       // WAC = 10.00
+	p := Portfolio{losses: openingLoss(500.00)} // Start with loss
+	p.Buy(100, 10.00)                           // WAC = 10.00
 
 	// Sell 50 @ 25.00. Total Sale = 1250 (<= 20k). Gross Profit = 50 * (25 - 10) = 750
 	// Tax = 0 (exempt)
@@ -203,8 +204,8 @@ func TestPortfolio_Sell_Profit_Exempt_WithLoss_Consumed(t *testing.T) {
 	if p.totalShares != expectedSharesLeft {
 		t.Errorf("Expected %d shares left, got %d", expectedSharesLeft, p.totalShares)
 	}
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLossAfter) {
-		t.Errorf("Expected accumulated loss %f, got %f", expectedLossAfter, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLossAfter) {
+		t.Errorf("Expected accumulated loss %f, got %f", expectedLossAfter, p.accumulatedLoss())
 	}
 }
 
@@ -231,3 +232,55 @@ func TestPortfolio_Sell_InsufficientShares(t *testing.T) {
 		t.Errorf("Expected averageCost to remain 10.00 on error, got %f", p.averageCost)
 	}
 }
+
+func TestPortfolio_BuyWithFees_FeesAddedToAverageCost(t *testing.T) {
+	p := Portfolio{}
+	p.BuyWithFees(100, 10.00, 5.00) // (1000 + 5) / 100 = 10.05
+
+	if !floatsAlmostEqual(p.averageCost, 10.05) {
+		t.Errorf("Expected averageCost to be 10.05, got %f", p.averageCost)
+	}
+}
+
+func TestPortfolio_SellWithFees_FeesReduceProfit(t *testing.T) {
+	p := Portfolio{}
+	p.Buy(10000, 10.00) // WAC = 10.00
+
+	// Sell 5000 @ 20.00. Total Sale = 100,000 (> 20k). Profit = 50,000 - 100 fees = 49,900
+	// Tax = 49,900 * 0.20 = 9,980
+	tax, err := p.SellWithFees(5000, 20.00, 100.00)
+
+	if err != nil {
+		t.Fatalf("Sell returned unexpected error: %v", err)
+	}
+	if !floatsAlmostEqual(tax, 9980.00) {
+		t.Errorf("Expected tax 9980.00, got %f", tax)
+	}
+}
+
+func TestPortfolio_RestoreState(t *testing.T) {
+	p := Portfolio{}
+	p.Buy(10000, 20.00)
+	p.SellAt(Origin{Operation: 2}, 5000, 10.00, 0) // loss 50k
+
+	restored, err := RestorePortfolio(p.Snapshot())
+	if err != nil {
+		t.Fatalf("RestorePortfolio returned unexpected error: %v", err)
+	}
+	tax, err := restored.Sell(5000, 40.00) // profit 100k - 50k loss -> tax 10k
+
+	if err != nil || !floatsAlmostEqual(tax, 10000.00) {
+		t.Errorf("Expected tax 10000 from the restored portfolio, got %f (%v)", tax, err)
+	}
+	if len(p.LossLedger()[0].Consumptions) != 0 {
+		t.Errorf("Expected the original ledger to be untouched, got %+v", p.LossLedger())
+	}
+}
+
+func TestPortfolio_RestoreState_LossWithoutLedger(t *testing.T) {
+	state := PortfolioState{TotalShares: 100, AverageCost: 10.00, AccumulatedLoss: 500.00}
+
+	if _, err := RestorePortfolio(state); !errors.Is(err, ErrLedgerMismatch) {
+		t.Errorf("Expected ErrLedgerMismatch for a loss missing from the ledger, got %v", err)
+	}
+}
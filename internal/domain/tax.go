@@ -1,14 +1,47 @@
 package domain
 
 import (
-	"github.com/andreposman/capital-gains/pkg/helpers"
 	"math"
 )
 
 type Tax struct {
-	Tax float64 `json:"tax"`
+	Tax         float64      `json:"tax"`
+	Explanation *Explanation `json:"explanation,omitempty"`
+	Adjustments []Adjustment `json:"adjustments,omitempty"` // only for a cancel, amend or back-dated trade
 }
 
+// Adjustment is the change in the tax of an earlier operation recomputed after a cancel, amend or back-dated trade
+type Adjustment struct {
+	Operation  int     `json:"operation"` // 1-based position of the operation whose tax changed
+	ID         string  `json:"id,omitempty"`
+	Before     float64 `json:"before"`
+	After      float64 `json:"after"`
+	Difference float64 `json:"difference"` // after - before, negative when tax was overpaid
+}
+
+// Explanation is the audit trail of how the tax of an operation was reached
+type Explanation struct {
+	AverageCostBefore float64 `json:"average-cost-before"`
+	AverageCostAfter  float64 `json:"average-cost-after"`
+	SaleValue         float64 `json:"sale-value"`
+	GrossProfit       float64 `json:"gross-profit"` // negative for a loss
+	LossUsed          float64 `json:"loss-used"`
+	LossAdded         float64 `json:"loss-added"`
+	TaxableBase       float64 `json:"taxable-base"`
+	Rate              float64 `json:"rate"`
+	Reason            string  `json:"reason"`
+}
+
+// reason codes of an Explanation
+const (
+	ReasonBuyNoTax             = "BUY_NO_TAX"             // buys are never taxed
+	ReasonExemptUnderThreshold = "EXEMPT_UNDER_THRESHOLD" // sale value <= the exemption threshold of the policy
+	ReasonLossOffset           = "LOSS_OFFSET"            // the whole profit was offset by accumulated losses
+	ReasonSaleAtLoss           = "SALE_AT_LOSS"           // the loss is accumulated for future profits
+	ReasonNoProfit             = "NO_PROFIT"              // sold at the average cost
+	ReasonTaxedProfit          = "TAXED_PROFIT"
+)
+
 const (
 	MAX_SALE_VALUE = 20000.00
 	TAX_RATE       = 0.20
@@ -16,34 +49,72 @@ const (
 
 // CalculateTax determines the tax for a sell op
 func CalculateTax(p *Portfolio, totalSale, profit float64) float64 {
-	if totalSale <= MAX_SALE_VALUE {
-		// mesmo isento, afeta o valor acumulado
-		updateLoss(p, profit)
-		return 0.00
+	tax, _, _ := assessTax(p, Origin{}, totalSale, profit)
+	return tax
+}
+
+// assessTax determines the tax for a sell op and explains how it was reached. The accumulated loss
+// used or added is recorded in the loss ledger under origin; the sources of the loss used are returned
+func assessTax(p *Portfolio, origin Origin, totalSale, profit float64) (float64, Explanation, []LossSource) {
+	policy := p.Policy()
+	lossBefore := p.accumulatedLoss()
+	explanation := Explanation{
+		SaleValue:   totalSale,
+		GrossProfit: policy.round(profit),
+	}
+
+	// mesmo isento, afeta o valor acumulado
+	explanation.LossUsed, explanation.LossAdded = lossMovement(policy, lossBefore, profit)
+	sources := updateLoss(p.Losses(), origin, profit, policy)
+
+	if totalSale <= policy.ExemptionThreshold {
+		explanation.Reason = ReasonExemptUnderThreshold
+		p.debug("exempt sale",
+			"sale-value", totalSale, "threshold", policy.ExemptionThreshold, "profit", profit,
+			"accumulated-loss-before", lossBefore, "accumulated-loss-after", p.accumulatedLoss())
+		return 0.00, explanation, sources
 	}
 
 	// venda potencialmente taxavel, calculando o netProfit considerando o loss
-	netProfit := math.Max(profit-p.accumulatedLoss, 0)
+	netProfit := math.Max(profit-lossBefore, 0)
+
+	//calculando a taxa no netProfit
+	tax := policy.round(netProfit * policy.Rate)
+
+	explanation.TaxableBase = policy.round(netProfit)
+	explanation.Rate = policy.Rate
+	switch {
+	case profit < 0:
+		explanation.Reason = ReasonSaleAtLoss
+	case profit == 0:
+		explanation.Reason = ReasonNoProfit
+	case netProfit == 0:
+		explanation.Reason = ReasonLossOffset
+	default:
+		explanation.Reason = ReasonTaxedProfit
+	}
+
+	p.debug("tax assessed",
+		"sale-value", totalSale, "profit", profit, "accumulated-loss-before", lossBefore,
+		"accumulated-loss-after", p.accumulatedLoss(), "net-profit", netProfit, "rate", policy.Rate,
+		"tax", tax, "reason", explanation.Reason)
+	return tax, explanation, sources
+}
 
+// lossMovement returns how much accumulated loss a sale uses and adds
+func lossMovement(policy Policy, lossBefore, profit float64) (used, added float64) {
 	/**
 		atualizando accumlatedLoss:
 			if profit > 0, loss é consumido
 	 		if profit <= 0, loss é aumentado
 	**/
-	p.accumulatedLoss = math.Max(p.accumulatedLoss-profit, 0)
-
-	//calculando a taxa no netProfit
-	tax := helpers.ToFixedDecimal(netProfit*TAX_RATE, 2)
-
-	//log.Println("Tax is: R$", tax)
-	return tax
+	return policy.round(math.Min(math.Max(profit, 0), lossBefore)), policy.round(math.Max(-profit, 0))
 }
 
-// updateLoss adjusts the accumulated loss for exempt sales
-func updateLoss(p *Portfolio, profit float64) {
-	if profit > 0 {
-		p.accumulatedLoss = math.Max(p.accumulatedLoss-profit, 0)
-	} else {
-		p.accumulatedLoss -= profit
-	}
+// updateLoss records the movement of the accumulated loss of a sale in the ledger, a profit consuming
+// the oldest losses and a loss adding an entry. It returns the sources of the loss consumed
+func updateLoss(losses *Losses, origin Origin, profit float64, policy Policy) []LossSource {
+	used, added := lossMovement(policy, policy.round(losses.balance()), profit)
+	losses.add(origin, added, policy)
+	return losses.consume(origin, used, policy)
 }
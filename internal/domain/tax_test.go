@@ -13,31 +13,118 @@ func floatsAlmostEqual(a, b float64) bool {
 
 // Test updateLoss directly (Example - may be redundant if covered by Portfolio tests)
 func TestUpdateLoss_ExemptProfitReducesLoss(t *testing.T) {
-	p := Portfolio{accumulatedLoss: 100.0}
+	p := Portfolio{losses: openingLoss(100.0)}
 	profit := 50.0
-	updateLoss(&p, profit)
+	updateLoss(p.Losses(), Origin{}, profit, DefaultPolicy)
 	expectedLoss := 50.0
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLoss) {
-		t.Errorf("Expected accumulated loss to be %f after exempt profit, got %f", expectedLoss, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLoss) {
+		t.Errorf("Expected accumulated loss to be %f after exempt profit, got %f", expectedLoss, p.accumulatedLoss())
 	}
 }
 
 func TestUpdateLoss_ExemptProfitExceedsLoss(t *testing.T) {
-	p := Portfolio{accumulatedLoss: 100.0}
+	p := Portfolio{losses: openingLoss(100.0)}
 	profit := 150.0
-	updateLoss(&p, profit)
+	updateLoss(p.Losses(), Origin{}, profit, DefaultPolicy)
 	expectedLoss := 0.0
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLoss) {
-		t.Errorf("Expected accumulated loss to be %f after exempt profit exceeded loss, got %f", expectedLoss, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLoss) {
+		t.Errorf("Expected accumulated loss to be %f after exempt profit exceeded loss, got %f", expectedLoss, p.accumulatedLoss())
 	}
 }
 
 func TestUpdateLoss_ExemptLossIncreasesLoss(t *testing.T) {
-	p := Portfolio{accumulatedLoss: 100.0}
+	p := Portfolio{losses: openingLoss(100.0)}
 	profit := -50.0 // Represents a loss
-	updateLoss(&p, profit)
+	updateLoss(p.Losses(), Origin{}, profit, DefaultPolicy)
 	expectedLoss := 150.0
-	if !floatsAlmostEqual(p.accumulatedLoss, expectedLoss) {
-		t.Errorf("Expected accumulated loss to be %f after exempt loss, got %f", expectedLoss, p.accumulatedLoss)
+	if !floatsAlmostEqual(p.accumulatedLoss(), expectedLoss) {
+		t.Errorf("Expected accumulated loss to be %f after exempt loss, got %f", expectedLoss, p.accumulatedLoss())
+	}
+}
+
+func TestExplainSell_ExemptUnderThreshold(t *testing.T) {
+	p := Portfolio{losses: openingLoss(100.0)}
+	p.Buy(100, 10.00)
+
+	result, err := p.ExplainSell(50, 15.00, 0)
+
+	if err != nil {
+		t.Fatalf("Sell returned unexpected error: %v", err)
+	}
+	expected := Explanation{
+		AverageCostBefore: 10.00,
+		AverageCostAfter:  10.00,
+		SaleValue:         750.00,
+		GrossProfit:       250.00,
+		LossUsed:          100.00,
+		Reason:            ReasonExemptUnderThreshold,
+	}
+	if *result.Explanation != expected {
+		t.Errorf("Expected explanation %+v, got %+v", expected, *result.Explanation)
+	}
+}
+
+func TestExplainSell_LossOffset(t *testing.T) {
+	p := Portfolio{losses: openingLoss(60000.0)}
+	p.Buy(10000, 10.00)
+
+	// Sell 5000 @ 20.00. Profit 50k fully offset by the 60k loss, 10k left
+	result, _ := p.ExplainSell(5000, 20.00, 0)
+
+	expected := Explanation{
+		AverageCostBefore: 10.00,
+		AverageCostAfter:  10.00,
+		SaleValue:         100000.00,
+		GrossProfit:       50000.00,
+		LossUsed:          50000.00,
+		Rate:              TAX_RATE,
+		Reason:            ReasonLossOffset,
+	}
+	if result.Tax != 0 || *result.Explanation != expected {
+		t.Errorf("Expected tax 0 and explanation %+v, got %f and %+v", expected, result.Tax, *result.Explanation)
+	}
+}
+
+func TestExplainSell_TaxedProfitAfterPartialOffset(t *testing.T) {
+	p := Portfolio{losses: openingLoss(25000.0)}
+	p.Buy(10000, 10.00)
+
+	result, _ := p.ExplainSell(10000, 20.00, 0)
+
+	expected := Explanation{
+		AverageCostBefore: 10.00,
+		AverageCostAfter:  0.00,
+		SaleValue:         200000.00,
+		GrossProfit:       100000.00,
+		LossUsed:          25000.00,
+		TaxableBase:       75000.00,
+		Rate:              TAX_RATE,
+		Reason:            ReasonTaxedProfit,
+	}
+	if !floatsAlmostEqual(result.Tax, 15000.00) || *result.Explanation != expected {
+		t.Errorf("Expected tax 15000 and explanation %+v, got %f and %+v", expected, result.Tax, *result.Explanation)
+	}
+}
+
+func TestExplainSell_SaleAtLoss(t *testing.T) {
+	p := Portfolio{}
+	p.Buy(10000, 20.00)
+
+	result, _ := p.ExplainSell(5000, 10.00, 0)
+
+	if result.Explanation.Reason != ReasonSaleAtLoss || !floatsAlmostEqual(result.Explanation.LossAdded, 50000.00) {
+		t.Errorf("Expected reason %s with 50000 loss added, got %+v", ReasonSaleAtLoss, *result.Explanation)
+	}
+}
+
+func TestExplainBuy(t *testing.T) {
+	p := Portfolio{}
+	p.Buy(100, 10.00)
+
+	result := p.ExplainBuy(Origin{Operation: 2}, 100, 20.00, 0)
+
+	expected := Explanation{AverageCostBefore: 10.00, AverageCostAfter: 15.00, Reason: ReasonBuyNoTax}
+	if result.Tax != 0 || *result.Explanation != expected {
+		t.Errorf("Expected explanation %+v, got %+v", expected, *result.Explanation)
 	}
 }
@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	json2 "encoding/json"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"github.com/andreposman/capital-gains/internal/infra/input"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"io"
+)
+
+// Entry is a line of the hash-chained audit log. Hash covers every other field, Previous included,
+// so changing an entry breaks its own hash and removing or reordering one breaks the chain
+type Entry struct {
+	Sequence      int            `json:"sequence"`  // 1-based position of the entry in the log
+	Batch         int            `json:"batch"`     // batches are processed independently, like input lines
+	Operation     int            `json:"operation"` // 1-based position of the operation in the batch
+	Input         json.Operation `json:"input"`
+	Result        domain.Tax     `json:"result"`         // always explained
+	PortfolioHash string         `json:"portfolio-hash"` // of the portfolio of the ticker after the operation
+	Previous      string         `json:"previous"`       // hash of the previous entry, empty for the first
+	Hash          string         `json:"hash"`
+}
+
+// hash is the SHA-256 of the entry with an empty Hash
+func (e Entry) hash() string {
+	e.Hash = ""
+	content, _ := json2.Marshal(e)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// PortfolioHash is the SHA-256 of the JSON of a portfolio state
+func PortfolioHash(state domain.PortfolioState) string {
+	content, _ := json2.Marshal(state)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Chain appends entries to a hash-chained audit log, one JSON object per line
+type Chain struct {
+	w    io.Writer
+	last Entry
+}
+
+// NewChain writes the entries following last to w, the zero Entry for a new log
+func NewChain(w io.Writer, last Entry) *Chain {
+	return &Chain{w: w, last: last}
+}
+
+// WriteBatch appends an entry for the record of every operation of a batch
+func (c *Chain) WriteBatch(records []application.OperationRecord) error {
+	batch := c.last.Batch + 1
+	for i, record := range records {
+		entry := Entry{
+			Sequence:      c.last.Sequence + 1,
+			Batch:         batch,
+			Operation:     i + 1,
+			Input:         json.FromApplication(record.Operation),
+			Result:        record.Tax,
+			PortfolioHash: PortfolioHash(record.Portfolio),
+			Previous:      c.last.Hash,
+		}
+		entry.Hash = entry.hash()
+
+		line, err := json2.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := c.w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		c.last = entry
+	}
+	return nil
+}
+
+// LastEntry returns the last entry of a log to continue it, the zero Entry for an empty log
+func LastEntry(r io.Reader) (Entry, error) {
+	var last Entry
+	err := readEntries(r, func(entry Entry) error {
+		last = entry
+		return nil
+	})
+	return last, err
+}
+
+// VerifyError is the first entry of a log that was altered or does not match its replay
+type VerifyError struct {
+	Sequence int
+	Reason   string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("entry %d: %s", e.Sequence, e.Reason)
+}
+
+// Verify checks the hash chain of a log and replays every batch through a new session, confirming
+// each result and portfolio state. It returns the last entry verified, whose Sequence is the number
+// of entries verified and whose Hash pins the whole log, and a *VerifyError for the first one that
+// fails. It stops with the error of ctx when it is done
+func Verify(ctx context.Context, r io.Reader) (Entry, error) {
+	processor := application.OperationProcessor{}
+	var session *application.Session
+	var last Entry
+
+	err := readEntries(r, func(entry Entry) error {
+		fail := func(format string, args ...any) error {
+			return &VerifyError{Sequence: last.Sequence + 1, Reason: fmt.Sprintf(format, args...)}
+		}
+		switch {
+		case entry.Sequence != last.Sequence+1:
+			return fail("sequence is %d", entry.Sequence)
+		case entry.Previous != last.Hash:
+			return fail("previous hash does not match the entry before it")
+		case entry.Hash != entry.hash():
+			return fail("hash does not match the content of the entry")
+		case entry.Batch < 1:
+			return fail("batch is %d", entry.Batch)
+		case entry.Operation < 1:
+			return fail("operation is %d", entry.Operation)
+		}
+
+		position := last.Operation + 1
+		if entry.Batch != last.Batch {
+			if entry.Batch < last.Batch {
+				return fail("batch %d comes after batch %d", entry.Batch, last.Batch)
+			}
+			session = processor.NewSession()
+			position = 1
+		}
+		if entry.Operation != position {
+			return fail("operation is %d, want %d", entry.Operation, position)
+		}
+
+		record, err := session.Record(ctx, json.ToApplication([]json.Operation{entry.Input})[0])
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fail("replay rejected the operation: %v", err)
+		}
+		logged, _ := json2.Marshal(entry.Result)
+		replayed, _ := json2.Marshal(record.Tax)
+		if !bytes.Equal(logged, replayed) {
+			return fail("result %s does not match the replayed %s", logged, replayed)
+		}
+		if entry.PortfolioHash != PortfolioHash(record.Portfolio) {
+			return fail("portfolio hash does not match the replayed portfolio")
+		}
+
+		last = entry
+		return nil
+	})
+	return last, err
+}
+
+// readEntries calls fn with every entry of a log, in order
+func readEntries(r io.Reader, fn func(Entry) error) error {
+	scanner := input.NewLineScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry Entry
+		decoder := json2.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&entry); err != nil {
+			return fmt.Errorf("line %d: %w", scanner.Line(), err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	json2 "encoding/json"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/application"
+	"strings"
+	"testing"
+)
+
+// writeLog processes every batch and writes it to a new chain, returning the log
+func writeLog(t *testing.T, batches ...[]application.Operation) string {
+	t.Helper()
+	var log bytes.Buffer
+	chain := NewChain(&log, Entry{})
+	processor := application.OperationProcessor{}
+	for _, batch := range batches {
+		records, _, err := processor.ProcessRecords(context.Background(), batch)
+		if err != nil {
+			t.Fatalf("Assertion failed: ProcessRecords returned %v", err)
+		}
+		if err := chain.WriteBatch(records); err != nil {
+			t.Fatalf("Assertion failed: WriteBatch returned %v", err)
+		}
+	}
+	return log.String()
+}
+
+var chainBatches = [][]application.Operation{
+	{
+		{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{ID: "s1", Type: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"},
+		{Type: "amend", Ref: "s1", UnitCost: 15.00, Quantity: 5000},
+	},
+	{
+		{Type: "buy", UnitCost: 10.00, Quantity: 100},
+		{Type: "sell", UnitCost: 5.00, Quantity: 50},
+	},
+}
+
+func TestVerify_WrittenLog(t *testing.T) {
+	log := writeLog(t, chainBatches...)
+
+	last, err := Verify(context.Background(), strings.NewReader(log))
+
+	if err != nil || last.Sequence != 5 || !strings.HasSuffix(strings.TrimSpace(log), `"hash":"`+last.Hash+`"}`) {
+		t.Errorf("Assertion failed: Verify = %+v, %v, want the 5th and last entry", last, err)
+	}
+}
+
+func TestChain_LinksEntries(t *testing.T) {
+	log := writeLog(t, chainBatches...)
+
+	var entries []Entry
+	readEntries(strings.NewReader(log), func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+
+	if len(entries) != 5 || entries[0].Previous != "" || entries[3].Batch != 2 || entries[3].Operation != 1 {
+		t.Fatalf("Assertion failed: entries = %+v", entries)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Previous != entries[i-1].Hash {
+			t.Errorf("Assertion failed: entry %d does not link to the hash of the entry before it", i+1)
+		}
+	}
+	if entries[1].Result.Explanation == nil {
+		t.Errorf("Assertion failed: expected the results to be explained")
+	}
+}
+
+func TestChain_ContinuesLastEntry(t *testing.T) {
+	log := writeLog(t, chainBatches[0])
+	last, err := LastEntry(strings.NewReader(log))
+	if err != nil || last.Sequence != 3 {
+		t.Fatalf("Assertion failed: LastEntry = %+v, %v", last, err)
+	}
+
+	var appended bytes.Buffer
+	records, _, _ := (&application.OperationProcessor{}).ProcessRecords(context.Background(), chainBatches[1])
+	NewChain(&appended, last).WriteBatch(records)
+
+	verified, err := Verify(context.Background(), strings.NewReader(log+appended.String()))
+	if err != nil || verified.Sequence != 5 {
+		t.Errorf("Assertion failed: Verify = %d, %v, want 5 entries", verified.Sequence, err)
+	}
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	log := writeLog(t, chainBatches...)
+	lines := strings.SplitAfter(log, "\n")
+
+	tests := []struct {
+		name     string
+		log      string
+		sequence int
+		reason   string
+	}{
+		{"altered result", strings.Replace(log, `"tax":10000`, `"tax":9000`, 1), 2, "hash does not match"},
+		{"removed entry", lines[0] + strings.Join(lines[2:], ""), 2, "sequence is 3"},
+		{"swapped entries", lines[1] + lines[0] + strings.Join(lines[2:], ""), 1, "sequence is 2"},
+		{"rewritten chain", rewritten(t, log), 1, "does not match the replayed"},
+		{"batch 0", rechained(t, log, func(entry *Entry) { entry.Batch = 0 }), 1, "batch is 0"},
+		{"operation 0", rechained(t, log, func(entry *Entry) { entry.Operation = 0 }), 1, "operation is 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(context.Background(), strings.NewReader(tt.log))
+
+			var mismatch *VerifyError
+			if !errors.As(err, &mismatch) || mismatch.Sequence != tt.sequence || !strings.Contains(mismatch.Reason, tt.reason) {
+				t.Errorf("Assertion failed: Verify returned %v, want entry %d: %s", err, tt.sequence, tt.reason)
+			}
+		})
+	}
+}
+
+// rewritten alters the result of the first entry and recomputes every hash, as someone rewriting the whole log would
+func rewritten(t *testing.T, log string) string {
+	return rechained(t, log, func(entry *Entry) { entry.Result.Tax = 1 })
+}
+
+// rechained alters the first entry with alter and recomputes every hash
+func rechained(t *testing.T, log string, alter func(entry *Entry)) string {
+	t.Helper()
+	var output strings.Builder
+	previous := ""
+	readEntries(strings.NewReader(log), func(entry Entry) error {
+		if entry.Sequence == 1 {
+			alter(&entry)
+		}
+		entry.Previous = previous
+		entry.Hash = entry.hash()
+		previous = entry.Hash
+		line, _ := json2.Marshal(entry)
+		output.Write(append(line, '\n'))
+		return nil
+	})
+	return output.String()
+}
@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	json2 "encoding/json"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"io"
+	"time"
+)
+
+// CloudEvents attributes of the records
+const (
+	SpecVersion     = "1.0"
+	OperationType   = "com.github.andreposman.capital-gains.operation.processed"
+	DataContentType = "application/json"
+	DefaultSource   = "/capital-gains/cli"
+)
+
+// sequenceDigits pads the sequence, which consumers compare as a string
+const sequenceDigits = 20
+
+// CloudEvent is a CloudEvents 1.0 record in the JSON event format, with the sequence extension
+type CloudEvent struct {
+	SpecVersion     string        `json:"specversion"`
+	ID              string        `json:"id"`
+	Source          string        `json:"source"`
+	Type            string        `json:"type"`
+	Subject         string        `json:"subject,omitempty"` // ticker of the operation
+	Time            string        `json:"time"`
+	DataContentType string        `json:"datacontenttype"`
+	Sequence        string        `json:"sequence"` // 1-based position of the record in the stream
+	Data            OperationData `json:"data"`
+}
+
+// OperationData is the payload of a record: a processed operation and its tax outcome
+type OperationData struct {
+	Batch     int            `json:"batch"`     // 1-based input line, or file
+	Operation int            `json:"operation"` // 1-based position of the operation in the batch
+	Input     json.Operation `json:"input"`
+	Result    domain.Tax     `json:"result"` // always explained
+}
+
+// Sink writes every processed operation to w as a CloudEvents record, one JSON object per line.
+// The records of a sink share the source and are numbered from 1; ids are unique across runs
+type Sink struct {
+	w        io.Writer
+	source   string
+	run      string
+	sequence int
+	now      func() time.Time
+}
+
+// NewSink writes the records of source to w
+func NewSink(w io.Writer, source string) *Sink {
+	if source == "" {
+		source = DefaultSource
+	}
+	return &Sink{w: w, source: source, run: newRunID(), now: time.Now}
+}
+
+// WriteBatch writes a record for each operation of a batch with its result
+func (s *Sink) WriteBatch(batch int, operations []application.Operation, results []domain.Tax) error {
+	for i, operation := range operations {
+		data := OperationData{Batch: batch, Operation: i + 1, Input: json.FromApplication(operation), Result: results[i]}
+		if err := s.write(operation.Ticker, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sink) write(subject string, data OperationData) error {
+	s.sequence++
+	event := CloudEvent{
+		SpecVersion:     SpecVersion,
+		ID:              fmt.Sprintf("%s-%d", s.run, s.sequence),
+		Source:          s.source,
+		Type:            OperationType,
+		Subject:         subject,
+		Time:            s.now().UTC().Format(time.RFC3339Nano),
+		DataContentType: DataContentType,
+		Sequence:        fmt.Sprintf("%0*d", sequenceDigits, s.sequence),
+		Data:            data,
+	}
+	line, err := json2.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// newRunID tells the records of different runs of the same source apart
+func newRunID() string {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(random)
+}
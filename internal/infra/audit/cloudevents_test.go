@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"bytes"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSink(w *bytes.Buffer) *Sink {
+	sink := NewSink(w, "/accounts/alice")
+	sink.run = "run"
+	sink.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("BRT", -3*3600)) }
+	return sink
+}
+
+func TestSink_WriteBatch(t *testing.T) {
+	var output bytes.Buffer
+	sink := newTestSink(&output)
+	operations := []application.Operation{
+		{ID: "b1", Type: "buy", UnitCost: 10.00, Quantity: 100, Ticker: "PETR4"},
+		{Type: "sell", UnitCost: 15.00, Quantity: 100},
+	}
+	results := []domain.Tax{
+		{Explanation: &domain.Explanation{AverageCostAfter: 10.00, Reason: domain.ReasonBuyNoTax}},
+		{Tax: 0},
+	}
+
+	err := sink.WriteBatch(3, operations, results)
+
+	expected := `{"specversion":"1.0","id":"run-1","source":"/accounts/alice","type":"com.github.andreposman.capital-gains.operation.processed",` +
+		`"subject":"PETR4","time":"2024-03-01T15:00:00Z","datacontenttype":"application/json","sequence":"00000000000000000001",` +
+		`"data":{"batch":3,"operation":1,"input":{"id":"b1","operation":"buy","unit-cost":10,"quantity":100,"ticker":"PETR4"},` +
+		`"result":{"tax":0,"explanation":{"average-cost-before":0,"average-cost-after":10,"sale-value":0,"gross-profit":0,"loss-used":0,` +
+		`"loss-added":0,"taxable-base":0,"rate":0,"reason":"BUY_NO_TAX"}}}}`
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if err != nil || len(lines) != 2 {
+		t.Fatalf("Assertion failed: expected 2 records, got %d (%v)", len(lines), err)
+	}
+	if lines[0] != expected {
+		t.Errorf("Assertion failed: record = %s, want %s", lines[0], expected)
+	}
+	// operations without a ticker have no subject
+	if !strings.Contains(lines[1], `"id":"run-2"`) || !strings.Contains(lines[1], `"sequence":"00000000000000000002"`) || strings.Contains(lines[1], `"subject"`) {
+		t.Errorf("Assertion failed: second record = %s", lines[1])
+	}
+}
+
+func TestSink_SequenceContinuesAcrossBatches(t *testing.T) {
+	var output bytes.Buffer
+	sink := newTestSink(&output)
+	operation := []application.Operation{{Type: "buy", UnitCost: 10.00, Quantity: 100}}
+
+	sink.WriteBatch(1, operation, []domain.Tax{{}})
+	sink.WriteBatch(2, operation, []domain.Tax{{}})
+
+	if !strings.Contains(output.String(), `"sequence":"00000000000000000002","data":{"batch":2`) {
+		t.Errorf("Assertion failed: expected the second batch to continue the sequence, got %s", output.String())
+	}
+}
+
+func TestNewSink_DefaultSourceAndUniqueRuns(t *testing.T) {
+	first, second := NewSink(nil, ""), NewSink(nil, "")
+
+	if first.source != DefaultSource || first.run == second.run {
+		t.Errorf("Assertion failed: source = %q, runs %q and %q", first.source, first.run, second.run)
+	}
+}
@@ -0,0 +1,214 @@
+package b3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	csv2 "github.com/andreposman/capital-gains/internal/infra/csv"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dateLayout is the format of the "Data do Negócio" column
+const dateLayout = "02/01/2006"
+
+// columns of the trading statement (extrato de negociação) exported from the Área do Investidor,
+// after normalize
+const (
+	columnDate     = "data do negocio"
+	columnSide     = "tipo de movimentacao"
+	columnMarket   = "mercado"
+	columnTicker   = "codigo de negociacao"
+	columnQuantity = "quantidade"
+	columnPrice    = "preco"
+)
+
+// tradedMarkets are the markets whose rows are turned into operations, every other market
+// (options, forward, futures...) is skipped
+var tradedMarkets = map[string]bool{
+	"mercado a vista":     true,
+	"mercado fracionario": true,
+}
+
+// fractionalTicker matches the odd-lot tickers, e.g. PETR4F is traded as PETR4
+var fractionalTicker = regexp.MustCompile(`^([A-Z0-9]{4}\d{1,2})F$`)
+
+// RowError is a row of the statement that looked like a trade but could not be interpreted
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Statement is the result of reading a trading statement
+type Statement struct {
+	Operations []json.Operation
+	Skipped    int        // non-trade rows: other markets, blank and total lines
+	Errors     []RowError // rows that could not be interpreted
+}
+
+// ParseStatement reads a B3 trading statement saved as CSV (comma, semicolon or tab separated)
+// and returns its stock trades in chronological order
+func ParseStatement(r io.Reader) (Statement, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = detectDelimiter(content)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return Statement{Operations: []json.Operation{}}, nil
+	}
+	if err != nil {
+		return Statement{}, err
+	}
+
+	index, err := columnIndex(header)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	statement := Statement{Operations: []json.Operation{}}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Statement{}, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(column string) string {
+			i := index[column]
+			if i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		if !tradedMarkets[normalize(field(columnMarket))] {
+			statement.Skipped++
+			continue
+		}
+
+		operation, err := parseTrade(field)
+		if err != nil {
+			statement.Errors = append(statement.Errors, RowError{Line: line, Err: err})
+			continue
+		}
+		statement.Operations = append(statement.Operations, operation)
+	}
+
+	sortChronologically(statement.Operations)
+	return statement, nil
+}
+
+// BaseTicker maps a fractional-market ticker to the ticker of the standard lot
+func BaseTicker(ticker string) string {
+	ticker = strings.ToUpper(strings.TrimSpace(ticker))
+	if match := fractionalTicker.FindStringSubmatch(ticker); match != nil {
+		return match[1]
+	}
+	return ticker
+}
+
+func parseTrade(field func(string) string) (json.Operation, error) {
+	var operation json.Operation
+	var err error
+
+	if operation.Operation, err = csv2.ParseSide(field(columnSide)); err != nil {
+		return operation, err
+	}
+
+	date, err := time.Parse(dateLayout, field(columnDate))
+	if err != nil {
+		return operation, fmt.Errorf("invalid date %q", field(columnDate))
+	}
+	operation.Date = date.Format(json.DateLayout)
+
+	if operation.Ticker = BaseTicker(field(columnTicker)); operation.Ticker == "" {
+		return operation, errors.New("missing ticker")
+	}
+
+	if operation.Quantity, err = csv2.ParseQuantity(field(columnQuantity), ','); err != nil || operation.Quantity <= 0 {
+		return operation, fmt.Errorf("invalid quantity %q", field(columnQuantity))
+	}
+
+	if operation.UnitCost, err = csv2.ParseNumber(field(columnPrice), ','); err != nil || operation.UnitCost <= 0 {
+		return operation, fmt.Errorf("invalid price %q", field(columnPrice))
+	}
+
+	return operation, nil
+}
+
+// sortChronologically orders the trades by date. The statement is usually exported newest first,
+// so it is reversed before sorting to keep same-day trades in execution order
+func sortChronologically(operations []json.Operation) {
+	if len(operations) > 1 && operations[0].Date > operations[len(operations)-1].Date {
+		for i, j := 0, len(operations)-1; i < j; i, j = i+1, j-1 {
+			operations[i], operations[j] = operations[j], operations[i]
+		}
+	}
+	sort.SliceStable(operations, func(i, j int) bool {
+		return operations[i].Date < operations[j].Date
+	})
+}
+
+func columnIndex(header []string) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[normalize(name)] = i
+	}
+
+	var missing []string
+	for _, column := range []string{columnDate, columnSide, columnMarket, columnTicker, columnQuantity, columnPrice} {
+		if _, ok := index[column]; !ok {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("not a B3 trading statement, missing columns: %s", strings.Join(missing, ", "))
+	}
+	return index, nil
+}
+
+func detectDelimiter(content []byte) rune {
+	firstLine, _ := bufio.NewReader(bytes.NewReader(content)).ReadString('\n')
+	best, bestCount := ',', 0
+	for _, delimiter := range []rune{';', '\t', ','} {
+		if count := strings.Count(firstLine, string(delimiter)); count > bestCount {
+			best, bestCount = delimiter, count
+		}
+	}
+	return best
+}
+
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a",
+	"é", "e", "ê", "e",
+	"í", "i",
+	"ó", "o", "ô", "o", "õ", "o",
+	"ú", "u",
+	"ç", "c",
+)
+
+// normalize lowercases and strips accents so header and market names can be compared
+func normalize(value string) string {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "\ufeff")
+	return accents.Replace(strings.ToLower(value))
+}
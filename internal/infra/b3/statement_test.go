@@ -0,0 +1,81 @@
+package b3
+
+import (
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStatement_SampleExport(t *testing.T) {
+	file, err := os.Open("testdata/negociacao.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	expected := []json.Operation{
+		{Operation: "buy", UnitCost: 35.50, Quantity: 100, Ticker: "PETR4", Date: "2024-03-01"},
+		{Operation: "buy", UnitCost: 35.00, Quantity: 100, Ticker: "PETR4", Date: "2024-03-01"},
+		{Operation: "buy", UnitCost: 36.00, Quantity: 50, Ticker: "PETR4", Date: "2024-03-05"},
+		{Operation: "sell", UnitCost: 40.00, Quantity: 200, Ticker: "PETR4", Date: "2024-03-20"},
+	}
+
+	statement, err := ParseStatement(file)
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(statement.Operations, expected) {
+		t.Errorf("Assertion failed: operations = %v, want %v", statement.Operations, expected)
+	}
+	if statement.Skipped != 2 {
+		t.Errorf("Assertion failed: skipped = %d, want 2 (option and total rows)", statement.Skipped)
+	}
+	if len(statement.Errors) != 1 || statement.Errors[0].Line != 4 {
+		t.Errorf("Assertion failed: errors = %v, want a single error on line 4", statement.Errors)
+	}
+}
+
+func TestParseStatement_CommaSeparatedChronological(t *testing.T) {
+	input := "Data do Negócio,Tipo de Movimentação,Mercado,Prazo/Vencimento,Instituição,Código de Negociação,Quantidade,Preço,Valor\n" +
+		"01/02/2024,Compra,Mercado à Vista,-,CLEAR,ITSA4,100,\"9,80\",\"980,00\"\n" +
+		"02/02/2024,Venda,Mercado à Vista,-,CLEAR,ITSA4,100,\"10,10\",\"1.010,00\"\n"
+	expected := []json.Operation{
+		{Operation: "buy", UnitCost: 9.80, Quantity: 100, Ticker: "ITSA4", Date: "2024-02-01"},
+		{Operation: "sell", UnitCost: 10.10, Quantity: 100, Ticker: "ITSA4", Date: "2024-02-02"},
+	}
+
+	statement, err := ParseStatement(strings.NewReader(input))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(statement.Operations, expected) {
+		t.Errorf("Assertion failed: operations = %v, want %v", statement.Operations, expected)
+	}
+}
+
+func TestParseStatement_NotAStatement(t *testing.T) {
+	_, err := ParseStatement(strings.NewReader("operation,unit-cost,quantity\nbuy,10,100\n"))
+
+	if err == nil {
+		t.Fatalf("Assertion failed: expected an error for a file without the statement columns, but got nil")
+	}
+}
+
+func TestBaseTicker(t *testing.T) {
+	cases := map[string]string{
+		"PETR4F":  "PETR4",
+		"TAEE11F": "TAEE11",
+		"petr4f":  "PETR4",
+		"PETR4":   "PETR4",
+		"BOVA11":  "BOVA11",
+	}
+
+	for ticker, expected := range cases {
+		if result := BaseTicker(ticker); result != expected {
+			t.Errorf("Assertion failed: BaseTicker(%q) = %q, want %q", ticker, result, expected)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"github.com/andreposman/capital-gains/internal/infra/audit"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// openAudit opens the --audit sink: a file, created or truncated, or fd:N for an inherited file descriptor
+func openAudit(path string) (io.WriteCloser, error) {
+	if fd, ok := strings.CutPrefix(path, "fd:"); ok {
+		n, err := strconv.Atoi(fd)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid file descriptor %q", fd)
+		}
+		file := os.NewFile(uintptr(n), "audit")
+		if file == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d", n)
+		}
+		return file, nil
+	}
+	return os.Create(path)
+}
+
+// openAuditLog opens the --audit-log for appending, created when missing, with its last entry to continue the chain
+func openAuditLog(path string) (*os.File, audit.Entry, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, audit.Entry{}, err
+	}
+	last, err := audit.LastEntry(file)
+	if err != nil {
+		file.Close()
+		return nil, audit.Entry{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, last, nil
+}
+
+// withoutExplanations drops the explanations processed for the audit from the results written to stdout
+func withoutExplanations(results []domain.Tax) []domain.Tax {
+	stripped := make([]domain.Tax, len(results))
+	for i, result := range results {
+		result.Explanation = nil
+		stripped[i] = result
+	}
+	return stripped
+}
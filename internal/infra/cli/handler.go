@@ -1,60 +1,290 @@
 package cli
 
 import (
-	"bufio"
-	"bytes"
-	json2 "encoding/json"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"github.com/andreposman/capital-gains/internal/infra/audit"
+	"github.com/andreposman/capital-gains/internal/infra/csv"
+	"github.com/andreposman/capital-gains/internal/infra/input"
 	"github.com/andreposman/capital-gains/internal/infra/json"
-	"log"
+	"github.com/andreposman/capital-gains/internal/infra/output"
+	"github.com/andreposman/capital-gains/internal/infra/sinacor"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
-var newLine = []byte{'\n'}
+// exit codes returned by Handle
+const (
+	ExitOK          = 0
+	ExitLinesFailed = 1
+	ExitUsage       = 2
+	ExitCanceled    = 130 // interrupted, like a shell reports SIGINT
+)
+
+// Handle runs the CLI against stdin/stdout and returns the process exit code.
+// SIGINT and SIGTERM cancel the run, or shut the server down
+func Handle(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	return run(ctx, args, os.Stdin, os.Stdout, os.Stderr)
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "validate":
+			return runValidate(args[1:], stdin, stdout, stderr)
+		case "schema":
+			return runSchema(args[1:], stdout, stderr)
+		case "verify-audit":
+			return runVerifyAudit(ctx, args[1:], stdin, stdout, stderr)
+		case "serve":
+			return runServe(ctx, args[1:], stderr)
+		}
+	}
+	return runProcess(ctx, args, stdin, stdout, stderr)
+}
+
+// runProcess writes the results of every batch of the input. When ctx is done it stops before the next
+// operation: the results of the operations already processed are written, including those of a line that
+// was cut short, the cancellation is logged with how many operations of that line were processed, and
+// ExitCanceled is returned
+func runProcess(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("capital-gains", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	continueOnError := flags.Bool("continue-on-error", false, "write an error record for lines that cannot be parsed or processed and keep going")
+	strict := flags.Bool("strict", false, "reject operations that do not pass schema validation")
+	explain := flags.Bool("explain", false, "add to every result how its tax was reached")
+	inputPath := flags.String("input", "", "read operations from this file instead of stdin")
+	inputFormat := flags.String("input-format", "", "input format: "+strings.Join(input.Names(), ", ")+" (default: detected from the --input extension or the content)")
+	csvColumns := flags.String("csv-columns", "", "CSV column mapping, e.g. operation=Tipo,unit-cost=Preço,quantity=Qtd,ticker=Ativo,date=Data")
+	csvDecimal := flags.String("csv-decimal", ".", "CSV decimal separator: . or ,")
+	csvDelimiter := flags.String("csv-delimiter", "", "CSV field delimiter (default: ; when --csv-decimal is , and , otherwise)")
+	csvDateFormat := flags.String("csv-date-format", json.DateLayout, "Go time layout of the CSV date column, e.g. 02/01/2006")
+	sinacorIssuers := flags.String("sinacor-issuers", "", "ticker roots of brokerage note issuers missing from the built-in list, e.g. MINERVA=BEEF,SLC AGRICOLA=SLCE")
+	lossReport := flags.String("loss-report", "", "write where every accumulated loss came from and which sales used it to this file")
+	outputFormat := flags.String("output", "json", "output format: "+strings.Join(output.Names(), ", "))
+	auditPath := flags.String("audit", "", "also write every operation and its result as a CloudEvents record to this file, or fd:N")
+	auditSource := flags.String("audit-source", audit.DefaultSource, "CloudEvents source of the --audit records, e.g. the account")
+	auditLog := flags.String("audit-log", "", "append every operation, its result and the portfolio state hash to this hash-chained audit log")
+	logOptions := addLogFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	logger, err := logOptions.logger(stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+
+	columns, err := csv.ParseColumns(*csvColumns)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+	issuers, err := sinacor.ParseIssuers(*sinacorIssuers)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+	options := input.Options{
+		Strict:  *strict,
+		Issuers: issuers,
+		CSV: csv.Config{
+			Columns:          columns,
+			DecimalSeparator: firstRune(*csvDecimal),
+			Comma:            firstRune(*csvDelimiter),
+			DateFormat:       *csvDateFormat,
+		},
+	}
 
-func Handle() {
-	scanner := bufio.NewScanner(os.Stdin)
-	processor := application.OperationProcessor{}
+	reader := stdin
+	if *inputPath != "" {
+		file, err := os.Open(*inputPath)
+		if err != nil {
+			logger.Error("Error opening input file", "err", err)
+			return ExitLinesFailed
+		}
+		defer file.Close()
+		reader = file
+	}
 
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		currLine := line
+	var decoder input.InputDecoder
+	if *inputFormat != "" {
+		var ok bool
+		if decoder, ok = input.Lookup(*inputFormat); !ok {
+			fmt.Fprintf(stderr, "unknown input format %q, want one of: %s\n", *inputFormat, strings.Join(input.Names(), ", "))
+			return ExitUsage
+		}
+	} else {
+		decoder, reader = input.Detect(*inputPath, reader)
+	}
+
+	newEncoder, ok := output.Lookup(*outputFormat)
+	if !ok {
+		fmt.Fprintf(stderr, "unknown output format %q, want one of: %s\n", *outputFormat, strings.Join(output.Names(), ", "))
+		return ExitUsage
+	}
+	encoder := newEncoder(stdout, output.Options{Color: output.IsTerminal(stdout), Explain: *explain})
+
+	var report io.Writer
+	if *lossReport != "" {
+		file, err := os.Create(*lossReport)
+		if err != nil {
+			logger.Error("Error creating loss report", "err", err)
+			return ExitLinesFailed
+		}
+		defer file.Close()
+		report = file
+	}
 
-		if len(currLine) == 0 {
-			break
+	var sink *audit.Sink
+	if *auditPath != "" {
+		file, err := openAudit(*auditPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error opening audit sink: %v\n", err)
+			return ExitUsage
 		}
+		defer file.Close()
+		sink = audit.NewSink(file, *auditSource)
+	}
 
-		operations, err := json.ParseInput(line)
+	var chain *audit.Chain
+	if *auditLog != "" {
+		file, last, err := openAuditLog(*auditLog)
 		if err != nil {
-			log.Fatalf("Error parsing input JSON: %v", err)
+			fmt.Fprintf(stderr, "Error opening audit log: %v\n", err)
+			return ExitUsage
 		}
+		defer file.Close()
+		chain = audit.NewChain(file, last)
+	}
+
+	processor := application.OperationProcessor{Logger: logger, Explain: *explain}
+	exitCode := ExitOK
+	batchNumber := 0
 
-		// if json is empty "[]"
-		if len(operations) == 0 {
-			_, writeErr := os.Stdout.Write([]byte("[]\n")) // Write empty array with newline
-			if writeErr != nil {
-				log.Fatalf("Error writing empty array to stdout: %v", writeErr)
+	// writeBatch writes the results of a batch, and their audit records and loss ledgers. records are
+	// only processed for the audit sink or log
+	writeBatch := func(ctx context.Context, operations []application.Operation, results []domain.Tax, records []application.OperationRecord, ledgers []application.LossLedger) error {
+		if sink != nil {
+			if err := sink.WriteBatch(batchNumber, operations, results); err != nil {
+				return err
 			}
-			continue //move to next line
 		}
+		if chain != nil {
+			if err := chain.WriteBatch(records); err != nil {
+				return err
+			}
+		}
+		if !*explain {
+			results = withoutExplanations(results)
+		}
+		if report != nil {
+			if err := output.WriteLossReport(report, batchNumber, ledgers); err != nil {
+				return err
+			}
+		}
+		return encoder.Encode(ctx, results)
+	}
 
-		//valid, non-empty json
-		result := processor.ProcessOperations(operations)
+	err = decoder.Decode(ctx, reader, options, func(batch input.Batch) error {
+		batchNumber++
+		for _, warning := range batch.Warnings {
+			logger.Warn("Skipped input", "format", decoder.Name(), "warning", warning)
+			exitCode = ExitLinesFailed
+		}
 
-		output, err := json2.Marshal(result)
-		if err != nil {
-			log.Fatalf("Error marshalling output JSON: %v", err)
+		if batch.Err != nil {
+			if !*continueOnError {
+				return fmt.Errorf("parsing input %s: %w", decoder.Name(), batch.Err)
+			}
+
+			record := output.ErrorRecord{
+				Line:   batch.Line,
+				Offset: batch.Offset,
+				Error:  batch.Err.Error(),
+			}
+			var issues json.ValidationErrors
+			if errors.As(batch.Err, &issues) {
+				record.Issues = issues
+			}
+			exitCode = ExitLinesFailed
+			return encoder.EncodeError(ctx, record)
 		}
-		//log.Println(string(output))
 
-		outputWithNewline := bytes.Join([][]byte{output, newLine}, []byte{})
-		_, writeErr := os.Stdout.Write(outputWithNewline)
-		if writeErr != nil {
-			log.Fatalf("Error writing result to stdout: %v", writeErr)
+		var (
+			results []domain.Tax
+			records []application.OperationRecord
+			ledgers []application.LossLedger
+			err     error
+		)
+		if sink != nil || chain != nil {
+			// the records are always explained, for the audit
+			records, ledgers, err = processor.ProcessRecords(ctx, batch.Operations)
+			results = make([]domain.Tax, len(records))
+			for i, record := range records {
+				results[i] = record.Tax
+			}
+		} else {
+			results, ledgers, err = processor.ProcessWithLedger(ctx, batch.Operations)
 		}
+		var canceled *application.CanceledError
+		if err != nil && !errors.As(err, &canceled) {
+			// an unknown operation type is reported like a bad line but never aborts the run, it may be
+			// a type this version does not have a handler for
+			var unknown *application.UnknownOperationError
+			if !*continueOnError && !errors.As(err, &unknown) {
+				return err
+			}
+			exitCode = ExitLinesFailed
+			return encoder.EncodeError(ctx, output.ErrorRecord{
+				Line:   batch.Line,
+				Offset: batch.Offset,
+				Error:  err.Error(),
+				Issues: json.OperationIssues(err),
+			})
+		}
+
+		// the operations processed are written even when ctx is done by now, so no result is lost. A batch
+		// cut short by the cancellation is written with the results it has, and the run stops with its error
+		if err := writeBatch(context.WithoutCancel(ctx), batch.Operations[:len(results)], results, records, ledgers); err != nil {
+			return err
+		}
+		if canceled != nil {
+			return canceled
+		}
+		return nil
+	})
+	canceled := err != nil && ctx.Err() != nil
+	if err != nil && !canceled {
+		// not flushed, a failed run writes none of the buffered results
+		logger.Error("Error processing input", "err", err)
+		return ExitLinesFailed
+	}
+	if err := encoder.Flush(); err != nil {
+		logger.Error("Error writing output", "err", err)
+		return ExitLinesFailed
 	}
+	if canceled {
+		logger.Warn("Canceled", "err", err)
+		return ExitCanceled
+	}
+
+	return exitCode
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("Error reading standard input: %v", err)
+func firstRune(value string) rune {
+	for _, r := range value {
+		return r
 	}
+	return 0
 }
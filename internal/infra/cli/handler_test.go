@@ -0,0 +1,482 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/andreposman/capital-gains/internal/infra/audit"
+	"github.com/andreposman/capital-gains/internal/infra/output"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_ContinueOnError_IsolatesMalformedLine(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n" +
+		`[{"operation":"buy","unit-cost":10.00,"quantity":100},` + "\n" +
+		`[{"operation":"buy","unit-cost":10.00,"quantity":10000},{"operation":"sell","unit-cost":20.00,"quantity":5000}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--continue-on-error"}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitLinesFailed {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitLinesFailed)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Assertion failed: expected 3 output lines, got %d: %q", len(lines), stdout.String())
+	}
+	if lines[0] != `[{"tax":0}]` {
+		t.Errorf("Assertion failed: line 1 = %s, want [{\"tax\":0}]", lines[0])
+	}
+	if lines[2] != `[{"tax":0},{"tax":10000}]` {
+		t.Errorf("Assertion failed: line 3 = %s, want [{\"tax\":0},{\"tax\":10000}]", lines[2])
+	}
+
+	var record output.ErrorRecord
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("Assertion failed: error record is not valid JSON: %v", err)
+	}
+	if record.Line != 2 {
+		t.Errorf("Assertion failed: record line = %d, want 2", record.Line)
+	}
+	firstLineLen := int64(len(`[{"operation":"buy","unit-cost":10.00,"quantity":100}]`) + 1)
+	secondLineLen := int64(len(`[{"operation":"buy","unit-cost":10.00,"quantity":100},`))
+	if record.Offset != firstLineLen+secondLineLen {
+		t.Errorf("Assertion failed: record offset = %d, want %d", record.Offset, firstLineLen+secondLineLen)
+	}
+	if record.Error == "" {
+		t.Errorf("Assertion failed: record error message is empty")
+	}
+}
+
+func TestRun_AllLinesValid_ExitOK(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n" + "[]\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--continue-on-error"}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitOK {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitOK)
+	}
+	if stdout.String() != "[{\"tax\":0}]\n[]\n" {
+		t.Errorf("Assertion failed: output = %q", stdout.String())
+	}
+}
+
+func TestRun_AmendListsTaxDifferences(t *testing.T) {
+	input := `[{"id":"b1","operation":"buy","unit-cost":10.00,"quantity":10000},{"operation":"sell","unit-cost":20.00,"quantity":5000},` +
+		`{"operation":"amend","ref":"b1","unit-cost":15.00,"quantity":10000}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--strict"}, strings.NewReader(input), &stdout, &stderr)
+
+	expected := `[{"tax":0},{"tax":10000},{"tax":0,"adjustments":[{"operation":2,"before":10000,"after":5000,"difference":-5000}]}]` + "\n"
+	if exitCode != ExitOK || stdout.String() != expected {
+		t.Errorf("Assertion failed: exit code = %d, output = %q, want %q", exitCode, stdout.String(), expected)
+	}
+}
+
+func TestRun_ContinueOnError_UnknownOperationType(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":100},{"operation":"split","unit-cost":0,"quantity":2}]` + "\n" +
+		`[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--continue-on-error"}, strings.NewReader(input), &stdout, &stderr)
+
+	expected := `{"line":1,"offset":0,"error":"operation 2: unknown operation type \"split\", want one of \"buy\", \"sell\", \"cancel\", \"amend\"",` +
+		`"issues":[{"path":"[1].operation","message":"must be one of \"buy\", \"sell\", \"cancel\", \"amend\", got \"split\""}]}` + "\n" +
+		`[{"tax":0}]` + "\n"
+	if exitCode != ExitLinesFailed || stdout.String() != expected {
+		t.Errorf("Assertion failed: exit code = %d, output = %q, want %q", exitCode, stdout.String(), expected)
+	}
+}
+
+func TestRun_UnknownOperationType_DoesNotAbort(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n" +
+		`[{"operation":"split","unit-cost":0,"quantity":2}]` + "\n" +
+		`[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), nil, strings.NewReader(input), &stdout, &stderr)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if exitCode != ExitLinesFailed || len(lines) != 3 || lines[2] != `[{"tax":0}]` {
+		t.Fatalf("Assertion failed: exit code = %d, output = %q", exitCode, stdout.String())
+	}
+	if !strings.HasPrefix(lines[1], `{"line":2,"offset":55,"error":"operation 1: unknown operation type \"split\"`) {
+		t.Errorf("Assertion failed: expected the error record of line 2, got %q", lines[1])
+	}
+}
+
+func TestRun_AuditWritesCloudEvents(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":10000,"ticker":"PETR4"},{"operation":"sell","unit-cost":20.00,"quantity":5000,"ticker":"PETR4"}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--audit", auditPath, "--audit-source", "/accounts/alice"}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitOK || stdout.String() != `[{"tax":0},{"tax":10000}]`+"\n" {
+		t.Errorf("Assertion failed: exit code = %d, output = %q", exitCode, stdout.String())
+	}
+	content, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Assertion failed: reading the audit file returned %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	var record struct {
+		SpecVersion string `json:"specversion"`
+		Source      string `json:"source"`
+		Subject     string `json:"subject"`
+		Sequence    string `json:"sequence"`
+		Data        struct {
+			Result struct {
+				Tax         float64 `json:"tax"`
+				Explanation *struct {
+					Reason string `json:"reason"`
+				} `json:"explanation"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &record) != nil {
+		t.Fatalf("Assertion failed: expected 2 JSON records, got %q", content)
+	}
+	if record.SpecVersion != "1.0" || record.Source != "/accounts/alice" || record.Subject != "PETR4" || record.Sequence != "00000000000000000002" {
+		t.Errorf("Assertion failed: record = %+v", record)
+	}
+	if record.Data.Result.Tax != 10000 || record.Data.Result.Explanation == nil || record.Data.Result.Explanation.Reason != "TAXED_PROFIT" {
+		t.Errorf("Assertion failed: expected the explained result, got %+v", record.Data.Result)
+	}
+}
+
+func TestRun_UnknownFlag_ExitUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--nope"}, strings.NewReader(""), &stdout, &stderr)
+
+	if exitCode != ExitUsage {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitUsage)
+	}
+}
+
+func TestRun_Strict_RejectsInvalidLine(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":-10.00,"quantity":100}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--strict", "--continue-on-error"}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitLinesFailed {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitLinesFailed)
+	}
+
+	var record output.ErrorRecord
+	if err := json.Unmarshal(stdout.Bytes(), &record); err != nil {
+		t.Fatalf("Assertion failed: error record is not valid JSON: %v", err)
+	}
+	if len(record.Issues) != 1 || record.Issues[0].Path != "[0].unit-cost" {
+		t.Errorf("Assertion failed: issues = %v, want a single [0].unit-cost issue", record.Issues)
+	}
+}
+
+func TestRun_Validate_ReportsIssuesPerLine(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n" +
+		`[{"operation":"buy","unit-cost":10.00,"quantity":100},{"operation":"sell","unit-cost":0,"quantity":100}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"validate"}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitLinesFailed {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitLinesFailed)
+	}
+	if stdout.String() != "line 2: [1].unit-cost must be > 0\n" {
+		t.Errorf("Assertion failed: output = %q", stdout.String())
+	}
+}
+
+func TestRun_Schema_PrintsInputSchema(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"schema", "input"}, strings.NewReader(""), &stdout, &stderr)
+
+	if exitCode != ExitOK {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitOK)
+	}
+	if !json.Valid(stdout.Bytes()) || !strings.Contains(stdout.String(), `"unit-cost"`) {
+		t.Errorf("Assertion failed: output is not the operations schema: %q", stdout.String())
+	}
+}
+
+func TestRun_CSVInputDetectedFromExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trades.csv")
+	content := "Data;Tipo;Qtd;Preço\n01/03/2024;Compra;10000;10,00\n02/03/2024;Venda;5000;20,00\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{
+		"--input", path,
+		"--csv-columns", "operation=Tipo,unit-cost=Preço,quantity=Qtd,date=Data",
+		"--csv-decimal", ",",
+		"--csv-date-format", "02/01/2006",
+	}
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr)
+
+	if exitCode != ExitOK {
+		t.Errorf("Assertion failed: exit code = %d, want %d (stderr: %s)", exitCode, ExitOK, stderr.String())
+	}
+	if stdout.String() != "[{\"tax\":0},{\"tax\":10000}]\n" {
+		t.Errorf("Assertion failed: output = %q", stdout.String())
+	}
+}
+
+func TestRun_OFXInputDetectedFromExtension(t *testing.T) {
+	content, err := os.ReadFile("../ofx/testdata/statement.ofx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "extrato.qfx")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--input", path}, strings.NewReader(""), &stdout, &stderr)
+
+	// the sample has a short sale, which is reported and skipped
+	if exitCode != ExitLinesFailed {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitLinesFailed)
+	}
+	// buy 10k @ 10.00 + 12.00 fees -> WAC 10.00; sell 5k @ 20.00 - 15.50 fees -> profit 49,984.50 -> tax 9,996.90
+	if stdout.String() != "[{\"tax\":0},{\"tax\":9996.9}]\n" {
+		t.Errorf("Assertion failed: output = %q", stdout.String())
+	}
+}
+
+func TestRun_OutputCSV(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":10000},{"operation":"sell","unit-cost":20.00,"quantity":5000}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--output", "csv"}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitOK {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitOK)
+	}
+	if stdout.String() != "batch,operation,tax,adjusts,tax-before,tax-after,difference,error\n1,1,0.00,,,,,\n1,2,10000.00,,,,,\n" {
+		t.Errorf("Assertion failed: output = %q", stdout.String())
+	}
+}
+
+func TestRun_UnknownOutputFormat_ExitUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--output", "xml"}, strings.NewReader(""), &stdout, &stderr)
+
+	if exitCode != ExitUsage {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitUsage)
+	}
+}
+
+func TestRun_Explain_AddsExplanation(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":10000},{"operation":"sell","unit-cost":20.00,"quantity":5000}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--explain"}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitOK {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitOK)
+	}
+	expected := `[{"tax":0,"explanation":{"average-cost-before":0,"average-cost-after":10,"sale-value":0,"gross-profit":0,"loss-used":0,"loss-added":0,"taxable-base":0,"rate":0,"reason":"BUY_NO_TAX"}},` +
+		`{"tax":10000,"explanation":{"average-cost-before":10,"average-cost-after":10,"sale-value":100000,"gross-profit":50000,"loss-used":0,"loss-added":0,"taxable-base":50000,"rate":0.2,"reason":"TAXED_PROFIT"}}]` + "\n"
+	if stdout.String() != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", stdout.String(), expected)
+	}
+}
+
+func TestRun_LossReport(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":20.00,"quantity":10000},{"operation":"sell","unit-cost":10.00,"quantity":5000},{"operation":"sell","unit-cost":30.00,"quantity":2000}]` + "\n"
+	path := filepath.Join(t.TempDir(), "losses.txt")
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--loss-report", path}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitOK {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitOK)
+	}
+	if stdout.String() != "[{\"tax\":0},{\"tax\":0},{\"tax\":0}]\n" {
+		t.Errorf("Assertion failed: output = %q", stdout.String())
+	}
+	report, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Assertion failed: loss report was not written: %v", err)
+	}
+	expected := "batch 1\n" +
+		"  loss 50000.00 from operation 2, remaining 30000.00\n" +
+		"    used 20000.00 by operation 3\n"
+	if string(report) != expected {
+		t.Errorf("Assertion failed: loss report = %q, want %q", report, expected)
+	}
+}
+
+func TestRun_Serve_InvalidAddress_ExitUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"serve", "--addr", "not-an-address"}, strings.NewReader(""), &stdout, &stderr)
+
+	if exitCode != ExitUsage {
+		t.Errorf("Assertion failed: exit code = %d, want %d", exitCode, ExitUsage)
+	}
+}
+
+func TestRun_Serve_UnknownStore_ExitUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"serve", "--data", filepath.Join(t.TempDir(), "accounts"), "--store", "redis"}, strings.NewReader(""), &stdout, &stderr)
+
+	if exitCode != ExitUsage || !strings.Contains(stderr.String(), `unknown store "redis"`) {
+		t.Errorf("Assertion failed: exit code = %d, stderr = %q", exitCode, stderr.String())
+	}
+}
+
+func TestRun_AuditLogAppendsAndVerifies(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit-log.jsonl")
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":10000,"ticker":"PETR4"},{"operation":"sell","unit-cost":20.00,"quantity":5000,"ticker":"PETR4"}]` + "\n"
+
+	for range 2 {
+		var stdout, stderr bytes.Buffer
+		if exitCode := run(context.Background(), []string{"--audit-log", logPath}, strings.NewReader(input), &stdout, &stderr); exitCode != ExitOK {
+			t.Fatalf("Assertion failed: exit code = %d, stderr = %q", exitCode, stderr.String())
+		}
+		if stdout.String() != `[{"tax":0},{"tax":10000}]`+"\n" {
+			t.Errorf("Assertion failed: output = %q", stdout.String())
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := run(context.Background(), []string{"verify-audit", "--log", logPath}, strings.NewReader(""), &stdout, &stderr)
+	content, _ := os.ReadFile(logPath)
+	last, _ := audit.LastEntry(bytes.NewReader(content))
+	if exitCode != ExitOK || stdout.String() != "audit log OK: 4 entries verified, last hash "+last.Hash+"\n" {
+		t.Errorf("Assertion failed: exit code = %d, output = %q, stderr = %q", exitCode, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	exitCode = run(context.Background(), []string{"verify-audit", "--log", logPath, "--head", "0000"}, strings.NewReader(""), &stdout, &stderr)
+	if exitCode != ExitLinesFailed || !strings.Contains(stdout.String(), "want 0000") {
+		t.Errorf("Assertion failed: exit code = %d, output = %q", exitCode, stdout.String())
+	}
+
+	tampered := strings.Replace(string(content), `"tax":10000`, `"tax":1000`, 1)
+	stdout.Reset()
+	exitCode = run(context.Background(), []string{"verify-audit"}, strings.NewReader(tampered), &stdout, &stderr)
+	if exitCode != ExitLinesFailed || !strings.Contains(stdout.String(), "entry 2: hash does not match") {
+		t.Errorf("Assertion failed: exit code = %d, output = %q", exitCode, stdout.String())
+	}
+}
+
+func TestRun_CanceledKeepsWrittenBatches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	input := io.MultiReader(
+		strings.NewReader(`[{"operation":"buy","unit-cost":10.00,"quantity":100}]`+"\n"),
+		readerFunc(func(p []byte) (int, error) {
+			// the interrupt arrives while the second line is read
+			cancel()
+			return copy(p, `[{"operation":"buy","unit-cost":10.00,"quantity":100}]`+"\n"), io.EOF
+		}),
+	)
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(ctx, []string{"--input-format", "json", "--output", "ndjson"}, input, &stdout, &stderr)
+
+	if exitCode != ExitCanceled || stdout.String() != `{"batch":1,"operation":1,"tax":0}`+"\n" {
+		t.Errorf("Assertion failed: exit code = %d, output = %q", exitCode, stdout.String())
+	}
+	if !strings.Contains(stderr.String(), `msg=Canceled err="context canceled"`) {
+		t.Errorf("Assertion failed: stderr = %q", stderr.String())
+	}
+}
+
+func TestRun_CanceledMidBatchWritesProcessedOperations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":10000},{"operation":"sell","unit-cost":20.00,"quantity":5000},{"operation":"sell","unit-cost":20.00,"quantity":5000}]` + "\n"
+	var stdout, logs bytes.Buffer
+	// the interrupt arrives right after the second operation is processed, traced at debug level
+	stderr := writerFunc(func(p []byte) (int, error) {
+		if strings.Contains(string(p), `msg="operation processed" operation=2`) {
+			cancel()
+		}
+		return logs.Write(p)
+	})
+
+	exitCode := run(ctx, []string{"--output", "ndjson", "--log-level", "debug"}, strings.NewReader(input), &stdout, stderr)
+
+	expected := `{"batch":1,"operation":1,"tax":0}` + "\n" + `{"batch":1,"operation":2,"tax":10000}` + "\n"
+	if exitCode != ExitCanceled || stdout.String() != expected {
+		t.Errorf("Assertion failed: exit code = %d, output = %q", exitCode, stdout.String())
+	}
+	if !strings.Contains(logs.String(), `msg=Canceled err="processing canceled after 2 of 3 operations: context canceled"`) {
+		t.Errorf("Assertion failed: stderr = %q", logs.String())
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+func TestRun_LogLevelDebugTracesToStderr(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":10000},{"operation":"sell","unit-cost":20.00,"quantity":5000}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), []string{"--log-level", "debug", "--log-format", "json"}, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitOK || stdout.String() != `[{"tax":0},{"tax":10000}]`+"\n" {
+		t.Errorf("Assertion failed: exit code = %d, output = %q", exitCode, stdout.String())
+	}
+	var messages []string
+	decoder := json.NewDecoder(&stderr)
+	for decoder.More() {
+		var record struct {
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("Assertion failed: stderr is not JSON: %v", err)
+		}
+		messages = append(messages, record.Level+" "+record.Msg)
+	}
+	if !strings.Contains(strings.Join(messages, "\n"), "DEBUG tax assessed") {
+		t.Errorf("Assertion failed: traces = %q", messages)
+	}
+}
+
+func TestRun_LogLevelInfoHasNoTraces(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":10000},{"operation":"sell","unit-cost":20.00,"quantity":5000}]` + "\n"
+	var stdout, stderr bytes.Buffer
+
+	exitCode := run(context.Background(), nil, strings.NewReader(input), &stdout, &stderr)
+
+	if exitCode != ExitOK || stderr.Len() != 0 {
+		t.Errorf("Assertion failed: exit code = %d, stderr = %q", exitCode, stderr.String())
+	}
+}
+
+func TestRun_UnknownLogLevelOrFormat(t *testing.T) {
+	for _, args := range [][]string{{"--log-level", "verbose"}, {"--log-format", "xml"}, {"serve", "--log-format", "xml"}} {
+		var stdout, stderr bytes.Buffer
+
+		exitCode := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr)
+
+		if exitCode != ExitUsage || !strings.Contains(stderr.String(), "unknown log") {
+			t.Errorf("Assertion failed: %v: exit code = %d, stderr = %q", args, exitCode, stderr.String())
+		}
+	}
+}
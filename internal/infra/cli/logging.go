@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// logFlags are the --log-level and --log-format flags of a command
+type logFlags struct {
+	level  *string
+	format *string
+}
+
+func addLogFlags(flags *flag.FlagSet) logFlags {
+	return logFlags{
+		level:  flags.String("log-level", "info", "lowest level logged: debug, info, warn or error. debug traces every calculation step"),
+		format: flags.String("log-format", "text", "log format: text or json"),
+	}
+}
+
+// logger returns the logger the flags configure. Logs always go to stderr, so stdout only carries the results
+func (f logFlags) logger(stderr io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*f.level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q, want debug, info, warn or error", *f.level)
+	}
+	options := &slog.HandlerOptions{Level: level}
+	switch *f.format {
+	case "text":
+		return slog.New(slog.NewTextHandler(stderr, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(stderr, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, want text or json", *f.format)
+}
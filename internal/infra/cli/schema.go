@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"io"
+)
+
+// runSchema prints the JSON Schema of the input or output format
+func runSchema(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("capital-gains schema", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: capital-gains schema input|output")
+	}
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	var schema []byte
+	switch flags.Arg(0) {
+	case "input":
+		schema = json.OperationsSchema()
+	case "output":
+		schema = json.TaxesSchema()
+	default:
+		flags.Usage()
+		return ExitUsage
+	}
+
+	if _, err := stdout.Write(schema); err != nil {
+		fmt.Fprintf(stderr, "Error writing schema to stdout: %v\n", err)
+		return ExitLinesFailed
+	}
+	return ExitOK
+}
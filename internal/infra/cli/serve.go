@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/infra/grpcapi"
+	"github.com/andreposman/capital-gains/internal/infra/httpapi"
+	"github.com/andreposman/capital-gains/internal/infra/storage"
+	"io"
+	"net"
+	"time"
+)
+
+// runServe exposes the calculator over HTTP, and gRPC when --grpc-addr is set, until ctx is done, e.g. on
+// SIGTERM or an interrupt, then shuts down gracefully
+func runServe(ctx context.Context, args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("capital-gains serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	addr := flags.String("addr", ":8080", "address to listen on")
+	maxBodyBytes := flags.Int64("max-body-bytes", httpapi.DefaultMaxBodyBytes, "largest request body accepted, in bytes")
+	dataPath := flags.String("data", "", "keep the accounts in this file (default: in memory)")
+	storeKind := flags.String("store", "bolt", "kind of the --data file: bolt or sqlite")
+	grpcAddr := flags.String("grpc-addr", "", "address to serve the gRPC service on (default: disabled)")
+	checkpointEvery := flags.Int("checkpoint-every", application.DefaultCheckpointEvery, "snapshot the account portfolios every N trades, so a cancel or amend only replays from the nearest snapshot")
+	checkpointMonthEnd := flags.Bool("checkpoint-month-end", false, "also snapshot the account portfolios at the end of every month")
+	sessions := flags.Int("sessions", application.DefaultSessionCacheSize, "accounts kept in memory with their snapshots between requests, so their log is not replayed on every request")
+	shutdownTimeout := flags.Duration("shutdown-timeout", 10*time.Second, "how long in-flight requests have to finish on shutdown")
+	logOptions := addLogFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	logger, err := logOptions.logger(stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return ExitUsage
+	}
+
+	accounts, err := openStore(*storeKind, *dataPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error opening %s: %v\n", *dataPath, err)
+		return ExitUsage
+	}
+	defer accounts.Close()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error listening on %s: %v\n", *addr, err)
+		return ExitUsage
+	}
+
+	var grpcListener net.Listener
+	if *grpcAddr != "" {
+		if grpcListener, err = net.Listen("tcp", *grpcAddr); err != nil {
+			listener.Close()
+			fmt.Fprintf(stderr, "Error listening on %s: %v\n", *grpcAddr, err)
+			return ExitUsage
+		}
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	errs := make(chan error, 2)
+	servers := 1
+	if grpcListener != nil {
+		servers++
+		logger.Info("Serving gRPC", "addr", grpcListener.Addr().String())
+		go func() {
+			errs <- grpcapi.Serve(ctx, grpcListener, logger)
+		}()
+	}
+
+	logger.Info("Listening", "addr", listener.Addr().String())
+	server := httpapi.NewServer(httpapi.Options{
+		MaxBodyBytes:       *maxBodyBytes,
+		ShutdownTimeout:    *shutdownTimeout,
+		Accounts:           accounts,
+		CheckpointEvery:    *checkpointEvery,
+		CheckpointMonthEnd: *checkpointMonthEnd,
+		Sessions:           *sessions,
+		Logger:             logger,
+	})
+	go func() {
+		errs <- server.Serve(ctx, listener)
+	}()
+
+	// either server failing stops the other one
+	exitCode := ExitOK
+	for range servers {
+		if err := <-errs; err != nil {
+			logger.Error("Error serving", "err", err)
+			exitCode = ExitLinesFailed
+			stop()
+		}
+	}
+	return exitCode
+}
+
+func openStore(kind, path string) (storage.Store, error) {
+	if path == "" {
+		return storage.NewMemoryStore(), nil
+	}
+	switch kind {
+	case "bolt":
+		return storage.OpenBoltStore(path)
+	case "sqlite":
+		return storage.OpenSQLiteStore(path)
+	}
+	return nil, fmt.Errorf("unknown store %q, want bolt or sqlite", kind)
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/infra/input"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"io"
+)
+
+// runValidate checks every input line against the strict schema without processing it
+func runValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("capital-gains validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	scanner := input.NewLineScanner(stdin)
+	exitCode := ExitOK
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			break
+		}
+
+		issues, err := json.ValidateInput(line)
+		if err != nil {
+			fmt.Fprintf(stdout, "line %d: %v\n", scanner.Line(), err)
+			exitCode = ExitLinesFailed
+			continue
+		}
+
+		for _, issue := range issues {
+			fmt.Fprintf(stdout, "line %d: %s\n", scanner.Line(), issue)
+			exitCode = ExitLinesFailed
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(stderr, "Error reading standard input: %v\n", err)
+		return ExitLinesFailed
+	}
+
+	return exitCode
+}
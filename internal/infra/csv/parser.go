@@ -0,0 +1,304 @@
+package csv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns maps each operation field to the header of the CSV column that holds it.
+// ID, Ticker and Date are optional and ignored when empty
+type Columns struct {
+	ID        string
+	Operation string
+	UnitCost  string
+	Quantity  string
+	Ticker    string
+	Date      string
+}
+
+// Config describes the layout of a broker CSV export
+type Config struct {
+	Columns          Columns
+	Comma            rune   // field delimiter, defaults to ';' when DecimalSeparator is ',' and ',' otherwise
+	DecimalSeparator rune   // '.' or ',', defaults to '.'
+	DateFormat       string // Go time layout of the date column, defaults to json.DateLayout
+}
+
+// DefaultColumns uses the same names as the JSON input
+var DefaultColumns = Columns{
+	ID:        "id",
+	Operation: "operation",
+	UnitCost:  "unit-cost",
+	Quantity:  "quantity",
+	Ticker:    "ticker",
+	Date:      "date",
+}
+
+// sides maps the values brokers use for the operation column to the processor operations
+var sides = map[string]string{
+	"buy":    "buy",
+	"b":      "buy",
+	"c":      "buy",
+	"compra": "buy",
+	"sell":   "sell",
+	"s":      "sell",
+	"v":      "sell",
+	"venda":  "sell",
+}
+
+// ParseError points to the CSV line and column that could not be read
+type ParseError struct {
+	Line   int
+	Column string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: column %q: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseInput reads a CSV file with a header row into operations
+func ParseInput(r io.Reader, config Config) ([]json.Operation, error) {
+	config = withDefaults(config)
+
+	reader := csv.NewReader(r)
+	reader.Comma = config.Comma
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []json.Operation{}, nil
+	}
+	if err != nil {
+		return nil, readError(err, 1)
+	}
+
+	index, err := columnIndex(header, config.Columns)
+	if err != nil {
+		return nil, &ParseError{Line: 1, Err: err}
+	}
+
+	operations := []json.Operation{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, readError(err, line+1)
+		}
+		line, _ = reader.FieldPos(0)
+
+		if isBlank(record) {
+			continue
+		}
+
+		operation, parseErr := parseRecord(record, index, config)
+		if parseErr != nil {
+			parseErr.Line = line
+			return nil, parseErr
+		}
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+// readError turns an error of encoding/csv reading a record, e.g. a bare quote, into a *ParseError at
+// the line the record starts. line is used for the errors that do not have one, e.g. of the reader
+func readError(err error, line int) *ParseError {
+	var syntax *csv.ParseError
+	if errors.As(err, &syntax) {
+		return &ParseError{Line: syntax.StartLine, Err: syntax.Err}
+	}
+	return &ParseError{Line: line, Err: err}
+}
+
+// ParseColumns reads a column mapping such as "operation=Tipo,unit-cost=Preço,quantity=Qtd".
+// Fields that are not listed keep their DefaultColumns name
+func ParseColumns(mapping string) (Columns, error) {
+	columns := DefaultColumns
+	if strings.TrimSpace(mapping) == "" {
+		return columns, nil
+	}
+
+	for _, pair := range strings.Split(mapping, ",") {
+		field, header, ok := strings.Cut(pair, "=")
+		if !ok {
+			return columns, fmt.Errorf("invalid column mapping %q, want field=header", pair)
+		}
+		header = strings.TrimSpace(header)
+
+		switch strings.TrimSpace(field) {
+		case "id":
+			columns.ID = header
+		case "operation":
+			columns.Operation = header
+		case "unit-cost":
+			columns.UnitCost = header
+		case "quantity":
+			columns.Quantity = header
+		case "ticker":
+			columns.Ticker = header
+		case "date":
+			columns.Date = header
+		default:
+			return columns, fmt.Errorf("unknown field %q in column mapping", field)
+		}
+	}
+	return columns, nil
+}
+
+// ParseNumber reads a decimal number written with the given decimal separator,
+// ignoring thousands separators and a leading currency symbol
+func ParseNumber(value string, decimalSeparator rune) (float64, error) {
+	value = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(value), "R$"))
+	if decimalSeparator == ',' {
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.ReplaceAll(value, ",", ".")
+	} else {
+		value = strings.ReplaceAll(value, ",", "")
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+// ParseQuantity reads a whole number of shares, see ParseNumber
+func ParseQuantity(value string, decimalSeparator rune) (int, error) {
+	number, err := ParseNumber(value, decimalSeparator)
+	if err != nil {
+		return 0, err
+	}
+	if number != float64(int(number)) {
+		return 0, fmt.Errorf("%q is not a whole number", value)
+	}
+	return int(number), nil
+}
+
+// ParseSide maps a broker buy/sell marker (C/V, Compra/Venda, buy/sell) to the processor operation
+func ParseSide(value string) (string, error) {
+	side, ok := sides[strings.ToLower(strings.TrimSpace(value))]
+	if !ok {
+		return "", fmt.Errorf("unknown operation %q", value)
+	}
+	return side, nil
+}
+
+func withDefaults(config Config) Config {
+	if config.Columns == (Columns{}) {
+		config.Columns = DefaultColumns
+	}
+	if config.DecimalSeparator == 0 {
+		config.DecimalSeparator = '.'
+	}
+	if config.Comma == 0 {
+		config.Comma = ','
+		if config.DecimalSeparator == ',' {
+			config.Comma = ';'
+		}
+	}
+	if config.DateFormat == "" {
+		config.DateFormat = json.DateLayout
+	}
+	return config
+}
+
+type columnPositions struct {
+	id, operation, unitCost, quantity, ticker, date int
+}
+
+func columnIndex(header []string, columns Columns) (columnPositions, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	find := func(name string, required bool) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := positions[name]
+		if !ok && required {
+			return -1, fmt.Errorf("missing column %q", name)
+		}
+		if !ok {
+			return -1, nil
+		}
+		return i, nil
+	}
+
+	var index columnPositions
+	var errs []error
+	var err error
+	if index.operation, err = find(columns.Operation, true); err != nil {
+		errs = append(errs, err)
+	}
+	if index.unitCost, err = find(columns.UnitCost, true); err != nil {
+		errs = append(errs, err)
+	}
+	if index.quantity, err = find(columns.Quantity, true); err != nil {
+		errs = append(errs, err)
+	}
+	index.id, _ = find(columns.ID, false)
+	index.ticker, _ = find(columns.Ticker, false)
+	index.date, _ = find(columns.Date, false)
+
+	return index, errors.Join(errs...)
+}
+
+func parseRecord(record []string, index columnPositions, config Config) (json.Operation, *ParseError) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var operation json.Operation
+	var err error
+
+	if operation.Operation, err = ParseSide(field(index.operation)); err != nil {
+		return operation, &ParseError{Column: config.Columns.Operation, Err: err}
+	}
+	if operation.UnitCost, err = ParseNumber(field(index.unitCost), config.DecimalSeparator); err != nil {
+		return operation, &ParseError{Column: config.Columns.UnitCost, Err: err}
+	}
+	if operation.Quantity, err = ParseQuantity(field(index.quantity), config.DecimalSeparator); err != nil {
+		return operation, &ParseError{Column: config.Columns.Quantity, Err: err}
+	}
+	operation.ID = field(index.id)
+	operation.Ticker = field(index.ticker)
+
+	if date := field(index.date); date != "" {
+		parsed, err := time.Parse(config.DateFormat, date)
+		if err != nil {
+			return operation, &ParseError{Column: config.Columns.Date, Err: err}
+		}
+		operation.Date = parsed.Format(json.DateLayout)
+	}
+
+	return operation, nil
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package csv
+
+import (
+	"encoding/csv"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInput_DefaultColumns(t *testing.T) {
+	input := "operation,unit-cost,quantity\nbuy,10.00,100\nsell,20.00,50\n"
+	expected := []json.Operation{
+		{Operation: "buy", UnitCost: 10.00, Quantity: 100},
+		{Operation: "sell", UnitCost: 20.00, Quantity: 50},
+	}
+
+	result, err := ParseInput(strings.NewReader(input), Config{})
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Assertion failed: result = %v, want %v", result, expected)
+	}
+}
+
+func TestParseInput_BrazilianBrokerLayout(t *testing.T) {
+	input := "Data;Ativo;C/V;Qtd;Preço;Total\n" +
+		"01/03/2024;PETR4;C;1.000;R$ 35,50;35.500,00\n" +
+		"\n" +
+		"15/03/2024;PETR4;V;500;38,10;19.050,00\n"
+	columns, err := ParseColumns("operation=C/V,unit-cost=Preço,quantity=Qtd,ticker=Ativo,date=Data")
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error parsing the mapping, but got: %v", err)
+	}
+	config := Config{Columns: columns, DecimalSeparator: ',', DateFormat: "02/01/2006"}
+	expected := []json.Operation{
+		{Operation: "buy", UnitCost: 35.50, Quantity: 1000, Ticker: "PETR4", Date: "2024-03-01"},
+		{Operation: "sell", UnitCost: 38.10, Quantity: 500, Ticker: "PETR4", Date: "2024-03-15"},
+	}
+
+	result, err := ParseInput(strings.NewReader(input), config)
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Assertion failed: result = %v, want %v", result, expected)
+	}
+}
+
+func TestParseInput_IDColumn(t *testing.T) {
+	input := "Nota,operation,unit-cost,quantity\n1001,buy,10.00,100\n,sell,20.00,50\n"
+	columns, err := ParseColumns("id=Nota")
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error parsing the mapping, but got: %v", err)
+	}
+	expected := []json.Operation{
+		{ID: "1001", Operation: "buy", UnitCost: 10.00, Quantity: 100},
+		{Operation: "sell", UnitCost: 20.00, Quantity: 50},
+	}
+
+	result, err := ParseInput(strings.NewReader(input), Config{Columns: columns})
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Assertion failed: result = %v, want %v", result, expected)
+	}
+}
+
+func TestParseInput_MissingColumn(t *testing.T) {
+	input := "operation,quantity\nbuy,100\n"
+
+	_, err := ParseInput(strings.NewReader(input), Config{})
+
+	if err == nil || !strings.Contains(err.Error(), `missing column "unit-cost"`) {
+		t.Errorf("Assertion failed: expected a missing column error, but got: %v", err)
+	}
+}
+
+func TestParseInput_InvalidValueReportsLineAndColumn(t *testing.T) {
+	input := "operation,unit-cost,quantity\nbuy,10.00,100\nsell,abc,50\n"
+	var parseError *ParseError
+
+	_, err := ParseInput(strings.NewReader(input), Config{})
+
+	if !errors.As(err, &parseError) {
+		t.Fatalf("Assertion failed: expected *ParseError, but got type %T: %v", err, err)
+	}
+	if parseError.Line != 3 || parseError.Column != "unit-cost" {
+		t.Errorf("Assertion failed: error at line %d column %q, want line 3 column \"unit-cost\"", parseError.Line, parseError.Column)
+	}
+}
+
+func TestParseInput_MalformedRecordReportsLine(t *testing.T) {
+	input := "operation,unit-cost,quantity\nbuy,10.00,100\nsell,\"20.00,50\n"
+	var parseError *ParseError
+
+	_, err := ParseInput(strings.NewReader(input), Config{})
+
+	if !errors.As(err, &parseError) || parseError.Line != 3 {
+		t.Fatalf("Assertion failed: expected *ParseError at line 3, but got type %T: %v", err, err)
+	}
+	if !errors.Is(err, csv.ErrQuote) {
+		t.Errorf("Assertion failed: expected the quote error of encoding/csv, but got: %v", err)
+	}
+}
+
+func TestParseInput_FractionalQuantity(t *testing.T) {
+	input := "operation,unit-cost,quantity\nbuy,10.00,1.5\n"
+
+	_, err := ParseInput(strings.NewReader(input), Config{})
+
+	if err == nil {
+		t.Fatalf("Assertion failed: expected an error for a fractional quantity, but got nil")
+	}
+}
+
+func TestParseColumns_UnknownField(t *testing.T) {
+	_, err := ParseColumns("price=Preço")
+
+	if err == nil {
+		t.Fatalf("Assertion failed: expected an error for an unknown field, but got nil")
+	}
+}
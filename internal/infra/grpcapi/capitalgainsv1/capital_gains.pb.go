@@ -0,0 +1,611 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.35.2
+// 	protoc        (unknown)
+// source: capital_gains.proto
+
+// Capital gains tax calculator. Messages mirror the JSON input and output of the CLI
+
+package capitalgainsv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Operation mirrors an element of the JSON input
+type Operation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Operation string  `protobuf:"bytes,1,opt,name=operation,proto3" json:"operation,omitempty"` // "buy", "sell", "cancel" or "amend"
+	UnitCost  float64 `protobuf:"fixed64,2,opt,name=unit_cost,json=unit-cost,proto3" json:"unit_cost,omitempty"`
+	Quantity  int64   `protobuf:"varint,3,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	Ticker    string  `protobuf:"bytes,4,opt,name=ticker,proto3" json:"ticker,omitempty"` // optional, each ticker keeps its own portfolio
+	Date      string  `protobuf:"bytes,5,opt,name=date,proto3" json:"date,omitempty"`     // optional, YYYY-MM-DD
+	Fees      float64 `protobuf:"fixed64,6,opt,name=fees,proto3" json:"fees,omitempty"`   // optional
+	Id        string  `protobuf:"bytes,7,opt,name=id,proto3" json:"id,omitempty"`         // optional, a re-submitted id returns the current result of the trade
+	Ref       string  `protobuf:"bytes,8,opt,name=ref,proto3" json:"ref,omitempty"`       // id of the operation a cancel or amend corrects
+}
+
+func (x *Operation) Reset() {
+	*x = Operation{}
+	mi := &file_capital_gains_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Operation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Operation) ProtoMessage() {}
+
+func (x *Operation) ProtoReflect() protoreflect.Message {
+	mi := &file_capital_gains_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Operation.ProtoReflect.Descriptor instead.
+func (*Operation) Descriptor() ([]byte, []int) {
+	return file_capital_gains_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Operation) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *Operation) GetUnitCost() float64 {
+	if x != nil {
+		return x.UnitCost
+	}
+	return 0
+}
+
+func (x *Operation) GetQuantity() int64 {
+	if x != nil {
+		return x.Quantity
+	}
+	return 0
+}
+
+func (x *Operation) GetTicker() string {
+	if x != nil {
+		return x.Ticker
+	}
+	return ""
+}
+
+func (x *Operation) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *Operation) GetFees() float64 {
+	if x != nil {
+		return x.Fees
+	}
+	return 0
+}
+
+func (x *Operation) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Operation) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+// Tax mirrors an element of the JSON output. The explanation is set for buys and sells
+type Tax struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Tax         float64       `protobuf:"fixed64,1,opt,name=tax,proto3" json:"tax,omitempty"`
+	Explanation *Explanation  `protobuf:"bytes,2,opt,name=explanation,proto3" json:"explanation,omitempty"`
+	Adjustments []*Adjustment `protobuf:"bytes,3,rep,name=adjustments,proto3" json:"adjustments,omitempty"` // only for a cancel or amend
+}
+
+func (x *Tax) Reset() {
+	*x = Tax{}
+	mi := &file_capital_gains_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Tax) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tax) ProtoMessage() {}
+
+func (x *Tax) ProtoReflect() protoreflect.Message {
+	mi := &file_capital_gains_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tax.ProtoReflect.Descriptor instead.
+func (*Tax) Descriptor() ([]byte, []int) {
+	return file_capital_gains_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Tax) GetTax() float64 {
+	if x != nil {
+		return x.Tax
+	}
+	return 0
+}
+
+func (x *Tax) GetExplanation() *Explanation {
+	if x != nil {
+		return x.Explanation
+	}
+	return nil
+}
+
+func (x *Tax) GetAdjustments() []*Adjustment {
+	if x != nil {
+		return x.Adjustments
+	}
+	return nil
+}
+
+// Adjustment is the change in the tax of an earlier operation recomputed after a cancel or amend
+type Adjustment struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Operation  int64   `protobuf:"varint,1,opt,name=operation,proto3" json:"operation,omitempty"` // 1-based position of the operation whose tax changed
+	Id         string  `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Before     float64 `protobuf:"fixed64,3,opt,name=before,proto3" json:"before,omitempty"`
+	After      float64 `protobuf:"fixed64,4,opt,name=after,proto3" json:"after,omitempty"`
+	Difference float64 `protobuf:"fixed64,5,opt,name=difference,proto3" json:"difference,omitempty"`
+}
+
+func (x *Adjustment) Reset() {
+	*x = Adjustment{}
+	mi := &file_capital_gains_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Adjustment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Adjustment) ProtoMessage() {}
+
+func (x *Adjustment) ProtoReflect() protoreflect.Message {
+	mi := &file_capital_gains_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Adjustment.ProtoReflect.Descriptor instead.
+func (*Adjustment) Descriptor() ([]byte, []int) {
+	return file_capital_gains_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Adjustment) GetOperation() int64 {
+	if x != nil {
+		return x.Operation
+	}
+	return 0
+}
+
+func (x *Adjustment) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Adjustment) GetBefore() float64 {
+	if x != nil {
+		return x.Before
+	}
+	return 0
+}
+
+func (x *Adjustment) GetAfter() float64 {
+	if x != nil {
+		return x.After
+	}
+	return 0
+}
+
+func (x *Adjustment) GetDifference() float64 {
+	if x != nil {
+		return x.Difference
+	}
+	return 0
+}
+
+// Explanation is how the tax of an operation was reached, see --explain
+type Explanation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AverageCostBefore float64 `protobuf:"fixed64,1,opt,name=average_cost_before,json=average-cost-before,proto3" json:"average_cost_before,omitempty"`
+	AverageCostAfter  float64 `protobuf:"fixed64,2,opt,name=average_cost_after,json=average-cost-after,proto3" json:"average_cost_after,omitempty"`
+	SaleValue         float64 `protobuf:"fixed64,3,opt,name=sale_value,json=sale-value,proto3" json:"sale_value,omitempty"`
+	GrossProfit       float64 `protobuf:"fixed64,4,opt,name=gross_profit,json=gross-profit,proto3" json:"gross_profit,omitempty"`
+	LossUsed          float64 `protobuf:"fixed64,5,opt,name=loss_used,json=loss-used,proto3" json:"loss_used,omitempty"`
+	LossAdded         float64 `protobuf:"fixed64,6,opt,name=loss_added,json=loss-added,proto3" json:"loss_added,omitempty"`
+	TaxableBase       float64 `protobuf:"fixed64,7,opt,name=taxable_base,json=taxable-base,proto3" json:"taxable_base,omitempty"`
+	Rate              float64 `protobuf:"fixed64,8,opt,name=rate,proto3" json:"rate,omitempty"`
+	Reason            string  `protobuf:"bytes,9,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (x *Explanation) Reset() {
+	*x = Explanation{}
+	mi := &file_capital_gains_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Explanation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Explanation) ProtoMessage() {}
+
+func (x *Explanation) ProtoReflect() protoreflect.Message {
+	mi := &file_capital_gains_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Explanation.ProtoReflect.Descriptor instead.
+func (*Explanation) Descriptor() ([]byte, []int) {
+	return file_capital_gains_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Explanation) GetAverageCostBefore() float64 {
+	if x != nil {
+		return x.AverageCostBefore
+	}
+	return 0
+}
+
+func (x *Explanation) GetAverageCostAfter() float64 {
+	if x != nil {
+		return x.AverageCostAfter
+	}
+	return 0
+}
+
+func (x *Explanation) GetSaleValue() float64 {
+	if x != nil {
+		return x.SaleValue
+	}
+	return 0
+}
+
+func (x *Explanation) GetGrossProfit() float64 {
+	if x != nil {
+		return x.GrossProfit
+	}
+	return 0
+}
+
+func (x *Explanation) GetLossUsed() float64 {
+	if x != nil {
+		return x.LossUsed
+	}
+	return 0
+}
+
+func (x *Explanation) GetLossAdded() float64 {
+	if x != nil {
+		return x.LossAdded
+	}
+	return 0
+}
+
+func (x *Explanation) GetTaxableBase() float64 {
+	if x != nil {
+		return x.TaxableBase
+	}
+	return 0
+}
+
+func (x *Explanation) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *Explanation) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type CalculateRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Operations []*Operation `protobuf:"bytes,1,rep,name=operations,proto3" json:"operations,omitempty"`
+}
+
+func (x *CalculateRequest) Reset() {
+	*x = CalculateRequest{}
+	mi := &file_capital_gains_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateRequest) ProtoMessage() {}
+
+func (x *CalculateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_capital_gains_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateRequest.ProtoReflect.Descriptor instead.
+func (*CalculateRequest) Descriptor() ([]byte, []int) {
+	return file_capital_gains_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CalculateRequest) GetOperations() []*Operation {
+	if x != nil {
+		return x.Operations
+	}
+	return nil
+}
+
+type CalculateResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Taxes []*Tax `protobuf:"bytes,1,rep,name=taxes,proto3" json:"taxes,omitempty"`
+}
+
+func (x *CalculateResponse) Reset() {
+	*x = CalculateResponse{}
+	mi := &file_capital_gains_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculateResponse) ProtoMessage() {}
+
+func (x *CalculateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_capital_gains_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculateResponse.ProtoReflect.Descriptor instead.
+func (*CalculateResponse) Descriptor() ([]byte, []int) {
+	return file_capital_gains_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CalculateResponse) GetTaxes() []*Tax {
+	if x != nil {
+		return x.Taxes
+	}
+	return nil
+}
+
+var File_capital_gains_proto protoreflect.FileDescriptor
+
+var file_capital_gains_proto_rawDesc = []byte{
+	0x0a, 0x13, 0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c, 0x5f, 0x67, 0x61, 0x69, 0x6e, 0x73, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0f, 0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c, 0x67, 0x61,
+	0x69, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x22, 0xc5, 0x01, 0x0a, 0x09, 0x4f, 0x70, 0x65, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x75, 0x6e, 0x69, 0x74, 0x5f, 0x63, 0x6f, 0x73, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x75, 0x6e, 0x69, 0x74, 0x2d, 0x63, 0x6f, 0x73, 0x74,
+	0x12, 0x1a, 0x0a, 0x08, 0x71, 0x75, 0x61, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x08, 0x71, 0x75, 0x61, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x12, 0x16, 0x0a, 0x06,
+	0x74, 0x69, 0x63, 0x6b, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x69,
+	0x63, 0x6b, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x65, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x64, 0x61, 0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x65, 0x65, 0x73,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x66, 0x65, 0x65, 0x73, 0x12, 0x0e, 0x0a, 0x02,
+	0x69, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x10, 0x0a, 0x03,
+	0x72, 0x65, 0x66, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x72, 0x65, 0x66, 0x22, 0x96,
+	0x01, 0x0a, 0x03, 0x54, 0x61, 0x78, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x61, 0x78, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x01, 0x52, 0x03, 0x74, 0x61, 0x78, 0x12, 0x3e, 0x0a, 0x0b, 0x65, 0x78, 0x70, 0x6c,
+	0x61, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1c, 0x2e,
+	0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c, 0x67, 0x61, 0x69, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e,
+	0x45, 0x78, 0x70, 0x6c, 0x61, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0b, 0x65, 0x78, 0x70,
+	0x6c, 0x61, 0x6e, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x3d, 0x0a, 0x0b, 0x61, 0x64, 0x6a, 0x75,
+	0x73, 0x74, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e,
+	0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c, 0x67, 0x61, 0x69, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e,
+	0x41, 0x64, 0x6a, 0x75, 0x73, 0x74, 0x6d, 0x65, 0x6e, 0x74, 0x52, 0x0b, 0x61, 0x64, 0x6a, 0x75,
+	0x73, 0x74, 0x6d, 0x65, 0x6e, 0x74, 0x73, 0x22, 0x88, 0x01, 0x0a, 0x0a, 0x41, 0x64, 0x6a, 0x75,
+	0x73, 0x74, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x6f, 0x70, 0x65, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x6f, 0x70, 0x65, 0x72, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x02, 0x69, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x01, 0x52, 0x06, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x61, 0x66, 0x74, 0x65, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x61, 0x66, 0x74,
+	0x65, 0x72, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x69, 0x66, 0x66, 0x65, 0x72, 0x65, 0x6e, 0x63, 0x65,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x64, 0x69, 0x66, 0x66, 0x65, 0x72, 0x65, 0x6e,
+	0x63, 0x65, 0x22, 0xc1, 0x02, 0x0a, 0x0b, 0x45, 0x78, 0x70, 0x6c, 0x61, 0x6e, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x12, 0x30, 0x0a, 0x13, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x5f, 0x63, 0x6f,
+	0x73, 0x74, 0x5f, 0x62, 0x65, 0x66, 0x6f, 0x72, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x13, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x2d, 0x63, 0x6f, 0x73, 0x74, 0x2d, 0x62, 0x65,
+	0x66, 0x6f, 0x72, 0x65, 0x12, 0x2e, 0x0a, 0x12, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x5f,
+	0x63, 0x6f, 0x73, 0x74, 0x5f, 0x61, 0x66, 0x74, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x12, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65, 0x2d, 0x63, 0x6f, 0x73, 0x74, 0x2d, 0x61,
+	0x66, 0x74, 0x65, 0x72, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x61, 0x6c, 0x65, 0x5f, 0x76, 0x61, 0x6c,
+	0x75, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x73, 0x61, 0x6c, 0x65, 0x2d, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x67, 0x72, 0x6f, 0x73, 0x73, 0x5f, 0x70, 0x72,
+	0x6f, 0x66, 0x69, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0c, 0x67, 0x72, 0x6f, 0x73,
+	0x73, 0x2d, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x6c, 0x6f, 0x73, 0x73,
+	0x5f, 0x75, 0x73, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x6c, 0x6f, 0x73,
+	0x73, 0x2d, 0x75, 0x73, 0x65, 0x64, 0x12, 0x1e, 0x0a, 0x0a, 0x6c, 0x6f, 0x73, 0x73, 0x5f, 0x61,
+	0x64, 0x64, 0x65, 0x64, 0x18, 0x06, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0a, 0x6c, 0x6f, 0x73, 0x73,
+	0x2d, 0x61, 0x64, 0x64, 0x65, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x74, 0x61, 0x78, 0x61, 0x62, 0x6c,
+	0x65, 0x5f, 0x62, 0x61, 0x73, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0c, 0x74, 0x61,
+	0x78, 0x61, 0x62, 0x6c, 0x65, 0x2d, 0x62, 0x61, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x72, 0x61,
+	0x74, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x72, 0x61, 0x74, 0x65, 0x12, 0x16,
+	0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x4e, 0x0a, 0x10, 0x43, 0x61, 0x6c, 0x63, 0x75, 0x6c,
+	0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x3a, 0x0a, 0x0a, 0x6f, 0x70,
+	0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c, 0x67, 0x61, 0x69, 0x6e, 0x73, 0x2e, 0x76, 0x31,
+	0x2e, 0x4f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x0a, 0x6f, 0x70, 0x65, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x22, 0x3f, 0x0a, 0x11, 0x43, 0x61, 0x6c, 0x63, 0x75, 0x6c,
+	0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2a, 0x0a, 0x05, 0x74,
+	0x61, 0x78, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x63, 0x61, 0x70,
+	0x69, 0x74, 0x61, 0x6c, 0x67, 0x61, 0x69, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x61, 0x78,
+	0x52, 0x05, 0x74, 0x61, 0x78, 0x65, 0x73, 0x32, 0xa2, 0x01, 0x0a, 0x0c, 0x43, 0x61, 0x70, 0x69,
+	0x74, 0x61, 0x6c, 0x47, 0x61, 0x69, 0x6e, 0x73, 0x12, 0x52, 0x0a, 0x09, 0x43, 0x61, 0x6c, 0x63,
+	0x75, 0x6c, 0x61, 0x74, 0x65, 0x12, 0x21, 0x2e, 0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c, 0x67,
+	0x61, 0x69, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x61, 0x6c, 0x63, 0x75, 0x6c, 0x61, 0x74,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x22, 0x2e, 0x63, 0x61, 0x70, 0x69, 0x74,
+	0x61, 0x6c, 0x67, 0x61, 0x69, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x61, 0x6c, 0x63, 0x75,
+	0x6c, 0x61, 0x74, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3e, 0x0a, 0x06,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x1a, 0x2e, 0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c,
+	0x67, 0x61, 0x69, 0x6e, 0x73, 0x2e, 0x76, 0x31, 0x2e, 0x4f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x1a, 0x14, 0x2e, 0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c, 0x67, 0x61, 0x69, 0x6e,
+	0x73, 0x2e, 0x76, 0x31, 0x2e, 0x54, 0x61, 0x78, 0x28, 0x01, 0x30, 0x01, 0x42, 0x4c, 0x5a, 0x4a,
+	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6e, 0x64, 0x72, 0x65,
+	0x70, 0x6f, 0x73, 0x6d, 0x61, 0x6e, 0x2f, 0x63, 0x61, 0x70, 0x69, 0x74, 0x61, 0x6c, 0x2d, 0x67,
+	0x61, 0x69, 0x6e, 0x73, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x69, 0x6e,
+	0x66, 0x72, 0x61, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x61, 0x70, 0x69, 0x2f, 0x63, 0x61, 0x70, 0x69,
+	0x74, 0x61, 0x6c, 0x67, 0x61, 0x69, 0x6e, 0x73, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
+}
+
+var (
+	file_capital_gains_proto_rawDescOnce sync.Once
+	file_capital_gains_proto_rawDescData = file_capital_gains_proto_rawDesc
+)
+
+func file_capital_gains_proto_rawDescGZIP() []byte {
+	file_capital_gains_proto_rawDescOnce.Do(func() {
+		file_capital_gains_proto_rawDescData = protoimpl.X.CompressGZIP(file_capital_gains_proto_rawDescData)
+	})
+	return file_capital_gains_proto_rawDescData
+}
+
+var file_capital_gains_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_capital_gains_proto_goTypes = []any{
+	(*Operation)(nil),         // 0: capitalgains.v1.Operation
+	(*Tax)(nil),               // 1: capitalgains.v1.Tax
+	(*Adjustment)(nil),        // 2: capitalgains.v1.Adjustment
+	(*Explanation)(nil),       // 3: capitalgains.v1.Explanation
+	(*CalculateRequest)(nil),  // 4: capitalgains.v1.CalculateRequest
+	(*CalculateResponse)(nil), // 5: capitalgains.v1.CalculateResponse
+}
+var file_capital_gains_proto_depIdxs = []int32{
+	3, // 0: capitalgains.v1.Tax.explanation:type_name -> capitalgains.v1.Explanation
+	2, // 1: capitalgains.v1.Tax.adjustments:type_name -> capitalgains.v1.Adjustment
+	0, // 2: capitalgains.v1.CalculateRequest.operations:type_name -> capitalgains.v1.Operation
+	1, // 3: capitalgains.v1.CalculateResponse.taxes:type_name -> capitalgains.v1.Tax
+	4, // 4: capitalgains.v1.CapitalGains.Calculate:input_type -> capitalgains.v1.CalculateRequest
+	0, // 5: capitalgains.v1.CapitalGains.Stream:input_type -> capitalgains.v1.Operation
+	5, // 6: capitalgains.v1.CapitalGains.Calculate:output_type -> capitalgains.v1.CalculateResponse
+	1, // 7: capitalgains.v1.CapitalGains.Stream:output_type -> capitalgains.v1.Tax
+	6, // [6:8] is the sub-list for method output_type
+	4, // [4:6] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_capital_gains_proto_init() }
+func file_capital_gains_proto_init() {
+	if File_capital_gains_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_capital_gains_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   6,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_capital_gains_proto_goTypes,
+		DependencyIndexes: file_capital_gains_proto_depIdxs,
+		MessageInfos:      file_capital_gains_proto_msgTypes,
+	}.Build()
+	File_capital_gains_proto = out.File
+	file_capital_gains_proto_rawDesc = nil
+	file_capital_gains_proto_goTypes = nil
+	file_capital_gains_proto_depIdxs = nil
+}
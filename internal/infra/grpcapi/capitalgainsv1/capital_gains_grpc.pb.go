@@ -0,0 +1,162 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: capital_gains.proto
+
+// Capital gains tax calculator. Messages mirror the JSON input and output of the CLI
+
+package capitalgainsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CapitalGains_Calculate_FullMethodName = "/capitalgains.v1.CapitalGains/Calculate"
+	CapitalGains_Stream_FullMethodName    = "/capitalgains.v1.CapitalGains/Stream"
+)
+
+// CapitalGainsClient is the client API for CapitalGains service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CapitalGainsClient interface {
+	// Calculate returns the tax of each operation, the same as one line of the CLI input
+	Calculate(ctx context.Context, in *CalculateRequest, opts ...grpc.CallOption) (*CalculateResponse, error)
+	// Stream processes operations as they arrive against portfolios kept for the whole stream
+	// and sends back the tax of each one, in order
+	Stream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Operation, Tax], error)
+}
+
+type capitalGainsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCapitalGainsClient(cc grpc.ClientConnInterface) CapitalGainsClient {
+	return &capitalGainsClient{cc}
+}
+
+func (c *capitalGainsClient) Calculate(ctx context.Context, in *CalculateRequest, opts ...grpc.CallOption) (*CalculateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CalculateResponse)
+	err := c.cc.Invoke(ctx, CapitalGains_Calculate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *capitalGainsClient) Stream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Operation, Tax], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CapitalGains_ServiceDesc.Streams[0], CapitalGains_Stream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Operation, Tax]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CapitalGains_StreamClient = grpc.BidiStreamingClient[Operation, Tax]
+
+// CapitalGainsServer is the server API for CapitalGains service.
+// All implementations must embed UnimplementedCapitalGainsServer
+// for forward compatibility.
+type CapitalGainsServer interface {
+	// Calculate returns the tax of each operation, the same as one line of the CLI input
+	Calculate(context.Context, *CalculateRequest) (*CalculateResponse, error)
+	// Stream processes operations as they arrive against portfolios kept for the whole stream
+	// and sends back the tax of each one, in order
+	Stream(grpc.BidiStreamingServer[Operation, Tax]) error
+	mustEmbedUnimplementedCapitalGainsServer()
+}
+
+// UnimplementedCapitalGainsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCapitalGainsServer struct{}
+
+func (UnimplementedCapitalGainsServer) Calculate(context.Context, *CalculateRequest) (*CalculateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Calculate not implemented")
+}
+func (UnimplementedCapitalGainsServer) Stream(grpc.BidiStreamingServer[Operation, Tax]) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedCapitalGainsServer) mustEmbedUnimplementedCapitalGainsServer() {}
+func (UnimplementedCapitalGainsServer) testEmbeddedByValue()                      {}
+
+// UnsafeCapitalGainsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CapitalGainsServer will
+// result in compilation errors.
+type UnsafeCapitalGainsServer interface {
+	mustEmbedUnimplementedCapitalGainsServer()
+}
+
+func RegisterCapitalGainsServer(s grpc.ServiceRegistrar, srv CapitalGainsServer) {
+	// If the following call pancis, it indicates UnimplementedCapitalGainsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CapitalGains_ServiceDesc, srv)
+}
+
+func _CapitalGains_Calculate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalculateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CapitalGainsServer).Calculate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CapitalGains_Calculate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CapitalGainsServer).Calculate(ctx, req.(*CalculateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CapitalGains_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CapitalGainsServer).Stream(&grpc.GenericServerStream[Operation, Tax]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CapitalGains_StreamServer = grpc.BidiStreamingServer[Operation, Tax]
+
+// CapitalGains_ServiceDesc is the grpc.ServiceDesc for CapitalGains service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CapitalGains_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "capitalgains.v1.CapitalGains",
+	HandlerType: (*CapitalGainsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Calculate",
+			Handler:    _CapitalGains_Calculate_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _CapitalGains_Stream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "capital_gains.proto",
+}
@@ -0,0 +1,184 @@
+package grpcapi
+
+//go:generate protoc -I capitalgainsv1 --go_out=capitalgainsv1 --go_opt=paths=source_relative --go-grpc_out=capitalgainsv1 --go-grpc_opt=paths=source_relative capitalgainsv1/capital_gains.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	pb "github.com/andreposman/capital-gains/internal/infra/grpcapi/capitalgainsv1"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+)
+
+// Server implements the CapitalGains service with OperationProcessor
+type Server struct {
+	pb.UnimplementedCapitalGainsServer
+	Logger *slog.Logger // receives the debug traces of the processing, slog.Default when nil
+}
+
+// Serve registers the service on a new gRPC server and serves listener until ctx is done,
+// then stops gracefully, letting in-flight calls finish
+func Serve(ctx context.Context, listener net.Listener, logger *slog.Logger) error {
+	server := grpc.NewServer()
+	pb.RegisterCapitalGainsServer(server, &Server{Logger: logger})
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	server.GracefulStop()
+	return <-errs
+}
+
+func (s *Server) Calculate(ctx context.Context, request *pb.CalculateRequest) (*pb.CalculateResponse, error) {
+	operations := make([]json.Operation, len(request.Operations))
+	for i, operation := range request.Operations {
+		operations[i] = fromProto(operation)
+	}
+	if issues := json.ValidateOperations(operations); len(issues) > 0 {
+		return nil, validationStatus(issues)
+	}
+
+	processor := application.OperationProcessor{Explain: true, Logger: s.Logger}
+	results, err := processor.ProcessOperations(ctx, json.ToApplication(operations))
+	if err != nil {
+		return nil, processingStatus(err)
+	}
+
+	response := &pb.CalculateResponse{Taxes: make([]*pb.Tax, len(results))}
+	for i, result := range results {
+		response.Taxes[i] = toProto(result)
+	}
+	return response, nil
+}
+
+// Stream processes every operation as it arrives. The first invalid or rejected operation ends the stream
+func (s *Server) Stream(stream pb.CapitalGains_StreamServer) error {
+	processor := application.OperationProcessor{Explain: true, Logger: s.Logger}
+	session := processor.NewSession()
+
+	for index := 0; ; index++ {
+		message, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		operation := fromProto(message)
+		if issues := json.ValidateOperations([]json.Operation{operation}); len(issues) > 0 {
+			// paths are relative to the single operation validated, point them to its position in the stream
+			for i := range issues {
+				issues[i].Path = fmt.Sprintf("[%d]", index) + strings.TrimPrefix(issues[i].Path, "[0]")
+			}
+			return validationStatus(issues)
+		}
+
+		result, err := session.Process(stream.Context(), json.ToApplication([]json.Operation{operation})[0])
+		if err != nil {
+			return processingStatus(err)
+		}
+		if err := stream.Send(toProto(result)); err != nil {
+			return err
+		}
+	}
+}
+
+func fromProto(operation *pb.Operation) json.Operation {
+	return json.Operation{
+		ID:        operation.Id,
+		Operation: operation.Operation,
+		UnitCost:  operation.UnitCost,
+		Quantity:  int(operation.Quantity),
+		Ticker:    operation.Ticker,
+		Date:      operation.Date,
+		Fees:      operation.Fees,
+		Ref:       operation.Ref,
+	}
+}
+
+func toProto(tax domain.Tax) *pb.Tax {
+	result := &pb.Tax{Tax: tax.Tax}
+	if explanation := tax.Explanation; explanation != nil {
+		result.Explanation = &pb.Explanation{
+			AverageCostBefore: explanation.AverageCostBefore,
+			AverageCostAfter:  explanation.AverageCostAfter,
+			SaleValue:         explanation.SaleValue,
+			GrossProfit:       explanation.GrossProfit,
+			LossUsed:          explanation.LossUsed,
+			LossAdded:         explanation.LossAdded,
+			TaxableBase:       explanation.TaxableBase,
+			Rate:              explanation.Rate,
+			Reason:            explanation.Reason,
+		}
+	}
+	for _, adjustment := range tax.Adjustments {
+		result.Adjustments = append(result.Adjustments, &pb.Adjustment{
+			Operation:  int64(adjustment.Operation),
+			Id:         adjustment.ID,
+			Before:     adjustment.Before,
+			After:      adjustment.After,
+			Difference: adjustment.Difference,
+		})
+	}
+	return result
+}
+
+// validationStatus is InvalidArgument with every issue as a field violation
+func validationStatus(issues json.ValidationErrors) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, issue := range issues {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       issue.Path,
+			Description: issue.Message,
+		})
+	}
+	st, err := status.New(codes.InvalidArgument, "invalid operations: "+issues.Error()).WithDetails(badRequest)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid operations: "+issues.Error())
+	}
+	return st.Err()
+}
+
+// processingStatus is InvalidArgument for operations their handler rejects, FailedPrecondition for operations
+// the portfolio rejected, NotFound for corrections of an unknown id, AlreadyExists for an id reused for
+// a different operation and Canceled or DeadlineExceeded when the call ended while it was processed
+func processingStatus(err error) error {
+	if issues := json.OperationIssues(err); issues != nil {
+		return validationStatus(issues)
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	if errors.Is(err, domain.ErrInsufficientShares) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if errors.Is(err, application.ErrUnknownReference) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	var conflictError *application.ConflictError
+	if errors.As(err, &conflictError) {
+		return status.Error(codes.AlreadyExists, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
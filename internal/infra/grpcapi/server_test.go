@@ -0,0 +1,187 @@
+package grpcapi
+
+import (
+	"context"
+	pb "github.com/andreposman/capital-gains/internal/infra/grpcapi/capitalgainsv1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"io"
+	"net"
+	"testing"
+)
+
+// newClient serves the service on an in-process bufconn listener for the duration of the test
+func newClient(t *testing.T) pb.CapitalGainsClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, listener, nil) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Assertion failed: dial: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Assertion failed: Serve returned %v", err)
+		}
+	})
+	return pb.NewCapitalGainsClient(conn)
+}
+
+func operation(kind string, unitCost float64, quantity int64) *pb.Operation {
+	return &pb.Operation{Operation: kind, UnitCost: unitCost, Quantity: quantity}
+}
+
+func TestCalculate(t *testing.T) {
+	client := newClient(t)
+
+	response, err := client.Calculate(context.Background(), &pb.CalculateRequest{Operations: []*pb.Operation{
+		operation("buy", 10.00, 10000),
+		operation("sell", 20.00, 5000),
+	}})
+
+	if err != nil {
+		t.Fatalf("Assertion failed: Calculate returned %v", err)
+	}
+	if len(response.Taxes) != 2 || response.Taxes[0].Tax != 0 || response.Taxes[1].Tax != 10000 {
+		t.Errorf("Assertion failed: taxes = %v, want [0 10000]", response.Taxes)
+	}
+	if reason := response.Taxes[1].Explanation.GetReason(); reason != "TAXED_PROFIT" {
+		t.Errorf("Assertion failed: reason = %q, want TAXED_PROFIT", reason)
+	}
+}
+
+func TestCalculate_Amend(t *testing.T) {
+	client := newClient(t)
+	buy := operation("buy", 10.00, 10000)
+	buy.Id = "b1"
+
+	response, err := client.Calculate(context.Background(), &pb.CalculateRequest{Operations: []*pb.Operation{
+		buy,
+		operation("sell", 20.00, 5000),
+		{Operation: "amend", Ref: "b1", UnitCost: 15.00, Quantity: 10000},
+	}})
+
+	if err != nil {
+		t.Fatalf("Assertion failed: Calculate returned %v", err)
+	}
+	adjustments := response.Taxes[2].Adjustments
+	if len(adjustments) != 1 || adjustments[0].Operation != 2 || adjustments[0].Difference != -5000 {
+		t.Errorf("Assertion failed: adjustments = %v, want the sale 5000 lower", adjustments)
+	}
+}
+
+func TestCalculate_InvalidOperation(t *testing.T) {
+	client := newClient(t)
+
+	_, err := client.Calculate(context.Background(), &pb.CalculateRequest{Operations: []*pb.Operation{
+		operation("hold", 10.00, 100),
+	}})
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Assertion failed: code = %s, want %s", st.Code(), codes.InvalidArgument)
+	}
+	if len(st.Details()) != 1 {
+		t.Fatalf("Assertion failed: details = %v, want one BadRequest", st.Details())
+	}
+	violations := st.Details()[0].(*errdetails.BadRequest).FieldViolations
+	if len(violations) != 1 || violations[0].Field != "[0].operation" {
+		t.Errorf("Assertion failed: violations = %v", violations)
+	}
+}
+
+func TestCalculate_InsufficientShares(t *testing.T) {
+	client := newClient(t)
+
+	_, err := client.Calculate(context.Background(), &pb.CalculateRequest{Operations: []*pb.Operation{
+		operation("buy", 10.00, 100),
+		operation("sell", 10.00, 200),
+	}})
+
+	if code := status.Code(err); code != codes.FailedPrecondition {
+		t.Errorf("Assertion failed: code = %s, want %s (%v)", code, codes.FailedPrecondition, err)
+	}
+}
+
+func TestStream_KeepsPortfolioBetweenOperations(t *testing.T) {
+	client := newClient(t)
+	stream, err := client.Stream(context.Background())
+	if err != nil {
+		t.Fatalf("Assertion failed: Stream returned %v", err)
+	}
+
+	operations := []*pb.Operation{
+		operation("buy", 10.00, 10000),
+		operation("sell", 5.00, 5000),  // Loss 25k
+		operation("sell", 20.00, 3000), // Profit 30k - 25k = 5k -> Tax 1k
+	}
+	expected := []float64{0, 0, 1000}
+
+	// each tax comes back before the next operation is sent
+	for i, message := range operations {
+		if err := stream.Send(message); err != nil {
+			t.Fatalf("Assertion failed: Send returned %v", err)
+		}
+		tax, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Assertion failed: Recv returned %v", err)
+		}
+		if tax.Tax != expected[i] {
+			t.Errorf("Assertion failed: operation %d tax = %v, want %v", i+1, tax.Tax, expected[i])
+		}
+	}
+
+	stream.CloseSend()
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Assertion failed: expected the stream to end, got %v", err)
+	}
+}
+
+func TestStream_InvalidOperationEndsStream(t *testing.T) {
+	client := newClient(t)
+	stream, _ := client.Stream(context.Background())
+
+	stream.Send(operation("buy", 10.00, 100))
+	stream.Recv()
+	stream.Send(operation("buy", -1, 100))
+	_, err := stream.Recv()
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("Assertion failed: code = %s, want %s", st.Code(), codes.InvalidArgument)
+	}
+	violations := st.Details()[0].(*errdetails.BadRequest).FieldViolations
+	if violations[0].Field != "[1].unit-cost" {
+		t.Errorf("Assertion failed: field = %q, want the position in the stream", violations[0].Field)
+	}
+}
+
+func TestStream_ReusedIDConflicts(t *testing.T) {
+	client := newClient(t)
+	stream, _ := client.Stream(context.Background())
+
+	first := operation("buy", 10.00, 100)
+	first.Id = "t-1"
+	second := operation("buy", 12.00, 100)
+	second.Id = "t-1"
+	stream.Send(first)
+	stream.Recv()
+	stream.Send(second)
+	_, err := stream.Recv()
+
+	if code := status.Code(err); code != codes.AlreadyExists {
+		t.Errorf("Assertion failed: code = %s, want %s", code, codes.AlreadyExists)
+	}
+}
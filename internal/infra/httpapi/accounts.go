@@ -0,0 +1,123 @@
+package httpapi
+
+import (
+	"errors"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"net/http"
+	"sort"
+)
+
+// AccountBody is the response of GET /accounts/{id}
+type AccountBody struct {
+	ID         string         `json:"id"`
+	Operations int            `json:"operations"`
+	Positions  []PositionBody `json:"positions"`
+}
+
+// PositionBody is the position and loss balance of one ticker, empty for operations without a ticker
+type PositionBody struct {
+	Ticker          string  `json:"ticker"`
+	Quantity        int     `json:"quantity"`
+	AverageCost     float64 `json:"average-cost"`
+	AccumulatedLoss float64 `json:"accumulated-loss"`
+}
+
+// RecordBody is an element of the response of GET /accounts/{id}/operations
+type RecordBody struct {
+	Sequence  int            `json:"sequence"` // 1-based position in the account
+	Operation json.Operation `json:"operation"`
+	Result    domain.Tax     `json:"result"`
+	Position  PositionBody   `json:"position"` // position of the ticker right after the operation
+}
+
+// handleAppend processes the operations after the ones already sent to the account and returns their taxes.
+// When an operation is rejected none of them are kept
+func (s *Server) handleAppend(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	operations, err := json.ParseInputStrict(body)
+	if err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+
+	processor := application.OperationProcessor{
+		Explain:            r.URL.Query().Get("explain") == "true",
+		Logger:             s.options.Logger,
+		CheckpointEvery:    s.options.CheckpointEvery,
+		CheckpointMonthEnd: s.options.CheckpointMonthEnd,
+		Sessions:           s.sessions,
+	}
+	results, err := processor.AppendTo(r.Context(), s.options.Accounts, r.PathValue("id"), json.ToApplication(operations))
+	if err != nil {
+		var operationError *application.OperationError
+		if errors.As(err, &operationError) || r.Context().Err() != nil {
+			s.writeProcessingError(w, err)
+			return
+		}
+		s.logger().Error("Error saving account", "account", r.PathValue("id"), "err", err)
+		s.writeJSON(w, http.StatusInternalServerError, ErrorBody{Error: "could not save the account"})
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	account, err := s.options.Accounts.Get(r.PathValue("id"))
+	if errors.Is(err, application.ErrAccountNotFound) {
+		s.writeJSON(w, http.StatusNotFound, ErrorBody{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		s.logger().Error("Error loading account", "account", r.PathValue("id"), "err", err)
+		s.writeJSON(w, http.StatusInternalServerError, ErrorBody{Error: "could not load the account"})
+		return
+	}
+
+	response := AccountBody{ID: account.ID, Operations: account.Operations, Positions: []PositionBody{}}
+	for ticker, state := range account.Portfolios {
+		response.Positions = append(response.Positions, position(ticker, state))
+	}
+	sort.Slice(response.Positions, func(i, j int) bool { return response.Positions[i].Ticker < response.Positions[j].Ticker })
+
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+// handleHistory returns every operation of the account with its result, oldest first
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	records, err := s.options.Accounts.History(r.PathValue("id"))
+	if errors.Is(err, application.ErrAccountNotFound) {
+		s.writeJSON(w, http.StatusNotFound, ErrorBody{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		s.logger().Error("Error loading the history of account", "account", r.PathValue("id"), "err", err)
+		s.writeJSON(w, http.StatusInternalServerError, ErrorBody{Error: "could not load the account"})
+		return
+	}
+
+	response := make([]RecordBody, len(records))
+	for i, record := range records {
+		response[i] = RecordBody{
+			Sequence:  record.Sequence,
+			Operation: json.FromApplication(record.Operation),
+			Result:    record.Tax,
+			Position:  position(record.Operation.Ticker, record.Portfolio),
+		}
+	}
+	s.writeJSON(w, http.StatusOK, response)
+}
+
+func position(ticker string, state domain.PortfolioState) PositionBody {
+	return PositionBody{
+		Ticker:          ticker,
+		Quantity:        state.TotalShares,
+		AverageCost:     state.AverageCost,
+		AccumulatedLoss: state.AccumulatedLoss,
+	}
+}
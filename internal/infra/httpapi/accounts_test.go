@@ -0,0 +1,181 @@
+package httpapi
+
+import (
+	"github.com/andreposman/capital-gains/internal/infra/storage"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func get(t *testing.T, server *Server, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func TestAccounts_AppendKeepsState(t *testing.T) {
+	server := NewServer(Options{})
+
+	post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":10000,"ticker":"PETR4"},{"operation":"sell","unit-cost":5.00,"quantity":5000,"ticker":"PETR4"}]`)
+	response := post(t, server, "/accounts/alice/operations", `[{"operation":"sell","unit-cost":20.00,"quantity":2500,"ticker":"PETR4"}]`)
+
+	// profit 25k - 25k of loss from the first request
+	if response.Code != http.StatusOK || response.Body.String() != "[{\"tax\":0}]\n" {
+		t.Errorf("Assertion failed: status = %d, body = %q", response.Code, response.Body.String())
+	}
+
+	account := get(t, server, "/accounts/alice")
+	expected := `{"id":"alice","operations":3,"positions":[{"ticker":"PETR4","quantity":2500,"average-cost":10,"accumulated-loss":0}]}` + "\n"
+	if account.Code != http.StatusOK || account.Body.String() != expected {
+		t.Errorf("Assertion failed: status = %d, body = %q, want %q", account.Code, account.Body.String(), expected)
+	}
+}
+
+func TestAccounts_AccountsAreIndependent(t *testing.T) {
+	server := NewServer(Options{})
+
+	post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":100}]`)
+	response := post(t, server, "/accounts/bob/operations", `[{"operation":"sell","unit-cost":10.00,"quantity":100}]`)
+
+	if response.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Assertion failed: status = %d, want %d", response.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestAccounts_RejectedRequestIsNotKept(t *testing.T) {
+	server := NewServer(Options{})
+	post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":100}]`)
+
+	response := post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":100},{"operation":"sell","unit-cost":10.00,"quantity":500}]`)
+
+	expected := `{"error":"insufficient shares: attempt to sell 500, but only 200 have","operation":2}` + "\n"
+	if response.Code != http.StatusUnprocessableEntity || response.Body.String() != expected {
+		t.Errorf("Assertion failed: status = %d, body = %q, want %q", response.Code, response.Body.String(), expected)
+	}
+	account := get(t, server, "/accounts/alice")
+	if body := account.Body.String(); body != `{"id":"alice","operations":1,"positions":[{"ticker":"","quantity":100,"average-cost":10,"accumulated-loss":0}]}`+"\n" {
+		t.Errorf("Assertion failed: account = %q", body)
+	}
+}
+
+func TestAccounts_ResubmittedIDIsNotKeptTwice(t *testing.T) {
+	server := NewServer(Options{})
+	operations := `[{"id":"t-1","operation":"buy","unit-cost":10.00,"quantity":100},{"id":"t-2","operation":"sell","unit-cost":5.00,"quantity":50}]`
+	post(t, server, "/accounts/alice/operations", operations)
+
+	response := post(t, server, "/accounts/alice/operations", operations)
+
+	if response.Code != http.StatusOK || response.Body.String() != "[{\"tax\":0},{\"tax\":0}]\n" {
+		t.Errorf("Assertion failed: status = %d, body = %q", response.Code, response.Body.String())
+	}
+	account := get(t, server, "/accounts/alice")
+	if body := account.Body.String(); body != `{"id":"alice","operations":2,"positions":[{"ticker":"","quantity":50,"average-cost":10,"accumulated-loss":250}]}`+"\n" {
+		t.Errorf("Assertion failed: account = %q", body)
+	}
+}
+
+func TestAccounts_ReusedIDConflicts(t *testing.T) {
+	server := NewServer(Options{})
+	post(t, server, "/accounts/alice/operations", `[{"id":"t-1","operation":"buy","unit-cost":10.00,"quantity":100}]`)
+
+	response := post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":10},{"id":"t-1","operation":"buy","unit-cost":12.00,"quantity":100}]`)
+
+	expected := `{"error":"id \"t-1\" was already used for a different operation","operation":2}` + "\n"
+	if response.Code != http.StatusConflict || response.Body.String() != expected {
+		t.Errorf("Assertion failed: status = %d, body = %q, want %q", response.Code, response.Body.String(), expected)
+	}
+}
+
+func TestAccounts_CancelListsTaxDifferences(t *testing.T) {
+	server := NewServer(Options{})
+	post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":10000},{"id":"s1","operation":"sell","unit-cost":5.00,"quantity":5000}]`)
+	post(t, server, "/accounts/alice/operations", `[{"id":"s2","operation":"sell","unit-cost":20.00,"quantity":3000}]`)
+
+	response := post(t, server, "/accounts/alice/operations", `[{"operation":"cancel","ref":"s1"}]`)
+
+	expected := `[{"tax":0,"adjustments":[{"operation":3,"id":"s2","before":1000,"after":6000,"difference":5000}]}]` + "\n"
+	if response.Code != http.StatusOK || response.Body.String() != expected {
+		t.Errorf("Assertion failed: status = %d, body = %q, want %q", response.Code, response.Body.String(), expected)
+	}
+	account := get(t, server, "/accounts/alice")
+	if body := account.Body.String(); body != `{"id":"alice","operations":4,"positions":[{"ticker":"","quantity":7000,"average-cost":10,"accumulated-loss":0}]}`+"\n" {
+		t.Errorf("Assertion failed: account = %q", body)
+	}
+}
+
+func TestAccounts_BackdatedTradeListsTaxDifferences(t *testing.T) {
+	server := NewServer(Options{})
+	post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":10000,"date":"2024-01-10"},{"id":"s1","operation":"sell","unit-cost":20.00,"quantity":5000,"date":"2024-02-01"}]`)
+
+	// a buy from before the sale, sent late, raises the average cost of the shares sold to 15
+	response := post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":20.00,"quantity":10000,"date":"2024-01-15"}]`)
+
+	expected := `[{"tax":0,"adjustments":[{"operation":2,"id":"s1","before":10000,"after":5000,"difference":-5000}]}]` + "\n"
+	if response.Code != http.StatusOK || response.Body.String() != expected {
+		t.Errorf("Assertion failed: status = %d, body = %q, want %q", response.Code, response.Body.String(), expected)
+	}
+}
+
+func TestAccounts_CancelOfUnknownID(t *testing.T) {
+	server := NewServer(Options{})
+
+	response := post(t, server, "/accounts/alice/operations", `[{"operation":"cancel","ref":"s1"}]`)
+
+	expected := `{"error":"no buy or sell to correct with id \"s1\"","operation":1}` + "\n"
+	if response.Code != http.StatusUnprocessableEntity || response.Body.String() != expected {
+		t.Errorf("Assertion failed: status = %d, body = %q, want %q", response.Code, response.Body.String(), expected)
+	}
+}
+
+func TestAccounts_NotFound(t *testing.T) {
+	server := NewServer(Options{})
+
+	response := get(t, server, "/accounts/nobody")
+
+	if response.Code != http.StatusNotFound || response.Body.String() != `{"error":"account not found"}`+"\n" {
+		t.Errorf("Assertion failed: status = %d, body = %q", response.Code, response.Body.String())
+	}
+}
+
+func TestAccounts_BoltStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.db")
+	store, err := storage.OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("Assertion failed: OpenBoltStore returned %v", err)
+	}
+	post(t, NewServer(Options{Accounts: store}), "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":10000}]`)
+	store.Close()
+
+	store, _ = storage.OpenBoltStore(path)
+	defer store.Close()
+	response := post(t, NewServer(Options{Accounts: store}), "/accounts/alice/operations", `[{"operation":"sell","unit-cost":20.00,"quantity":5000}]`)
+
+	if response.Body.String() != "[{\"tax\":10000}]\n" {
+		t.Errorf("Assertion failed: body = %q", response.Body.String())
+	}
+}
+
+func TestAccounts_History(t *testing.T) {
+	store, err := storage.OpenSQLiteStore(filepath.Join(t.TempDir(), "accounts.sqlite"))
+	if err != nil {
+		t.Fatalf("Assertion failed: OpenSQLiteStore returned %v", err)
+	}
+	defer store.Close()
+	server := NewServer(Options{Accounts: store})
+	post(t, server, "/accounts/alice/operations", `[{"operation":"buy","unit-cost":10.00,"quantity":10000,"ticker":"PETR4","date":"2024-01-02"}]`)
+	post(t, server, "/accounts/alice/operations", `[{"operation":"sell","unit-cost":20.00,"quantity":5000,"ticker":"PETR4"}]`)
+
+	response := get(t, server, "/accounts/alice/operations")
+
+	expected := `[{"sequence":1,"operation":{"operation":"buy","unit-cost":10,"quantity":10000,"ticker":"PETR4","date":"2024-01-02"},` +
+		`"result":{"tax":0,"explanation":{"average-cost-before":0,"average-cost-after":10,"sale-value":0,"gross-profit":0,"loss-used":0,"loss-added":0,"taxable-base":0,"rate":0,"reason":"BUY_NO_TAX"}},` +
+		`"position":{"ticker":"PETR4","quantity":10000,"average-cost":10,"accumulated-loss":0}},` +
+		`{"sequence":2,"operation":{"operation":"sell","unit-cost":20,"quantity":5000,"ticker":"PETR4"},` +
+		`"result":{"tax":10000,"explanation":{"average-cost-before":10,"average-cost-after":10,"sale-value":100000,"gross-profit":50000,"loss-used":0,"loss-added":0,"taxable-base":50000,"rate":0.2,"reason":"TAXED_PROFIT"}},` +
+		`"position":{"ticker":"PETR4","quantity":5000,"average-cost":10,"accumulated-loss":0}}]` + "\n"
+	if response.Code != http.StatusOK || response.Body.String() != expected {
+		t.Errorf("Assertion failed: status = %d, body = %q, want %q", response.Code, response.Body.String(), expected)
+	}
+}
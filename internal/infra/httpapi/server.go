@@ -0,0 +1,210 @@
+package httpapi
+
+import (
+	"context"
+	json2 "encoding/json"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"github.com/andreposman/capital-gains/internal/infra/storage"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxBodyBytes is the request size limit used when Options.MaxBodyBytes is not set
+const DefaultMaxBodyBytes = 1 << 20
+
+// Options configures the server
+type Options struct {
+	MaxBodyBytes    int64         // larger request bodies are rejected with 413
+	ShutdownTimeout time.Duration // how long in-flight requests have to finish after the shutdown starts
+	Accounts        storage.Store // state of the account resources, in memory when nil
+	// CheckpointEvery and CheckpointMonthEnd configure the checkpoints of the account replays,
+	// see application.OperationProcessor
+	CheckpointEvery    int
+	CheckpointMonthEnd bool
+	// Sessions is the number of accounts whose state, with its checkpoints, is kept in memory between
+	// requests instead of being replayed from the log. application.DefaultSessionCacheSize when 0
+	Sessions int
+	// Logger receives the server errors and the debug traces of the processing. slog.Default when nil
+	Logger *slog.Logger
+}
+
+// Server exposes OperationProcessor over HTTP
+type Server struct {
+	options  Options
+	ready    atomic.Bool
+	mux      *http.ServeMux
+	sessions *application.SessionCache
+}
+
+// ErrorBody is the JSON body of every error response
+type ErrorBody struct {
+	Error     string                 `json:"error"`
+	Operation int                    `json:"operation,omitempty"` // 1-based, for errors of a single operation
+	Issues    []json.ValidationError `json:"issues,omitempty"`
+}
+
+func NewServer(options Options) *Server {
+	if options.MaxBodyBytes <= 0 {
+		options.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	s := &Server{options: options, mux: http.NewServeMux(), sessions: application.NewSessionCache(options.Sessions)}
+	if options.Accounts == nil {
+		s.options.Accounts = storage.NewMemoryStore()
+	}
+	s.mux.HandleFunc("POST /v1/taxes", s.handleTaxes)
+	s.mux.HandleFunc("POST /accounts/{id}/operations", s.handleAppend)
+	s.mux.HandleFunc("GET /accounts/{id}", s.handleAccount)
+	s.mux.HandleFunc("GET /accounts/{id}/operations", s.handleHistory)
+	s.mux.HandleFunc("GET /healthz", s.handleHealth)
+	s.mux.HandleFunc("GET /readyz", s.handleReady)
+	return s
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.options.Logger == nil {
+		return slog.Default()
+	}
+	return s.options.Logger
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serve accepts connections on listener until ctx is done, then stops being ready and waits
+// for in-flight requests up to the shutdown timeout
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(s.logger().Handler(), slog.LevelError),
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	s.ready.Store(true)
+
+	select {
+	case err := <-errs:
+		s.ready.Store(false)
+		return err
+	case <-ctx.Done():
+	}
+
+	s.ready.Store(false)
+	s.logger().Info("Shutting down, waiting for in-flight requests", "timeout", s.options.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.options.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleTaxes processes one operations array, the same as one line of the CLI input.
+// ?explain=true adds the explanation of every result
+func (s *Server) handleTaxes(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	operations, err := json.ParseInputStrict(body)
+	if err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+
+	processor := application.OperationProcessor{Explain: r.URL.Query().Get("explain") == "true", Logger: s.options.Logger}
+	results, err := processor.ProcessOperations(r.Context(), json.ToApplication(operations))
+	if err != nil {
+		s.writeProcessingError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, results)
+}
+
+// readBody reads the request body up to the size limit, writing the error response when it fails
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.options.MaxBodyBytes))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			s.writeJSON(w, http.StatusRequestEntityTooLarge, ErrorBody{Error: "request body is larger than the limit of " + strconv.FormatInt(maxBytesError.Limit, 10) + " bytes"})
+			return nil, false
+		}
+		s.writeJSON(w, http.StatusBadRequest, ErrorBody{Error: err.Error()})
+		return nil, false
+	}
+	return body, true
+}
+
+// writeDecodeError answers 400 to input that is not valid JSON or does not pass validation
+func (s *Server) writeDecodeError(w http.ResponseWriter, err error) {
+	errorBody := ErrorBody{Error: err.Error()}
+	var issues json.ValidationErrors
+	if errors.As(err, &issues) {
+		errorBody.Error = "invalid operations"
+		errorBody.Issues = issues
+	}
+	s.writeJSON(w, http.StatusBadRequest, errorBody)
+}
+
+// writeProcessingError answers 422 to operations their handler or the portfolio rejected, with the issues
+// of the former, or corrections of an unknown id, 409 to an id reused for a different operation and 503 to
+// a request canceled while it was processed
+func (s *Server) writeProcessingError(w http.ResponseWriter, err error) {
+	errorBody := ErrorBody{Error: err.Error()}
+	var operationError *application.OperationError
+	if errors.As(err, &operationError) {
+		errorBody.Operation = operationError.Operation
+		errorBody.Error = operationError.Err.Error()
+	}
+	errorBody.Issues = json.OperationIssues(err)
+	var conflictError *application.ConflictError
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, domain.ErrInsufficientShares), errors.Is(err, application.ErrUnknownReference), errorBody.Issues != nil:
+		status = http.StatusUnprocessableEntity
+	case errors.As(err, &conflictError):
+		status = http.StatusConflict
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusServiceUnavailable
+	}
+	s.writeJSON(w, status, errorBody)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady fails once the shutdown starts, so load balancers stop sending requests
+func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	if !s.ready.Load() {
+		s.writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "shutting down"})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json2.NewEncoder(w).Encode(v); err != nil {
+		s.logger().Error("Error writing response", "err", err)
+	}
+}
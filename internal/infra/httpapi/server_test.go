@@ -0,0 +1,173 @@
+package httpapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func post(t *testing.T, server *Server, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestTaxes_ReturnsTaxArray(t *testing.T) {
+	server := NewServer(Options{})
+	body := `[{"operation":"buy","unit-cost":10.00,"quantity":10000},{"operation":"sell","unit-cost":20.00,"quantity":5000}]`
+
+	response := post(t, server, "/v1/taxes", body)
+
+	if response.Code != http.StatusOK {
+		t.Errorf("Assertion failed: status = %d, want %d", response.Code, http.StatusOK)
+	}
+	if result := response.Body.String(); result != "[{\"tax\":0},{\"tax\":10000}]\n" {
+		t.Errorf("Assertion failed: body = %q", result)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Assertion failed: content type = %q", contentType)
+	}
+}
+
+func TestTaxes_Explain(t *testing.T) {
+	server := NewServer(Options{})
+
+	response := post(t, server, "/v1/taxes?explain=true", `[{"operation":"buy","unit-cost":10.00,"quantity":100}]`)
+
+	if !strings.Contains(response.Body.String(), `"reason":"BUY_NO_TAX"`) {
+		t.Errorf("Assertion failed: body = %q, want an explanation", response.Body.String())
+	}
+}
+
+func TestTaxes_ValidationError(t *testing.T) {
+	server := NewServer(Options{})
+
+	response := post(t, server, "/v1/taxes", `[{"operation":"hold","unit-cost":10.00,"quantity":100}]`)
+
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Assertion failed: status = %d, want %d", response.Code, http.StatusBadRequest)
+	}
+	expected := `{"error":"invalid operations","issues":[{"path":"[0].operation","message":"must be one of \"buy\", \"sell\", \"cancel\", \"amend\", got \"hold\""}]}` + "\n"
+	if result := response.Body.String(); result != expected {
+		t.Errorf("Assertion failed: body = %q, want %q", result, expected)
+	}
+}
+
+func TestTaxes_MalformedJSON(t *testing.T) {
+	server := NewServer(Options{})
+
+	response := post(t, server, "/v1/taxes", `[{"operation":`)
+
+	if response.Code != http.StatusBadRequest || !strings.HasPrefix(response.Body.String(), `{"error":`) {
+		t.Errorf("Assertion failed: status = %d, body = %q", response.Code, response.Body.String())
+	}
+}
+
+func TestTaxes_InsufficientShares(t *testing.T) {
+	server := NewServer(Options{})
+
+	response := post(t, server, "/v1/taxes", `[{"operation":"buy","unit-cost":10.00,"quantity":100},{"operation":"sell","unit-cost":10.00,"quantity":200}]`)
+
+	if response.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Assertion failed: status = %d, want %d", response.Code, http.StatusUnprocessableEntity)
+	}
+	expected := `{"error":"insufficient shares: attempt to sell 200, but only 100 have","operation":2}` + "\n"
+	if result := response.Body.String(); result != expected {
+		t.Errorf("Assertion failed: body = %q, want %q", result, expected)
+	}
+}
+
+func TestTaxes_CanceledRequest(t *testing.T) {
+	server := NewServer(Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	request := httptest.NewRequest(http.MethodPost, "/v1/taxes", strings.NewReader(`[{"operation":"buy","unit-cost":10.00,"quantity":100}]`))
+	recorder := httptest.NewRecorder()
+
+	server.ServeHTTP(recorder, request.WithContext(ctx))
+
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "processing canceled after 0 of 1 operations") {
+		t.Errorf("Assertion failed: status = %d, body = %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestTaxes_BodyTooLarge(t *testing.T) {
+	server := NewServer(Options{MaxBodyBytes: 16})
+
+	response := post(t, server, "/v1/taxes", `[{"operation":"buy","unit-cost":10.00,"quantity":100}]`)
+
+	if response.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Assertion failed: status = %d, want %d", response.Code, http.StatusRequestEntityTooLarge)
+	}
+	expected := `{"error":"request body is larger than the limit of 16 bytes"}` + "\n"
+	if result := response.Body.String(); result != expected {
+		t.Errorf("Assertion failed: body = %q, want %q", result, expected)
+	}
+}
+
+func TestTaxes_MethodNotAllowed(t *testing.T) {
+	server := NewServer(Options{})
+	recorder := httptest.NewRecorder()
+
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/taxes", nil))
+
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Assertion failed: status = %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestServe_ReadyUntilShutdown(t *testing.T) {
+	server := NewServer(Options{ShutdownTimeout: time.Second})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Assertion failed: listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx, listener) }()
+
+	url := "http://" + listener.Addr().String()
+	if status := getStatus(t, url+"/healthz"); status != http.StatusOK {
+		t.Errorf("Assertion failed: /healthz status = %d, want %d", status, http.StatusOK)
+	}
+	if status := getStatus(t, url+"/readyz"); status != http.StatusOK {
+		t.Errorf("Assertion failed: /readyz status = %d, want %d", status, http.StatusOK)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Assertion failed: Serve returned %v after shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Assertion failed: Serve did not return after shutdown")
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Assertion failed: /readyz status after shutdown = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+	// Serve marks the server ready right after starting it, retry until it accepts
+	for range 50 {
+		response, err := http.Get(url)
+		if err == nil {
+			response.Body.Close()
+			return response.StatusCode
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Assertion failed: %s did not respond", url)
+	return 0
+}
@@ -0,0 +1,189 @@
+package input
+
+import (
+	"bytes"
+	"context"
+	json2 "encoding/json"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/infra/b3"
+	"github.com/andreposman/capital-gains/internal/infra/csv"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"github.com/andreposman/capital-gains/internal/infra/ofx"
+	"github.com/andreposman/capital-gains/internal/infra/sinacor"
+	"io"
+	"strings"
+)
+
+func init() {
+	// sniffing follows this order, so the generic CSV decoder goes last
+	Register(jsonDecoder{})
+	Register(ofxDecoder{})
+	Register(sinacorDecoder{})
+	Register(b3Decoder{})
+	Register(csvDecoder{})
+}
+
+// jsonDecoder reads one JSON array of operations per line, each line is its own batch.
+// An empty line ends the input
+type jsonDecoder struct{}
+
+func (jsonDecoder) Name() string         { return "json" }
+func (jsonDecoder) Extensions() []string { return []string{".json", ".jsonl", ".ndjson"} }
+
+func (jsonDecoder) Sniff(head []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(head), []byte("["))
+}
+
+func (jsonDecoder) Decode(ctx context.Context, r io.Reader, options Options, emit func(Batch) error) error {
+	parse := json.ParseInput
+	if options.Strict {
+		parse = json.ParseInputStrict
+	}
+
+	scanner := NewLineScanner(r)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			break
+		}
+
+		batch := Batch{Line: scanner.Line(), Offset: scanner.Offset()}
+		operations, err := parse(line)
+		if err != nil {
+			batch.Err = err
+			batch.Offset += errorOffset(err)
+		} else {
+			batch.Operations = json.ToApplication(operations)
+		}
+
+		if err := emit(batch); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// errorOffset returns the position inside the line reported by the decoder, if any
+func errorOffset(err error) int64 {
+	var syntaxError *json2.SyntaxError
+	if errors.As(err, &syntaxError) {
+		return syntaxError.Offset
+	}
+
+	var unmarshalTypeError *json2.UnmarshalTypeError
+	if errors.As(err, &unmarshalTypeError) {
+		return unmarshalTypeError.Offset
+	}
+
+	return 0
+}
+
+// csvDecoder reads a CSV file with a header row as a single batch
+type csvDecoder struct{}
+
+func (csvDecoder) Name() string         { return "csv" }
+func (csvDecoder) Extensions() []string { return []string{".csv"} }
+
+func (csvDecoder) Sniff(head []byte) bool {
+	header, _, _ := strings.Cut(string(head), "\n")
+	return strings.ContainsAny(header, ",;") && !strings.ContainsAny(header, "[{<")
+}
+
+func (csvDecoder) Decode(ctx context.Context, r io.Reader, options Options, emit func(Batch) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	operations, err := csv.ParseInput(r, options.CSV)
+	if err != nil {
+		batch := Batch{Err: err}
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			batch.Line = parseError.Line
+		}
+		return emit(batch)
+	}
+	return emit(Batch{Operations: json.ToApplication(operations)})
+}
+
+// b3Decoder reads the trading statement exported from the B3 Área do Investidor as a single batch
+type b3Decoder struct{}
+
+func (b3Decoder) Name() string         { return "b3" }
+func (b3Decoder) Extensions() []string { return nil }
+
+func (b3Decoder) Sniff(head []byte) bool {
+	header, _, _ := strings.Cut(string(head), "\n")
+	return strings.Contains(header, "Data do Negócio") && strings.Contains(header, "Código de Negociação")
+}
+
+func (b3Decoder) Decode(ctx context.Context, r io.Reader, _ Options, emit func(Batch) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	statement, err := b3.ParseStatement(r)
+	if err != nil {
+		return emit(Batch{Err: err})
+	}
+
+	batch := Batch{Operations: json.ToApplication(statement.Operations)}
+	for _, rowError := range statement.Errors {
+		batch.Warnings = append(batch.Warnings, rowError)
+	}
+	return emit(batch)
+}
+
+// sinacorDecoder reads the text extracted from SINACOR brokerage notes as a single batch
+type sinacorDecoder struct{}
+
+func (sinacorDecoder) Name() string         { return "sinacor" }
+func (sinacorDecoder) Extensions() []string { return nil }
+
+func (sinacorDecoder) Sniff(head []byte) bool {
+	return bytes.Contains(bytes.ToUpper(head), []byte("NOTA DE CORRETAGEM"))
+}
+
+func (sinacorDecoder) Decode(ctx context.Context, r io.Reader, options Options, emit func(Batch) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	notes, err := sinacor.ParseNotes(r, options.Issuers)
+	if notes == nil {
+		return emit(Batch{Err: err})
+	}
+
+	batch := Batch{Operations: json.ToApplication(sinacor.Operations(notes))}
+	if err != nil {
+		batch.Warnings = append(batch.Warnings, err)
+	}
+	return emit(batch)
+}
+
+// ofxDecoder reads the stock trades of an OFX/QFX investment statement as a single batch
+type ofxDecoder struct{}
+
+func (ofxDecoder) Name() string         { return "ofx" }
+func (ofxDecoder) Extensions() []string { return []string{".ofx", ".qfx"} }
+
+func (ofxDecoder) Sniff(head []byte) bool {
+	upper := bytes.ToUpper(head)
+	return bytes.Contains(upper, []byte("OFXHEADER")) || bytes.Contains(upper, []byte("<OFX>"))
+}
+
+func (ofxDecoder) Decode(ctx context.Context, r io.Reader, _ Options, emit func(Batch) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	statement, err := ofx.ParseStatement(r)
+	if err != nil {
+		return emit(Batch{Err: err})
+	}
+
+	batch := Batch{Operations: json.ToApplication(statement.Operations)}
+	for _, transactionError := range statement.Errors {
+		batch.Warnings = append(batch.Warnings, transactionError)
+	}
+	return emit(batch)
+}
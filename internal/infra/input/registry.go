@@ -0,0 +1,97 @@
+package input
+
+import (
+	"bufio"
+	"context"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/infra/csv"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// sniffSize is how much of the input is looked at to detect its format
+const sniffSize = 1024
+
+// Batch is a list of operations processed on its own, e.g. one line of the JSON input
+// or a whole CSV file
+type Batch struct {
+	Operations []application.Operation
+	Line       int     // 1-based line where the batch is, 0 when the format is not line based
+	Offset     int64   // byte offset of the decoding error, when Err is set
+	Err        error   // set when the batch could not be decoded, Operations is then nil
+	Warnings   []error // rows of the batch that were skipped because they could not be interpreted
+}
+
+// Options configures the decoders; each format only reads its own fields
+type Options struct {
+	Strict bool       // json: reject operations that do not pass schema validation
+	CSV    csv.Config // csv: column mapping, decimal separator and date format
+
+	Issuers map[string]string // sinacor: ticker roots of issuer names missing from sinacor.Issuers
+}
+
+// InputDecoder reads one input format into batches of operations
+type InputDecoder interface {
+	// Name is the value of --input-format that selects the decoder
+	Name() string
+	// Extensions are the file extensions, including the dot, that select the decoder
+	Extensions() []string
+	// Sniff reports whether the start of the input looks like this format
+	Sniff(head []byte) bool
+	// Decode reads r and calls emit for every batch, it stops at the first error emit returns,
+	// or with the error of ctx when it is done before the next batch
+	Decode(ctx context.Context, r io.Reader, options Options, emit func(Batch) error) error
+}
+
+var (
+	decoders = make(map[string]InputDecoder)
+	// order is the registration order, used when sniffing
+	order []string
+)
+
+// Register makes a decoder available by its name. Registering a name twice replaces the decoder
+func Register(decoder InputDecoder) {
+	if _, ok := decoders[decoder.Name()]; !ok {
+		order = append(order, decoder.Name())
+	}
+	decoders[decoder.Name()] = decoder
+}
+
+// Lookup returns the decoder registered with name
+func Lookup(name string) (InputDecoder, bool) {
+	decoder, ok := decoders[name]
+	return decoder, ok
+}
+
+// Names returns the registered format names in registration order
+func Names() []string {
+	return append([]string(nil), order...)
+}
+
+// Detect picks the decoder for an input: by the extension of path first, then by sniffing what
+// the first read of r returns. The returned reader must be used instead of r, since sniffing consumes input.
+// JSON is used when nothing matches
+func Detect(path string, r io.Reader) (InputDecoder, io.Reader) {
+	if extension := strings.ToLower(filepath.Ext(path)); extension != "" {
+		for _, name := range order {
+			for _, candidate := range decoders[name].Extensions() {
+				if candidate == extension {
+					return decoders[name], r
+				}
+			}
+		}
+	}
+
+	// only what the first read returns is sniffed, up to sniffSize: waiting for sniffSize bytes would hold
+	// back a line typed or piped on stdin until more input arrives
+	buffered := bufio.NewReaderSize(r, sniffSize)
+	buffered.Peek(1)
+	head, _ := buffered.Peek(buffered.Buffered())
+	for _, name := range order {
+		if decoders[name].Sniff(head) {
+			return decoders[name], buffered
+		}
+	}
+	return decoders["json"], buffered
+}
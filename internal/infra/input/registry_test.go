@@ -0,0 +1,150 @@
+package input
+
+import (
+	"context"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/application"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetect_ByExtension(t *testing.T) {
+	cases := map[string]string{
+		"trades.csv":    "csv",
+		"extrato.OFX":   "ofx",
+		"extrato.qfx":   "ofx",
+		"input.jsonl":   "json",
+		"operations.js": "json", // unknown extension, empty content falls back to json
+	}
+
+	for path, expected := range cases {
+		decoder, _ := Detect(path, strings.NewReader(""))
+		if decoder.Name() != expected {
+			t.Errorf("Assertion failed: Detect(%q) = %s, want %s", path, decoder.Name(), expected)
+		}
+	}
+}
+
+func TestDetect_ByContent(t *testing.T) {
+	cases := map[string]string{
+		`[{"operation":"buy","unit-cost":10.00,"quantity":100}]`:                         "json",
+		"OFXHEADER:100\nDATA:OFXSGML\n\n<OFX>":                                           "ofx",
+		"XP INVESTIMENTOS\nNOTA DE CORRETAGEM\n":                                         "sinacor",
+		"Data do Negócio;Tipo de Movimentação;Mercado;Código de Negociação;Quantidade\n": "b3",
+		"operation,unit-cost,quantity\nbuy,10,100\n":                                     "csv",
+	}
+
+	for content, expected := range cases {
+		decoder, reader := Detect("input.txt", strings.NewReader(content))
+		if decoder.Name() != expected {
+			t.Errorf("Assertion failed: Detect(%q) = %s, want %s", content, decoder.Name(), expected)
+		}
+
+		// sniffing must not lose the bytes it looked at
+		if read, _ := io.ReadAll(reader); string(read) != content {
+			t.Errorf("Assertion failed: reader returned %q after detection, want %q", read, content)
+		}
+	}
+}
+
+func TestDetect_DoesNotWaitForMoreInput(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	go writer.Write([]byte(`[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n"))
+
+	detected := make(chan string, 1)
+	go func() {
+		decoder, _ := Detect("", reader)
+		detected <- decoder.Name()
+	}()
+
+	select {
+	case name := <-detected:
+		if name != "json" {
+			t.Errorf("Assertion failed: Detect = %s, want json", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Assertion failed: Detect waited for more input than the first line")
+	}
+}
+
+type fixedDecoder struct{}
+
+func (fixedDecoder) Name() string           { return "fixed" }
+func (fixedDecoder) Extensions() []string   { return []string{".fixed"} }
+func (fixedDecoder) Sniff(head []byte) bool { return false }
+func (fixedDecoder) Decode(_ context.Context, _ io.Reader, _ Options, emit func(Batch) error) error {
+	return emit(Batch{Operations: []application.Operation{{Type: "buy", UnitCost: 1, Quantity: 1}}})
+}
+
+func TestRegister_CustomDecoder(t *testing.T) {
+	Register(fixedDecoder{})
+	t.Cleanup(func() {
+		delete(decoders, "fixed")
+		order = order[:len(order)-1]
+	})
+
+	decoder, ok := Lookup("fixed")
+	if !ok {
+		t.Fatalf("Assertion failed: registered decoder not found")
+	}
+	if detected, _ := Detect("trades.fixed", strings.NewReader("")); detected.Name() != "fixed" {
+		t.Errorf("Assertion failed: Detect by extension = %s, want fixed", detected.Name())
+	}
+
+	var batches []Batch
+	err := decoder.Decode(context.Background(), strings.NewReader(""), Options{}, func(batch Batch) error {
+		batches = append(batches, batch)
+		return nil
+	})
+	if err != nil || len(batches) != 1 {
+		t.Errorf("Assertion failed: expected one batch without error, got %v, %v", batches, err)
+	}
+}
+
+func TestJSONDecoder_OneBatchPerLine(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":100,"ticker":"PETR4"}]` + "\n" +
+		`[{"operation":` + "\n"
+	decoder, _ := Lookup("json")
+	var batches []Batch
+
+	err := decoder.Decode(context.Background(), strings.NewReader(input), Options{}, func(batch Batch) error {
+		batches = append(batches, batch)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("Assertion failed: expected 2 batches, got %d", len(batches))
+	}
+	expected := []application.Operation{{Type: "buy", UnitCost: 10.00, Quantity: 100, Ticker: "PETR4"}}
+	if !reflect.DeepEqual(batches[0].Operations, expected) {
+		t.Errorf("Assertion failed: first batch = %v, want %v", batches[0].Operations, expected)
+	}
+	if batches[1].Err == nil || batches[1].Line != 2 {
+		t.Errorf("Assertion failed: expected a decoding error on line 2, got %+v", batches[1])
+	}
+}
+
+func TestJSONDecoder_StopsWhenCanceled(t *testing.T) {
+	input := `[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n" +
+		`[{"operation":"buy","unit-cost":10.00,"quantity":100}]` + "\n"
+	decoder, _ := Lookup("json")
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := 0
+
+	err := decoder.Decode(ctx, strings.NewReader(input), Options{}, func(batch Batch) error {
+		batches++
+		cancel()
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) || batches != 1 {
+		t.Errorf("Assertion failed: expected to stop after 1 batch with context.Canceled, got %d batches, %v", batches, err)
+	}
+}
@@ -0,0 +1,48 @@
+package input
+
+import (
+	"bufio"
+	"io"
+)
+
+// LineScanner is a bufio.Scanner that keeps track of the line number and the
+// byte offset where the current line starts
+type LineScanner struct {
+	*bufio.Scanner
+	line     int
+	offset   int64
+	consumed int64
+	advanced int
+}
+
+// NewLineScanner returns a LineScanner that splits r in lines
+func NewLineScanner(r io.Reader) *LineScanner {
+	s := &LineScanner{Scanner: bufio.NewScanner(r)}
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		s.advanced += advance
+		return advance, token, err
+	})
+	return s
+}
+
+func (s *LineScanner) Scan() bool {
+	s.offset = s.consumed
+	s.advanced = 0
+	ok := s.Scanner.Scan()
+	s.consumed += int64(s.advanced)
+	if ok {
+		s.line++
+	}
+	return ok
+}
+
+// Line returns the 1-based number of the current line
+func (s *LineScanner) Line() int {
+	return s.line
+}
+
+// Offset returns the byte offset of the start of the current line
+func (s *LineScanner) Offset() int64 {
+	return s.offset
+}
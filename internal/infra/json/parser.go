@@ -1,11 +1,22 @@
 package json
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"github.com/andreposman/capital-gains/internal/application"
+)
+
+// DateLayout is the format of Operation.Date
+const DateLayout = "2006-01-02"
 
 type Operation struct {
+	ID        string  `json:"id,omitempty"` // identifies the trade, a re-submission is not processed twice
 	Operation string  `json:"operation"`
-	UnitCost  float64 `json:"unit-cost"`
-	Quantity  int     `json:"quantity"`
+	UnitCost  float64 `json:"unit-cost,omitempty"` // required by buy, sell and amend
+	Quantity  int     `json:"quantity,omitempty"`  // required by buy, sell and amend
+	Ticker    string  `json:"ticker,omitempty"`
+	Date      string  `json:"date,omitempty"`
+	Fees      float64 `json:"fees,omitempty"`
+	Ref       string  `json:"ref,omitempty"` // id of the operation a cancel or amend corrects
 }
 
 func ParseInput(input []byte) ([]Operation, error) {
@@ -13,3 +24,35 @@ func ParseInput(input []byte) ([]Operation, error) {
 	err := json.Unmarshal(input, &operations)
 	return operations, err
 }
+
+// ToApplication converts the decoded operations to the ones the application processes
+func ToApplication(operations []Operation) []application.Operation {
+	converted := make([]application.Operation, len(operations))
+	for i, o := range operations {
+		converted[i] = application.Operation{
+			ID:       o.ID,
+			Type:     o.Operation,
+			UnitCost: o.UnitCost,
+			Quantity: o.Quantity,
+			Ticker:   o.Ticker,
+			Date:     o.Date,
+			Fees:     o.Fees,
+			Ref:      o.Ref,
+		}
+	}
+	return converted
+}
+
+// FromApplication converts an operation back to its JSON form
+func FromApplication(o application.Operation) Operation {
+	return Operation{
+		ID:        o.ID,
+		Operation: o.Type,
+		UnitCost:  o.UnitCost,
+		Quantity:  o.Quantity,
+		Ticker:    o.Ticker,
+		Date:      o.Date,
+		Fees:      o.Fees,
+		Ref:       o.Ref,
+	}
+}
@@ -3,6 +3,7 @@ package json
 import (
 	"encoding/json"
 	"errors"
+	"github.com/andreposman/capital-gains/internal/application"
 	"reflect"
 	"testing"
 )
@@ -117,3 +118,28 @@ func TestParseInput_WrongFieldType(t *testing.T) {
 		t.Errorf("Assertion failed: expected error of type *json.UnmarshalTypeError, but got type %T: %v", err, err)
 	}
 }
+
+func TestToApplication(t *testing.T) {
+	operations := []Operation{
+		{ID: "t-1", Operation: "buy", UnitCost: 10.00, Quantity: 100, Ticker: "PETR4", Date: "2024-03-01", Fees: 1.50},
+	}
+	expected := []application.Operation{
+		{ID: "t-1", Type: "buy", UnitCost: 10.00, Quantity: 100, Ticker: "PETR4", Date: "2024-03-01", Fees: 1.50},
+	}
+
+	result := ToApplication(operations)
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Assertion failed: result = %v, want %v", result, expected)
+	}
+}
+
+func TestFromApplication_RoundTrip(t *testing.T) {
+	operation := Operation{ID: "t-2", Operation: "sell", UnitCost: 20.00, Quantity: 50, Ticker: "VALE3", Date: "2024-03-02", Fees: 0.75}
+
+	result := FromApplication(ToApplication([]Operation{operation})[0])
+
+	if result != operation {
+		t.Errorf("Assertion failed: result = %v, want %v", result, operation)
+	}
+}
@@ -0,0 +1,19 @@
+package json
+
+import _ "embed"
+
+//go:embed schema/operations.schema.json
+var operationsSchema []byte
+
+//go:embed schema/taxes.schema.json
+var taxesSchema []byte
+
+// OperationsSchema returns the JSON Schema of an input line ([]Operation)
+func OperationsSchema() []byte {
+	return operationsSchema
+}
+
+// TaxesSchema returns the JSON Schema of an output line ([]domain.Tax)
+func TaxesSchema() []byte {
+	return taxesSchema
+}
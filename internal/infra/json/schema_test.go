@@ -0,0 +1,174 @@
+package json
+
+import (
+	"encoding/json"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// schemaProperty is a property of the schema, objects describe their own properties
+type schemaProperty struct {
+	Type                 string                    `json:"type"`
+	Enum                 []string                  `json:"enum"`
+	AdditionalProperties bool                      `json:"additionalProperties"`
+	Required             []string                  `json:"required"`
+	Properties           map[string]schemaProperty `json:"properties"`
+	Items                *schemaProperty           `json:"items"`
+}
+
+type arraySchema struct {
+	Type  string         `json:"type"`
+	Items schemaProperty `json:"items"`
+}
+
+func loadArraySchema(t *testing.T, raw []byte) arraySchema {
+	t.Helper()
+	var schema arraySchema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("Assertion failed: schema is not valid JSON: %v", err)
+	}
+	if schema.Type != "array" || schema.Items.Type != "object" {
+		t.Fatalf("Assertion failed: expected an array of objects, got %s of %s", schema.Type, schema.Items.Type)
+	}
+	if schema.Items.AdditionalProperties {
+		t.Errorf("Assertion failed: schema items should not allow additional properties")
+	}
+	return schema
+}
+
+// assertSchemaMatchesStruct checks that every json-tagged field of structType is described by the schema
+// with a matching type, that fields without omitempty are required, and that there are no extra properties.
+// Struct fields are checked against their nested object schema
+func assertSchemaMatchesStruct(t *testing.T, schema schemaProperty, structType reflect.Type) {
+	t.Helper()
+	var fieldNames, required []string
+
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		fieldNames = append(fieldNames, name)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+
+		property, ok := schema.Properties[name]
+		if !ok {
+			t.Errorf("Assertion failed: field %s.%s (%q) is missing from the schema", structType.Name(), field.Name, name)
+			continue
+		}
+		if want := schemaType(field.Type); property.Type != want {
+			t.Errorf("Assertion failed: property %q has type %q, want %q", name, property.Type, want)
+		}
+		if nested := indirect(field.Type); nested.Kind() == reflect.Struct {
+			if property.AdditionalProperties {
+				t.Errorf("Assertion failed: property %q should not allow additional properties", name)
+			}
+			assertSchemaMatchesStruct(t, property, nested)
+		}
+	}
+
+	for name := range schema.Properties {
+		if !contains(fieldNames, name) {
+			t.Errorf("Assertion failed: schema property %q has no matching field in %s", name, structType.Name())
+		}
+	}
+
+	sort.Strings(required)
+	schemaRequired := append([]string(nil), schema.Required...)
+	sort.Strings(schemaRequired)
+	if !reflect.DeepEqual(schemaRequired, required) {
+		t.Errorf("Assertion failed: schema required = %v, want %v", schemaRequired, required)
+	}
+}
+
+func schemaType(goType reflect.Type) string {
+	switch goType.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int64:
+		return "integer"
+	case reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice:
+		return "array"
+	case reflect.Struct, reflect.Pointer, reflect.Map:
+		return "object"
+	}
+	return goType.Kind().String()
+}
+
+func indirect(goType reflect.Type) reflect.Type {
+	if goType.Kind() == reflect.Pointer {
+		return goType.Elem()
+	}
+	return goType
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOperationsSchema_MatchesOperationStruct(t *testing.T) {
+	schema := loadArraySchema(t, OperationsSchema())
+
+	assertSchemaMatchesStruct(t, schema.Items, reflect.TypeOf(Operation{}))
+}
+
+func TestOperationsSchema_EnumMatchesKnownOperations(t *testing.T) {
+	schema := loadArraySchema(t, OperationsSchema())
+
+	enum := schema.Items.Properties["operation"].Enum
+
+	if !reflect.DeepEqual(enum, application.OperationTypes()) {
+		t.Errorf("Assertion failed: operation enum = %v, want %v", enum, application.OperationTypes())
+	}
+}
+
+func TestTaxesSchema_MatchesTaxStruct(t *testing.T) {
+	schema := loadArraySchema(t, TaxesSchema())
+
+	assertSchemaMatchesStruct(t, schema.Items, reflect.TypeOf(domain.Tax{}))
+}
+
+func TestTaxesSchema_ReasonEnumMatchesReasonCodes(t *testing.T) {
+	schema := loadArraySchema(t, TaxesSchema())
+
+	enum := schema.Items.Properties["explanation"].Properties["reason"].Enum
+	reasons := []string{
+		domain.ReasonBuyNoTax,
+		domain.ReasonExemptUnderThreshold,
+		domain.ReasonLossOffset,
+		domain.ReasonSaleAtLoss,
+		domain.ReasonNoProfit,
+		domain.ReasonTaxedProfit,
+	}
+
+	if !reflect.DeepEqual(enum, reasons) {
+		t.Errorf("Assertion failed: reason enum = %v, want %v", enum, reasons)
+	}
+}
+
+func TestTaxesSchema_AdjustmentsMatchAdjustmentStruct(t *testing.T) {
+	schema := loadArraySchema(t, TaxesSchema())
+
+	items := schema.Items.Properties["adjustments"].Items
+	if items == nil || items.Type != "object" {
+		t.Fatalf("Assertion failed: expected adjustments to be an array of objects")
+	}
+	assertSchemaMatchesStruct(t, *items, reflect.TypeOf(domain.Adjustment{}))
+}
@@ -0,0 +1,254 @@
+package json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/application"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ValidationError describes a single schema violation found in an operations array
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + " " + e.Message
+}
+
+// ValidationErrors groups every violation found in one input
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, v := range e {
+		messages[i] = v.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ValidateInput checks an operations array against the strict schema.
+// The returned error is only set when the input is not a JSON array of objects.
+func ValidateInput(input []byte) (ValidationErrors, error) {
+	var rawOperations []map[string]json.RawMessage
+	if err := json.Unmarshal(input, &rawOperations); err != nil {
+		return nil, err
+	}
+
+	var issues ValidationErrors
+	for i, raw := range rawOperations {
+		issues = append(issues, validateOperation(i, raw)...)
+	}
+	return issues, nil
+}
+
+// ValidateOperations checks operations that were not decoded from JSON, e.g. from gRPC,
+// with the same rules as ValidateInput
+func ValidateOperations(operations []Operation) ValidationErrors {
+	var issues ValidationErrors
+	for i, operation := range operations {
+		raw, err := rawOperation(operation)
+		if err != nil {
+			return ValidationErrors{{Path: fmt.Sprintf("[%d]", i), Message: err.Error()}}
+		}
+		issues = append(issues, validateOperation(i, raw)...)
+	}
+	return issues
+}
+
+// rawOperation is operation as ValidateInput sees it. The zero unit-cost and quantity that
+// omitempty leaves out are kept, so they are reported as invalid rather than missing, except
+// for a cancel that has neither
+func rawOperation(operation Operation) (map[string]json.RawMessage, error) {
+	input, err := json.Marshal(operation)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(input, &raw); err != nil {
+		return nil, err
+	}
+	if operation.Operation != "cancel" {
+		raw["unit-cost"], _ = json.Marshal(operation.UnitCost)
+		raw["quantity"], _ = json.Marshal(operation.Quantity)
+	}
+	return raw, nil
+}
+
+// OperationIssues describes an operation the processor rejected for its type or payload as the
+// validation error of its field, nil for any other error
+func OperationIssues(err error) ValidationErrors {
+	var operationError *application.OperationError
+	if !errors.As(err, &operationError) {
+		return nil
+	}
+	path := fmt.Sprintf("[%d].", operationError.Operation-1)
+
+	var unknown *application.UnknownOperationError
+	var payload *application.PayloadError
+	switch {
+	case errors.As(err, &unknown):
+		return ValidationErrors{{Path: path + "operation", Message: fmt.Sprintf("must be one of %s, got %q", quoteAll(application.OperationTypes()), unknown.Type)}}
+	case errors.As(err, &payload):
+		return ValidationErrors{{Path: path + payload.Field, Message: payload.Message}}
+	}
+	return nil
+}
+
+// ParseInputStrict parses the input like ParseInput but rejects anything that does not pass ValidateInput
+func ParseInputStrict(input []byte) ([]Operation, error) {
+	issues, err := ValidateInput(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(issues) > 0 {
+		return nil, issues
+	}
+	return ParseInput(input)
+}
+
+func validateOperation(index int, raw map[string]json.RawMessage) ValidationErrors {
+	var issues ValidationErrors
+	report := func(field, format string, args ...any) {
+		issues = append(issues, ValidationError{
+			Path:    fmt.Sprintf("[%d].%s", index, field),
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if value, ok := raw["id"]; ok {
+		var id string
+		if err := json.Unmarshal(value, &id); err != nil {
+			report("id", "must be a string")
+		} else if id == "" {
+			report("id", "must not be empty")
+		}
+	}
+
+	var operation string
+	if value, ok := raw["operation"]; !ok {
+		report("operation", "is required")
+	} else if err := json.Unmarshal(value, &operation); err != nil {
+		report("operation", "must be a string")
+	} else if !isKnownOperation(operation) {
+		report("operation", "must be one of %s, got %q", quoteAll(application.OperationTypes()), operation)
+	}
+	// a cancel only needs the operation it corrects, and an amend replaces its unit-cost and quantity.
+	// The payload of the other types is checked by their handler, once it has the right shape
+	cancel := operation == "cancel"
+	correction := cancel || operation == "amend"
+	payload := application.Operation{Type: operation}
+	shaped := true
+
+	if value, ok := raw["unit-cost"]; !ok {
+		if correction && !cancel {
+			report("unit-cost", "is required for %s", operation)
+		}
+	} else if err := json.Unmarshal(value, &payload.UnitCost); err != nil {
+		report("unit-cost", "must be a number")
+		shaped = false
+	}
+
+	if value, ok := raw["quantity"]; !ok {
+		if correction && !cancel {
+			report("quantity", "is required for %s", operation)
+		}
+	} else if err := json.Unmarshal(value, &payload.Quantity); err != nil {
+		report("quantity", "must be an integer")
+		shaped = false
+	}
+
+	if value, ok := raw["ticker"]; ok {
+		var ticker string
+		if err := json.Unmarshal(value, &ticker); err != nil {
+			report("ticker", "must be a string")
+		} else if ticker == "" {
+			report("ticker", "must not be empty")
+		}
+	}
+
+	if value, ok := raw["date"]; ok {
+		var date string
+		if err := json.Unmarshal(value, &date); err != nil {
+			report("date", "must be a string")
+		} else if _, err := time.Parse(DateLayout, date); err != nil {
+			report("date", "must be a date in YYYY-MM-DD format, got %q", date)
+		}
+	}
+
+	if value, ok := raw["fees"]; ok {
+		if err := json.Unmarshal(value, &payload.Fees); err != nil {
+			report("fees", "must be a number")
+			shaped = false
+		}
+	}
+
+	if handler, ok := application.LookupHandler(operation); ok && shaped {
+		var rejected *application.PayloadError
+		if err := handler.Validate(payload); errors.As(err, &rejected) {
+			report(rejected.Field, "%s", rejected.Message)
+		}
+	}
+
+	if value, ok := raw["ref"]; !ok {
+		if correction {
+			report("ref", "is required for %s", operation)
+		}
+	} else {
+		var ref string
+		if err := json.Unmarshal(value, &ref); err != nil {
+			report("ref", "must be a string")
+		} else if ref == "" {
+			report("ref", "must not be empty")
+		} else if !correction && operation != "" {
+			report("ref", "is only allowed for cancel and amend")
+		}
+	}
+
+	var unknown []string
+	for field := range raw {
+		if !isKnownField(field) {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		report(field, "is not a known field")
+	}
+
+	return issues
+}
+
+// isKnownField reports whether field matches the json tag of an Operation field
+func isKnownField(field string) bool {
+	operationType := reflect.TypeOf(Operation{})
+	for i := range operationType.NumField() {
+		name, _, _ := strings.Cut(operationType.Field(i).Tag.Get("json"), ",")
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+func isKnownOperation(operation string) bool {
+	for _, known := range application.OperationTypes() {
+		if operation == known {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,229 @@
+package json
+
+import (
+	"context"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"reflect"
+	"testing"
+)
+
+func TestValidateInput_ValidOperations(t *testing.T) {
+	inputJSON := `[{"operation":"buy","unit-cost":10.00,"quantity":100},{"operation":"sell","unit-cost":20.00,"quantity":50}]`
+
+	issues, err := ValidateInput([]byte(inputJSON))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Assertion failed: expected no issues, but got: %v", issues)
+	}
+}
+
+func TestValidateInput_ReportsEveryViolationWithPath(t *testing.T) {
+	inputJSON := `[
+		{"operation":"buy","unit-cost":10.00,"quantity":100},
+		{"operation":"buy","unit-cost":10.00},
+		{"operation":"sell","unit-cost":10.00,"quantity":-5},
+		{"operation":"sel","unit-cost":-1,"quantity":0,"price":9.5}
+	]`
+	expected := ValidationErrors{
+		{Path: "[1].quantity", Message: "must be > 0"},
+		{Path: "[2].quantity", Message: "must be > 0"},
+		{Path: "[3].operation", Message: `must be one of "buy", "sell", "cancel", "amend", got "sel"`},
+		{Path: "[3].price", Message: "is not a known field"},
+	}
+
+	issues, err := ValidateInput([]byte(inputJSON))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: issues = %v, want %v", issues, expected)
+	}
+}
+
+func TestValidateInput_WrongFieldTypes(t *testing.T) {
+	inputJSON := `[{"operation":1,"unit-cost":"expensive","quantity":1.5}]`
+	expected := ValidationErrors{
+		{Path: "[0].operation", Message: "must be a string"},
+		{Path: "[0].unit-cost", Message: "must be a number"},
+		{Path: "[0].quantity", Message: "must be an integer"},
+	}
+
+	issues, err := ValidateInput([]byte(inputJSON))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: issues = %v, want %v", issues, expected)
+	}
+}
+
+func TestValidateInput_InvalidJsonSyntax(t *testing.T) {
+	_, err := ValidateInput([]byte(`[{"operation":"buy",`))
+
+	if err == nil {
+		t.Fatalf("Assertion failed: expected an error for invalid JSON syntax, but got nil")
+	}
+}
+
+func TestParseInputStrict_RejectsInvalidOperations(t *testing.T) {
+	inputJSON := `[{"operation":"buy","unit-cost":0,"quantity":100}]`
+	var issues ValidationErrors
+
+	_, err := ParseInputStrict([]byte(inputJSON))
+
+	if !errors.As(err, &issues) {
+		t.Fatalf("Assertion failed: expected ValidationErrors, but got type %T: %v", err, err)
+	}
+	if err.Error() != "[0].unit-cost must be > 0" {
+		t.Errorf("Assertion failed: error = %q, want %q", err.Error(), "[0].unit-cost must be > 0")
+	}
+}
+
+func TestValidateInput_OptionalFields(t *testing.T) {
+	inputJSON := `[
+		{"operation":"buy","unit-cost":10.00,"quantity":100,"ticker":"PETR4","date":"2024-03-01"},
+		{"operation":"sell","unit-cost":10.00,"quantity":100,"ticker":"","date":"01/03/2024"}
+	]`
+	expected := ValidationErrors{
+		{Path: "[1].ticker", Message: "must not be empty"},
+		{Path: "[1].date", Message: `must be a date in YYYY-MM-DD format, got "01/03/2024"`},
+	}
+
+	issues, err := ValidateInput([]byte(inputJSON))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: issues = %v, want %v", issues, expected)
+	}
+}
+
+func TestValidateInput_ID(t *testing.T) {
+	inputJSON := `[
+		{"id":"t-1","operation":"buy","unit-cost":10.00,"quantity":100},
+		{"id":"","operation":"sell","unit-cost":10.00,"quantity":50},
+		{"id":7,"operation":"sell","unit-cost":10.00,"quantity":50}
+	]`
+	expected := ValidationErrors{
+		{Path: "[1].id", Message: "must not be empty"},
+		{Path: "[2].id", Message: "must be a string"},
+	}
+
+	issues, err := ValidateInput([]byte(inputJSON))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: issues = %v, want %v", issues, expected)
+	}
+}
+
+func TestValidateInput_Corrections(t *testing.T) {
+	inputJSON := `[
+		{"id":"t-1","operation":"buy","unit-cost":10.00,"quantity":100},
+		{"operation":"cancel","ref":"t-1"},
+		{"operation":"amend","ref":"t-1","unit-cost":11.00},
+		{"operation":"cancel"},
+		{"operation":"sell","unit-cost":10.00,"quantity":50,"ref":"t-1"}
+	]`
+	expected := ValidationErrors{
+		{Path: "[2].quantity", Message: "is required for amend"},
+		{Path: "[3].ref", Message: "is required for cancel"},
+		{Path: "[4].ref", Message: "is only allowed for cancel and amend"},
+	}
+
+	issues, err := ValidateInput([]byte(inputJSON))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: issues = %v, want %v", issues, expected)
+	}
+}
+
+func TestValidateOperations(t *testing.T) {
+	operations := []Operation{
+		{Operation: "buy", UnitCost: 10.00, Quantity: 100, Date: "2024-01-02"},
+		{Operation: "hold", UnitCost: 10.00, Quantity: 100, Date: "02/01/2024"},
+		{Operation: "sell", UnitCost: 10.00, Quantity: 0},
+	}
+	expected := ValidationErrors{
+		{Path: "[1].operation", Message: `must be one of "buy", "sell", "cancel", "amend", got "hold"`},
+		{Path: "[1].date", Message: `must be a date in YYYY-MM-DD format, got "02/01/2024"`},
+		{Path: "[2].quantity", Message: "must be > 0"},
+	}
+
+	issues := ValidateOperations(operations)
+
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: expected %v, but got: %v", expected, issues)
+	}
+}
+
+func TestOperationIssues(t *testing.T) {
+	processor := application.OperationProcessor{}
+	_, unknown := processor.ProcessOperations(context.Background(), []application.Operation{{Type: "buy", UnitCost: 10.00, Quantity: 100}, {Type: "hold"}})
+	_, payload := processor.ProcessOperations(context.Background(), []application.Operation{{Type: "sell", UnitCost: 10.00}})
+	_, other := processor.ProcessOperations(context.Background(), []application.Operation{{Type: "sell", UnitCost: 10.00, Quantity: 100}})
+
+	expected := ValidationErrors{{Path: "[1].operation", Message: `must be one of "buy", "sell", "cancel", "amend", got "hold"`}}
+	if issues := OperationIssues(unknown); !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: expected %v, but got: %v", expected, issues)
+	}
+	expected = ValidationErrors{{Path: "[0].quantity", Message: "must be > 0"}}
+	if issues := OperationIssues(payload); !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: expected %v, but got: %v", expected, issues)
+	}
+	// insufficient shares is not an issue of the input
+	if issues := OperationIssues(other); issues != nil {
+		t.Errorf("Assertion failed: expected no issues, but got: %v", issues)
+	}
+}
+
+// bonusHandler adds shares received at no cost, whose unit-cost must be 0
+type bonusHandler struct{}
+
+func (bonusHandler) Name() string { return "bonus" }
+
+func (bonusHandler) Validate(operation application.Operation) error {
+	if operation.UnitCost != 0 {
+		return &application.PayloadError{Type: "bonus", Field: "unit-cost", Message: "must be 0"}
+	}
+	return nil
+}
+
+func (bonusHandler) Handle(portfolio *domain.Portfolio, origin domain.Origin, operation application.Operation) (domain.Tax, error) {
+	return portfolio.ExplainBuy(origin, operation.Quantity, 0, 0), nil
+}
+
+// the handler stays registered for the tests that run after this one, so it is the last of the package
+func TestValidateInput_RegisteredHandlerPayload(t *testing.T) {
+	application.RegisterHandler(bonusHandler{})
+	inputJSON := `[
+		{"operation":"bonus","unit-cost":0,"quantity":100},
+		{"operation":"bonus","quantity":100},
+		{"operation":"bonus","unit-cost":10.00,"quantity":100}
+	]`
+	expected := ValidationErrors{
+		{Path: "[2].unit-cost", Message: "must be 0"},
+	}
+
+	issues, err := ValidateInput([]byte(inputJSON))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Errorf("Assertion failed: issues = %v, want %v", issues, expected)
+	}
+}
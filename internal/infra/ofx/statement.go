@@ -0,0 +1,152 @@
+package ofx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/infra/csv"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TransactionError is an investment transaction that could not be turned into an operation
+type TransactionError struct {
+	FITID string
+	Err   error
+}
+
+func (e TransactionError) Error() string {
+	return fmt.Sprintf("transaction %s: %v", e.FITID, e.Err)
+}
+
+// Statement is the result of reading the investment statements (INVSTMTRS) of an OFX/QFX file
+type Statement struct {
+	Operations []json.Operation
+	Errors     []TransactionError
+}
+
+// ParseStatement reads an OFX 1.x (SGML) or 2.x (XML) download and returns its BUYSTOCK and
+// SELLSTOCK transactions in chronological order. Commission, fees and taxes of a transaction
+// become the operation fees; the ticker comes from the security list, falling back to the security ID
+func ParseStatement(r io.Reader) (Statement, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return Statement{}, err
+	}
+
+	root, err := parse(string(content))
+	if err != nil {
+		return Statement{}, err
+	}
+
+	statements := root.findAll("INVSTMTRS")
+	if len(statements) == 0 {
+		return Statement{}, errors.New("no investment statement (INVSTMTRS) found")
+	}
+
+	tickers := make(map[string]string)
+	for _, info := range root.findAll("SECINFO") {
+		if id, ticker := info.value("SECID", "UNIQUEID"), info.value("TICKER"); id != "" && ticker != "" {
+			tickers[id] = ticker
+		}
+	}
+
+	statement := Statement{Operations: []json.Operation{}}
+	for _, investments := range statements {
+		for _, transactions := range investments.children("INVTRANLIST") {
+			for _, transaction := range transactions.Children {
+				var side, aggregate, kind string
+				switch transaction.Name {
+				case "BUYSTOCK":
+					side, aggregate, kind = "buy", "INVBUY", transaction.value("BUYTYPE")
+				case "SELLSTOCK":
+					side, aggregate, kind = "sell", "INVSELL", transaction.value("SELLTYPE")
+				default:
+					continue
+				}
+
+				details := transaction.child(aggregate)
+				if details == nil {
+					statement.Errors = append(statement.Errors, TransactionError{Err: fmt.Errorf("%s without %s", transaction.Name, aggregate)})
+					continue
+				}
+
+				operation, err := parseTransaction(side, kind, details, tickers)
+				if err != nil {
+					statement.Errors = append(statement.Errors, TransactionError{FITID: details.value("INVTRAN", "FITID"), Err: err})
+					continue
+				}
+				statement.Operations = append(statement.Operations, operation)
+			}
+		}
+	}
+
+	sort.SliceStable(statement.Operations, func(i, j int) bool {
+		return statement.Operations[i].Date < statement.Operations[j].Date
+	})
+	return statement, nil
+}
+
+func parseTransaction(side, kind string, details *node, tickers map[string]string) (json.Operation, error) {
+	// the FITID is unique per transaction in the bank, so importing the same statement twice is a no-op
+	operation := json.Operation{ID: details.value("INVTRAN", "FITID"), Operation: side}
+
+	if kind != "" && kind != "BUY" && kind != "SELL" {
+		return operation, fmt.Errorf("unsupported transaction type %s", kind)
+	}
+
+	id := details.value("SECID", "UNIQUEID")
+	if id == "" {
+		return operation, errors.New("missing SECID")
+	}
+	operation.Ticker = id
+	if ticker, ok := tickers[id]; ok {
+		operation.Ticker = ticker
+	}
+
+	units, err := number(details.value("UNITS"))
+	if err != nil {
+		return operation, fmt.Errorf("invalid UNITS: %v", err)
+	}
+	// sells are usually reported with negative units
+	units = math.Abs(units)
+	if units == 0 || units != math.Trunc(units) {
+		return operation, fmt.Errorf("UNITS must be a positive whole number, got %s", details.value("UNITS"))
+	}
+	operation.Quantity = int(units)
+
+	if operation.UnitCost, err = number(details.value("UNITPRICE")); err != nil || operation.UnitCost <= 0 {
+		return operation, fmt.Errorf("invalid UNITPRICE %q", details.value("UNITPRICE"))
+	}
+
+	for _, fee := range []string{"COMMISSION", "FEES", "TAXES"} {
+		if value := details.value(fee); value != "" {
+			amount, err := number(value)
+			if err != nil {
+				return operation, fmt.Errorf("invalid %s: %v", fee, err)
+			}
+			operation.Fees += math.Abs(amount)
+		}
+	}
+
+	if tradeDate := details.value("INVTRAN", "DTTRADE"); len(tradeDate) >= 8 {
+		date, err := time.Parse("20060102", tradeDate[:8])
+		if err != nil {
+			return operation, fmt.Errorf("invalid DTTRADE %q", tradeDate)
+		}
+		operation.Date = date.Format(json.DateLayout)
+	}
+
+	return operation, nil
+}
+
+// number reads an OFX amount, accepting the comma decimal separator some Brazilian banks use
+func number(value string) (float64, error) {
+	if strings.Contains(value, ",") && !strings.Contains(value, ".") {
+		return csv.ParseNumber(value, ',')
+	}
+	return csv.ParseNumber(value, '.')
+}
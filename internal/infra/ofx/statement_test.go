@@ -0,0 +1,91 @@
+package ofx
+
+import (
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStatement_SGML(t *testing.T) {
+	file, err := os.Open("testdata/statement.ofx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	expected := []json.Operation{
+		{ID: "T-0001", Operation: "buy", UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4", Date: "2024-03-05", Fees: 12.00},
+		{ID: "T-0002", Operation: "sell", UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4", Date: "2024-03-20", Fees: 15.50},
+	}
+
+	statement, err := ParseStatement(file)
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(statement.Operations, expected) {
+		t.Errorf("Assertion failed: operations = %v, want %v", statement.Operations, expected)
+	}
+	if len(statement.Errors) != 1 || statement.Errors[0].FITID != "T-0003" {
+		t.Errorf("Assertion failed: errors = %v, want the short sale T-0003", statement.Errors)
+	}
+}
+
+func TestParseStatement_XML(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <INVSTMTMSGSRSV1><INVSTMTTRNRS><INVSTMTRS>
+    <INVTRANLIST>
+      <BUYSTOCK>
+        <INVBUY>
+          <INVTRAN><FITID>1</FITID><DTTRADE>20240102</DTTRADE></INVTRAN>
+          <SECID><UNIQUEID>037833100</UNIQUEID><UNIQUEIDTYPE>CUSIP</UNIQUEIDTYPE></SECID>
+          <UNITS>100.0000</UNITS>
+          <UNITPRICE>185.50</UNITPRICE>
+          <COMMISSION>0.00</COMMISSION>
+          <TOTAL>-18550.00</TOTAL>
+        </INVBUY>
+        <BUYTYPE>BUY</BUYTYPE>
+      </BUYSTOCK>
+    </INVTRANLIST>
+  </INVSTMTRS></INVSTMTTRNRS></INVSTMTMSGSRSV1>
+</OFX>`
+	expected := []json.Operation{
+		{ID: "1", Operation: "buy", UnitCost: 185.50, Quantity: 100, Ticker: "037833100", Date: "2024-01-02"},
+	}
+
+	statement, err := ParseStatement(strings.NewReader(input))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if !reflect.DeepEqual(statement.Operations, expected) {
+		t.Errorf("Assertion failed: operations = %v, want %v", statement.Operations, expected)
+	}
+}
+
+func TestParseStatement_FractionalUnits(t *testing.T) {
+	input := `<OFX><INVSTMTRS><INVTRANLIST><BUYSTOCK><INVBUY>
+<INVTRAN><FITID>9<DTTRADE>20240102</INVTRAN>
+<SECID><UNIQUEID>X</SECID><UNITS>1.5<UNITPRICE>10
+</INVBUY></BUYSTOCK></INVTRANLIST></INVSTMTRS></OFX>`
+
+	statement, err := ParseStatement(strings.NewReader(input))
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if len(statement.Operations) != 0 || len(statement.Errors) != 1 {
+		t.Errorf("Assertion failed: expected the transaction to be reported, got %v / %v", statement.Operations, statement.Errors)
+	}
+}
+
+func TestParseStatement_NotOFX(t *testing.T) {
+	_, err := ParseStatement(strings.NewReader(`[{"operation":"buy"}]`))
+
+	if err == nil {
+		t.Fatalf("Assertion failed: expected an error for a non-OFX input, but got nil")
+	}
+}
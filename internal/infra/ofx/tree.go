@@ -0,0 +1,117 @@
+package ofx
+
+import (
+	"errors"
+	"strings"
+)
+
+// node is an OFX element. Aggregates have children, elements have a value
+type node struct {
+	Name     string
+	Value    string
+	Children []*node
+}
+
+// parse builds the element tree of an OFX document. It accepts both the SGML flavour of OFX 1.x,
+// where elements are not closed, and the XML flavour of OFX 2.x
+func parse(document string) (*node, error) {
+	start := strings.Index(strings.ToUpper(document), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("not an OFX document, missing <OFX>")
+	}
+	document = document[start:]
+
+	root := &node{}
+	stack := []*node{root}
+
+	for len(document) > 0 {
+		open := strings.IndexByte(document, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(document[open:], '>')
+		if end < 0 {
+			return nil, errors.New("unterminated tag")
+		}
+		tag := strings.ToUpper(strings.TrimSpace(document[open+1 : open+end]))
+		document = document[open+end+1:]
+
+		next := strings.IndexByte(document, '<')
+		if next < 0 {
+			next = len(document)
+		}
+		text := strings.TrimSpace(document[:next])
+		document = document[next:]
+
+		switch {
+		case strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!"):
+			continue
+
+		case strings.HasPrefix(tag, "/"):
+			name := tag[1:]
+			// closing tags of elements that hold a value (XML) are not on the stack
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].Name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+
+		case text != "":
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, &node{Name: tag, Value: text})
+
+		default:
+			parent := stack[len(stack)-1]
+			child := &node{Name: tag}
+			parent.Children = append(parent.Children, child)
+			stack = append(stack, child)
+		}
+	}
+
+	return root, nil
+}
+
+// child returns the first direct child with the given name
+func (n *node) child(name string) *node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// children returns every direct child with the given name
+func (n *node) children(name string) []*node {
+	var found []*node
+	for _, c := range n.Children {
+		if c.Name == name {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// findAll returns every descendant with the given name
+func (n *node) findAll(name string) []*node {
+	var found []*node
+	for _, c := range n.Children {
+		if c.Name == name {
+			found = append(found, c)
+		}
+		found = append(found, c.findAll(name)...)
+	}
+	return found
+}
+
+// value follows the path of child names and returns the value of the last one, or "" if missing
+func (n *node) value(path ...string) string {
+	current := n
+	for _, name := range path {
+		if current = current.child(name); current == nil {
+			return ""
+		}
+	}
+	return current.Value
+}
@@ -0,0 +1,399 @@
+package output
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonEncoder writes each batch as a compact JSON array on its own line, the original output format
+type jsonEncoder struct {
+	w io.Writer
+}
+
+func newJSONEncoder(w io.Writer, _ Options) OutputEncoder {
+	return &jsonEncoder{w: w}
+}
+
+func (e *jsonEncoder) Encode(ctx context.Context, results []domain.Tax) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeJSONLine(e.w, results)
+}
+
+func (e *jsonEncoder) EncodeError(ctx context.Context, record ErrorRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeJSONLine(e.w, record)
+}
+
+func (e *jsonEncoder) Flush() error { return nil }
+
+// ndjsonEncoder writes one JSON object per operation, tagged with its batch and position
+type ndjsonEncoder struct {
+	w     io.Writer
+	batch int
+}
+
+type ndjsonResult struct {
+	Batch     int `json:"batch"`
+	Operation int `json:"operation"`
+	domain.Tax
+}
+
+type ndjsonError struct {
+	Batch int `json:"batch"`
+	ErrorRecord
+}
+
+func newNDJSONEncoder(w io.Writer, _ Options) OutputEncoder {
+	return &ndjsonEncoder{w: w}
+}
+
+func (e *ndjsonEncoder) Encode(ctx context.Context, results []domain.Tax) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.batch++
+	for i, result := range results {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := writeJSONLine(e.w, ndjsonResult{Batch: e.batch, Operation: i + 1, Tax: result}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ndjsonEncoder) EncodeError(ctx context.Context, record ErrorRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.batch++
+	return writeJSONLine(e.w, ndjsonError{Batch: e.batch, ErrorRecord: record})
+}
+
+func (e *ndjsonEncoder) Flush() error { return nil }
+
+func writeJSONLine(w io.Writer, v any) error {
+	output, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(output, '\n'))
+	return err
+}
+
+// explanationColumns are added between the adjustment columns and error by --explain
+var explanationColumns = []string{
+	"reason", "average-cost-before", "average-cost-after", "sale-value", "gross-profit",
+	"loss-used", "loss-added", "taxable-base", "rate",
+}
+
+// adjustmentColumns are filled in the rows added below a cancel, amend or back-dated trade, one per
+// earlier operation whose tax it changed
+var adjustmentColumns = []string{"adjusts", "tax-before", "tax-after", "difference"}
+
+// columns are the header shared by the tabular formats (csv, markdown and table), error is always the last one
+func columns(explain bool) []string {
+	header := append([]string{"batch", "operation", "tax"}, adjustmentColumns...)
+	if explain {
+		header = append(header, explanationColumns...)
+	}
+	return append(header, "error")
+}
+
+// resultRows turns the results of a batch into the cells of the tabular formats. The adjustments of a
+// result follow its row, with an empty tax
+func resultRows(batch int, results []domain.Tax, explain bool) [][]string {
+	var rows [][]string
+	for i, result := range results {
+		row := []string{strconv.Itoa(batch), strconv.Itoa(i + 1), formatAmount(result.Tax)}
+		row = append(row, make([]string, len(adjustmentColumns))...)
+		if explain {
+			row = append(row, explanationCells(result.Explanation)...)
+		}
+		rows = append(rows, append(row, ""))
+
+		for _, adjustment := range result.Adjustments {
+			row := []string{
+				strconv.Itoa(batch), strconv.Itoa(i + 1), "",
+				strconv.Itoa(adjustment.Operation),
+				formatAmount(adjustment.Before),
+				formatAmount(adjustment.After),
+				formatAmount(adjustment.Difference),
+			}
+			if explain {
+				row = append(row, make([]string, len(explanationColumns))...)
+			}
+			rows = append(rows, append(row, ""))
+		}
+	}
+	return rows
+}
+
+func explanationCells(explanation *domain.Explanation) []string {
+	if explanation == nil {
+		return make([]string, len(explanationColumns))
+	}
+	return []string{
+		explanation.Reason,
+		formatAmount(explanation.AverageCostBefore),
+		formatAmount(explanation.AverageCostAfter),
+		formatAmount(explanation.SaleValue),
+		formatAmount(explanation.GrossProfit),
+		formatAmount(explanation.LossUsed),
+		formatAmount(explanation.LossAdded),
+		formatAmount(explanation.TaxableBase),
+		formatAmount(explanation.Rate),
+	}
+}
+
+func errorRow(batch int, record ErrorRecord, explain bool) []string {
+	row := make([]string, len(columns(explain)))
+	row[0] = strconv.Itoa(batch)
+	row[len(row)-1] = record.Error
+	return row
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// csvEncoder writes a single CSV document with a header row, for spreadsheets
+type csvEncoder struct {
+	w       *csv.Writer
+	explain bool
+	batch   int
+	header  bool
+}
+
+func newCSVEncoder(w io.Writer, options Options) OutputEncoder {
+	return &csvEncoder{w: csv.NewWriter(w), explain: options.Explain}
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(columns(e.explain))
+}
+
+func (e *csvEncoder) Encode(ctx context.Context, results []domain.Tax) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.batch++
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	if err := e.w.WriteAll(resultRows(e.batch, results, e.explain)); err != nil {
+		return err
+	}
+	return e.w.Error()
+}
+
+func (e *csvEncoder) EncodeError(ctx context.Context, record ErrorRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.batch++
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	if err := e.w.Write(errorRow(e.batch, record, e.explain)); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvEncoder) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// markdownEncoder writes a GitHub flavored Markdown table, for pull-request comments
+type markdownEncoder struct {
+	w       io.Writer
+	explain bool
+	batch   int
+	header  bool
+}
+
+func newMarkdownEncoder(w io.Writer, options Options) OutputEncoder {
+	return &markdownEncoder{w: w, explain: options.Explain}
+}
+
+func (e *markdownEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	var titles, alignments []string
+	for _, column := range columns(e.explain) {
+		titles = append(titles, title(column))
+		if leftAligned(column) {
+			alignments = append(alignments, "---")
+		} else {
+			alignments = append(alignments, "---:")
+		}
+	}
+	_, err := fmt.Fprintf(e.w, "| %s |\n| %s |\n", strings.Join(titles, " | "), strings.Join(alignments, " | "))
+	return err
+}
+
+func (e *markdownEncoder) writeRow(row []string) error {
+	for i, cell := range row {
+		row[i] = strings.ReplaceAll(cell, "|", `\|`)
+	}
+	_, err := fmt.Fprintf(e.w, "| %s |\n", strings.Join(row, " | "))
+	return err
+}
+
+func (e *markdownEncoder) Encode(ctx context.Context, results []domain.Tax) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.batch++
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	for _, row := range resultRows(e.batch, results, e.explain) {
+		if err := e.writeRow(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *markdownEncoder) EncodeError(ctx context.Context, record ErrorRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.batch++
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.writeRow(errorRow(e.batch, record, e.explain))
+}
+
+// title turns a column name into a Markdown heading, e.g. loss-used becomes Loss Used
+func title(column string) string {
+	words := strings.Split(column, "-")
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// leftAligned reports whether a column holds text, numbers are right aligned
+func leftAligned(column string) bool {
+	return column == "error" || column == "reason"
+}
+
+func (e *markdownEncoder) Flush() error {
+	return e.writeHeader()
+}
+
+// tableEncoder writes an aligned table for terminals. Rows are buffered until Flush
+// since the column widths depend on every row
+type tableEncoder struct {
+	w       io.Writer
+	color   bool
+	explain bool
+	batch   int
+	rows    [][]string
+}
+
+const (
+	colorReset  = "\033[0m"
+	colorYellow = "\033[33m"
+	colorRed    = "\033[31m"
+)
+
+func newTableEncoder(w io.Writer, options Options) OutputEncoder {
+	return &tableEncoder{w: w, color: options.Color, explain: options.Explain}
+}
+
+func (e *tableEncoder) Encode(ctx context.Context, results []domain.Tax) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.batch++
+	e.rows = append(e.rows, resultRows(e.batch, results, e.explain)...)
+	return nil
+}
+
+func (e *tableEncoder) EncodeError(ctx context.Context, record ErrorRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.batch++
+	e.rows = append(e.rows, errorRow(e.batch, record, e.explain))
+	return nil
+}
+
+func (e *tableEncoder) Flush() error {
+	header := columns(e.explain)
+	titles := make([]string, len(header))
+	for i, column := range header {
+		titles[i] = strings.ToUpper(column)
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{titles}, e.rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	if err := e.writeRow(header, titles, widths, ""); err != nil {
+		return err
+	}
+	for _, row := range e.rows {
+		color := ""
+		if row[len(row)-1] != "" {
+			color = colorRed
+		} else if row[2] != formatAmount(0) {
+			color = colorYellow
+		}
+		if err := e.writeRow(header, row, widths, color); err != nil {
+			return err
+		}
+	}
+	e.rows = nil
+	return nil
+}
+
+func (e *tableEncoder) writeRow(header, row []string, widths []int, color string) error {
+	cells := make([]string, len(row))
+	for i, cell := range row {
+		padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		if leftAligned(header[i]) {
+			cells[i] = cell + padding
+		} else {
+			cells[i] = padding + cell
+		}
+	}
+
+	line := strings.TrimRight(strings.Join(cells, "  "), " ")
+	if e.color && color != "" {
+		line = color + line + colorReset
+	}
+	_, err := fmt.Fprintln(e.w, line)
+	return err
+}
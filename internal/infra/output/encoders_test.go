@@ -0,0 +1,234 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"strings"
+	"testing"
+)
+
+// encodeSample writes two batches, the second one failed to decode
+func encodeSample(t *testing.T, format string, options Options) string {
+	t.Helper()
+	factory, ok := Lookup(format)
+	if !ok {
+		t.Fatalf("Assertion failed: format %q is not registered", format)
+	}
+	var buffer bytes.Buffer
+	encoder := factory(&buffer, options)
+
+	if err := encoder.Encode(context.Background(), []domain.Tax{{Tax: 0}, {Tax: 10000}}); err != nil {
+		t.Fatalf("Assertion failed: Encode returned %v", err)
+	}
+	if err := encoder.EncodeError(context.Background(), ErrorRecord{Line: 2, Offset: 120, Error: "unexpected end of JSON input"}); err != nil {
+		t.Fatalf("Assertion failed: EncodeError returned %v", err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Assertion failed: Flush returned %v", err)
+	}
+	return buffer.String()
+}
+
+func TestJSONEncoder(t *testing.T) {
+	expected := `[{"tax":0},{"tax":10000}]` + "\n" +
+		`{"line":2,"offset":120,"error":"unexpected end of JSON input"}` + "\n"
+
+	if result := encodeSample(t, "json", Options{}); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+	expected := `{"batch":1,"operation":1,"tax":0}` + "\n" +
+		`{"batch":1,"operation":2,"tax":10000}` + "\n" +
+		`{"batch":2,"line":2,"offset":120,"error":"unexpected end of JSON input"}` + "\n"
+
+	if result := encodeSample(t, "ndjson", Options{}); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	expected := "batch,operation,tax,adjusts,tax-before,tax-after,difference,error\n" +
+		"1,1,0.00,,,,,\n" +
+		"1,2,10000.00,,,,,\n" +
+		"2,,,,,,,unexpected end of JSON input\n"
+
+	if result := encodeSample(t, "csv", Options{}); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+func TestMarkdownEncoder(t *testing.T) {
+	expected := "| Batch | Operation | Tax | Adjusts | Tax Before | Tax After | Difference | Error |\n" +
+		"| ---: | ---: | ---: | ---: | ---: | ---: | ---: | --- |\n" +
+		"| 1 | 1 | 0.00 |  |  |  |  |  |\n" +
+		"| 1 | 2 | 10000.00 |  |  |  |  |  |\n" +
+		"| 2 |  |  |  |  |  |  | unexpected end of JSON input |\n"
+
+	if result := encodeSample(t, "markdown", Options{}); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+func TestTableEncoder(t *testing.T) {
+	expected := "BATCH  OPERATION       TAX  ADJUSTS  TAX-BEFORE  TAX-AFTER  DIFFERENCE  ERROR\n" +
+		"    1          1      0.00\n" +
+		"    1          2  10000.00\n" +
+		"    2                                                                   unexpected end of JSON input\n"
+
+	if result := encodeSample(t, "table", Options{}); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+func TestTableEncoder_Colors(t *testing.T) {
+	expected := "BATCH  OPERATION       TAX  ADJUSTS  TAX-BEFORE  TAX-AFTER  DIFFERENCE  ERROR\n" +
+		"    1          1      0.00\n" +
+		colorYellow + "    1          2  10000.00" + colorReset + "\n" +
+		colorRed + "    2                                                                   unexpected end of JSON input" + colorReset + "\n"
+
+	if result := encodeSample(t, "table", Options{Color: true}); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+// encodeAdjustments writes a batch whose last operation, an amend, changed the tax of the second one
+func encodeAdjustments(t *testing.T, format string) string {
+	t.Helper()
+	factory, _ := Lookup(format)
+	var buffer bytes.Buffer
+	encoder := factory(&buffer, Options{})
+
+	results := []domain.Tax{{Tax: 0}, {Tax: 0}, {Tax: 0, Adjustments: []domain.Adjustment{{Operation: 2, Before: 0, After: 20000, Difference: 20000}}}}
+	if err := encoder.Encode(context.Background(), results); err != nil {
+		t.Fatalf("Assertion failed: Encode returned %v", err)
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Assertion failed: Flush returned %v", err)
+	}
+	return buffer.String()
+}
+
+func TestCSVEncoder_Adjustments(t *testing.T) {
+	expected := "batch,operation,tax,adjusts,tax-before,tax-after,difference,error\n" +
+		"1,1,0.00,,,,,\n" +
+		"1,2,0.00,,,,,\n" +
+		"1,3,0.00,,,,,\n" +
+		"1,3,,2,0.00,20000.00,20000.00,\n"
+
+	if result := encodeAdjustments(t, "csv"); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+func TestMarkdownEncoder_Adjustments(t *testing.T) {
+	expected := "| 1 | 3 | 0.00 |  |  |  |  |  |\n" +
+		"| 1 | 3 |  | 2 | 0.00 | 20000.00 | 20000.00 |  |\n"
+
+	if result := encodeAdjustments(t, "markdown"); !strings.HasSuffix(result, expected) {
+		t.Errorf("Assertion failed: output = %q, want rows %q", result, expected)
+	}
+}
+
+func TestTableEncoder_Adjustments(t *testing.T) {
+	expected := "    1          3  0.00\n" +
+		"    1          3              2        0.00   20000.00    20000.00\n"
+
+	if result := encodeAdjustments(t, "table"); !strings.HasSuffix(result, expected) {
+		t.Errorf("Assertion failed: output = %q, want rows %q", result, expected)
+	}
+}
+
+func TestIsTerminal_NotAFile(t *testing.T) {
+	if IsTerminal(&bytes.Buffer{}) {
+		t.Errorf("Assertion failed: a buffer is not a terminal")
+	}
+}
+
+func TestCSVEncoder_Explain(t *testing.T) {
+	var buffer bytes.Buffer
+	encoder := newCSVEncoder(&buffer, Options{Explain: true})
+	explanation := &domain.Explanation{
+		AverageCostBefore: 10,
+		AverageCostAfter:  10,
+		SaleValue:         100000,
+		GrossProfit:       50000,
+		TaxableBase:       50000,
+		Rate:              domain.TAX_RATE,
+		Reason:            domain.ReasonTaxedProfit,
+	}
+
+	encoder.Encode(context.Background(), []domain.Tax{{Tax: 10000, Explanation: explanation}})
+	encoder.EncodeError(context.Background(), ErrorRecord{Line: 2, Error: "unexpected end of JSON input"})
+	encoder.Flush()
+
+	expected := "batch,operation,tax,adjusts,tax-before,tax-after,difference,reason,average-cost-before,average-cost-after,sale-value,gross-profit,loss-used,loss-added,taxable-base,rate,error\n" +
+		"1,1,10000.00,,,,,TAXED_PROFIT,10.00,10.00,100000.00,50000.00,0.00,0.00,50000.00,0.20,\n" +
+		"2,,,,,,,,,,,,,,,,unexpected end of JSON input\n"
+	if result := buffer.String(); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+func TestMarkdownEncoder_ExplainHeader(t *testing.T) {
+	result := encodeSample(t, "markdown", Options{Explain: true})
+
+	expected := "| Batch | Operation | Tax | Adjusts | Tax Before | Tax After | Difference | Reason | Average Cost Before | Average Cost After | Sale Value | Gross Profit | Loss Used | Loss Added | Taxable Base | Rate | Error |\n" +
+		"| ---: | ---: | ---: | ---: | ---: | ---: | ---: | --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: | --- |\n"
+	if !strings.HasPrefix(result, expected) {
+		t.Errorf("Assertion failed: output = %q, want header %q", result, expected)
+	}
+}
+
+func TestWriteLossReport(t *testing.T) {
+	ledgers := []application.LossLedger{
+		{Group: "", Entries: []domain.LossEntry{{Origin: domain.Origin{Operation: 2}, Amount: 500, Remaining: 500}}},
+		{
+			Group: "stocks",
+			Entries: []domain.LossEntry{
+				{
+					Origin:    domain.Origin{Operation: 3, Ticker: "VALE3", Date: "2024-03-01"},
+					Amount:    50000,
+					Remaining: 30000,
+					Consumptions: []domain.LossConsumption{
+						{Origin: domain.Origin{Operation: 5, Ticker: "PETR4", Date: "2024-04-02"}, Amount: 20000},
+					},
+				},
+			},
+		},
+	}
+	var buffer bytes.Buffer
+
+	if err := WriteLossReport(&buffer, 1, ledgers); err != nil {
+		t.Fatalf("Assertion failed: WriteLossReport returned %v", err)
+	}
+
+	expected := "batch 1\n" +
+		"  loss 500.00 from operation 2, remaining 500.00\n" +
+		"batch 1 stocks\n" +
+		"  loss 50000.00 from operation 3 VALE3 (2024-03-01), remaining 30000.00\n" +
+		"    used 20000.00 by operation 5 PETR4 (2024-04-02)\n"
+	if result := buffer.String(); result != expected {
+		t.Errorf("Assertion failed: output = %q, want %q", result, expected)
+	}
+}
+
+func TestEncoders_StopWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, format := range Names() {
+		factory, _ := Lookup(format)
+		encoder := factory(&bytes.Buffer{}, Options{})
+
+		if err := encoder.Encode(ctx, []domain.Tax{{Tax: 0}}); err != context.Canceled {
+			t.Errorf("Assertion failed: %s Encode returned %v, want context.Canceled", format, err)
+		}
+		if err := encoder.EncodeError(ctx, ErrorRecord{Line: 1}); err != context.Canceled {
+			t.Errorf("Assertion failed: %s EncodeError returned %v, want context.Canceled", format, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package output
+
+import (
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"io"
+)
+
+// WriteLossReport writes how every loss of a batch was created and used up, for a tax audit.
+// Nothing is written when the batch had no loss
+func WriteLossReport(w io.Writer, batch int, ledgers []application.LossLedger) error {
+	for _, ledger := range ledgers {
+		header := fmt.Sprintf("batch %d", batch)
+		if ledger.Group != "" {
+			header += " " + ledger.Group
+		}
+		if _, err := fmt.Fprintln(w, header); err != nil {
+			return err
+		}
+
+		for _, entry := range ledger.Entries {
+			_, err := fmt.Fprintf(w, "  loss %s from %s, remaining %s\n",
+				formatAmount(entry.Amount), describeOrigin(entry.Origin), formatAmount(entry.Remaining))
+			if err != nil {
+				return err
+			}
+			for _, consumption := range entry.Consumptions {
+				_, err := fmt.Fprintf(w, "    used %s by %s\n", formatAmount(consumption.Amount), describeOrigin(consumption.Origin))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func describeOrigin(origin domain.Origin) string {
+	description := fmt.Sprintf("operation %d", origin.Operation)
+	if origin.Ticker != "" {
+		description += " " + origin.Ticker
+	}
+	if origin.Date != "" {
+		description += fmt.Sprintf(" (%s)", origin.Date)
+	}
+	return description
+}
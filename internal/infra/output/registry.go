@@ -0,0 +1,83 @@
+package output
+
+import (
+	"context"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"io"
+	"os"
+)
+
+// ErrorRecord is written in place of the results of a batch that could not be decoded
+type ErrorRecord struct {
+	Line   int                    `json:"line"`
+	Offset int64                  `json:"offset"`
+	Error  string                 `json:"error"`
+	Issues []json.ValidationError `json:"issues,omitempty"`
+}
+
+// OutputEncoder writes the results of every batch of operations in one output format
+type OutputEncoder interface {
+	// Encode writes the results of one batch. It returns the error of ctx when it is done before
+	// the results are written
+	Encode(ctx context.Context, results []domain.Tax) error
+	// EncodeError writes the record of a batch that could not be decoded or processed
+	EncodeError(ctx context.Context, record ErrorRecord) error
+	// Flush writes anything still buffered, it is called once after the last batch, also after
+	// a cancellation, so what was encoded is not lost
+	Flush() error
+}
+
+// Options configures the encoders; each format only reads the fields it needs
+type Options struct {
+	Color   bool // table: highlight taxes and errors with ANSI colors
+	Explain bool // csv, markdown and table: add the explanation columns. JSON formats write the field when it is set
+}
+
+// Factory creates an encoder that writes to w
+type Factory func(w io.Writer, options Options) OutputEncoder
+
+var (
+	factories = make(map[string]Factory)
+	order     []string
+)
+
+func init() {
+	Register("json", newJSONEncoder)
+	Register("ndjson", newNDJSONEncoder)
+	Register("csv", newCSVEncoder)
+	Register("table", newTableEncoder)
+	Register("markdown", newMarkdownEncoder)
+}
+
+// Register makes an output format available by name. Registering a name twice replaces the factory
+func Register(name string, factory Factory) {
+	if _, ok := factories[name]; !ok {
+		order = append(order, name)
+	}
+	factories[name] = factory
+}
+
+// Lookup returns the factory of the output format registered with name
+func Lookup(name string) (Factory, bool) {
+	factory, ok := factories[name]
+	return factory, ok
+}
+
+// Names returns the registered format names in registration order
+func Names() []string {
+	return append([]string(nil), order...)
+}
+
+// IsTerminal reports whether w is a terminal, so colors can be enabled. NO_COLOR disables them
+func IsTerminal(w io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,347 @@
+package sinacor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/infra/csv"
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"github.com/andreposman/capital-gains/pkg/helpers"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Note is a brokerage note (nota de corretagem) in the SINACOR layout
+type Note struct {
+	Number     string
+	Date       string // trading date, json.DateLayout
+	Operations []json.Operation
+
+	SettlementFee   float64 // taxa de liquidação
+	RegistrationFee float64 // taxa de registro
+	Emoluments      float64 // emolumentos
+	OperationalFee  float64 // taxa operacional / corretagem
+	ServiceTax      float64 // ISS
+}
+
+// Fees returns the note-level costs that are apportioned across the trades
+func (n Note) Fees() float64 {
+	return helpers.ToFixedDecimal(n.SettlementFee+n.RegistrationFee+n.Emoluments+n.OperationalFee+n.ServiceTax, 2)
+}
+
+// LineError is a trade line that could not be interpreted
+type LineError struct {
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v: %q", e.Line, e.Err, e.Text)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	noteHeader = regexp.MustCompile(`(?i)^\s*nota de corretagem`)
+	number     = regexp.MustCompile(`\d{1,3}(?:\.\d{3})*,\d+|\d+,\d+`)
+	date       = regexp.MustCompile(`\b(\d{2}/\d{2}/\d{4})\b`)
+	noteNumber = regexp.MustCompile(`^\s*(\d+)\s+\d+\s+\d{2}/\d{2}/\d{4}\s*$`)
+	// some layouts print the labels inline, e.g. "Nr. nota: 98765"
+	noteNumberLabel = regexp.MustCompile(`(?i)nr\.?\s*nota:?\s*(\d+)`)
+
+	// trade lines start with the exchange, e.g. "1-BOVESPA" in the older layout or "B3 RV LISTADO" in the newer one,
+	// followed by the side and the market type
+	tradePrefix = regexp.MustCompile(`(?i)^\s*(?:1-BOVESPA|B3\s+RV\s+LISTADO)\s`)
+	trade       = regexp.MustCompile(`(?i)^\s*(?:1-BOVESPA|B3\s+RV\s+LISTADO)\s+([CV])\s+(.+?)\s+(\d[\d.]*)\s+([\d.]+,\d+)\s+([\d.]+,\d{2})\s+([DC])\s*$`)
+
+	// observation markers that may follow the security specification (# = negócio direto, D = day trade...)
+	observation = regexp.MustCompile(`^(?:#|[A-Z]|#[A-Z])$`)
+	ticker      = regexp.MustCompile(`^[A-Z]{4}\d{1,2}F?$`)
+	governance  = regexp.MustCompile(`^(?:N1|N2|NM|MA|M2|ED|EJ|EDJ|EX|ER|ES|EB|EC|DRN|#)$`)
+)
+
+// shareClasses are the ticker suffixes of the share classes printed after the issuer name
+var shareClasses = map[string]string{
+	"ON":  "3",
+	"PN":  "4",
+	"PNA": "5",
+	"PNB": "6",
+	"PNC": "7",
+	"PND": "8",
+	"UNT": "11",
+}
+
+// Issuers maps the issuer names (nome de pregão) printed by layouts without tickers, e.g. "PETROBRAS PN",
+// to the root of their ticker
+var Issuers = map[string]string{
+	"AMBEV S/A":    "ABEV",
+	"B3":           "B3SA",
+	"BBSEGURIDADE": "BBSE",
+	"BRADESCO":     "BBDC",
+	"BRASIL":       "BBAS",
+	"CEMIG":        "CMIG",
+	"ELETROBRAS":   "ELET",
+	"EMBRAER":      "EMBR",
+	"GERDAU":       "GGBR",
+	"ITAUSA":       "ITSA",
+	"ITAUUNIBANCO": "ITUB",
+	"JBS":          "JBSS",
+	"KLABIN S/A":   "KLBN",
+	"LOCALIZA":     "RENT",
+	"LOJAS RENNER": "LREN",
+	"MAGAZ LUIZA":  "MGLU",
+	"PETROBRAS":    "PETR",
+	"SABESP":       "SBSP",
+	"SID NACIONAL": "CSNA",
+	"SUZANO S.A.":  "SUZB",
+	"TAESA":        "TAEE",
+	"USIMINAS":     "USIM",
+	"VALE":         "VALE",
+	"WEG":          "WEGE",
+}
+
+// tradedMarkets are the market types turned into operations; options and forward trades are skipped
+var tradedMarkets = map[string]bool{
+	"VISTA":       true,
+	"FRACIONARIO": true,
+}
+
+var feeLabels = []struct {
+	prefix string
+	fee    func(*Note) *float64
+}{
+	{"taxa de liquidação", func(n *Note) *float64 { return &n.SettlementFee }},
+	{"taxa de liquidacao", func(n *Note) *float64 { return &n.SettlementFee }},
+	{"taxa de registro", func(n *Note) *float64 { return &n.RegistrationFee }},
+	{"emolumentos", func(n *Note) *float64 { return &n.Emoluments }},
+	{"taxa operacional", func(n *Note) *float64 { return &n.OperationalFee }},
+	{"corretagem", func(n *Note) *float64 { return &n.OperationalFee }},
+	{"iss", func(n *Note) *float64 { return &n.ServiceTax }},
+	{"impostos", func(n *Note) *float64 { return &n.ServiceTax }},
+}
+
+// ParseNotes reads the text extracted from one or more brokerage notes (e.g. with pdftotext -layout).
+// Each note starts at a "NOTA DE CORRETAGEM" title; its fees are apportioned across its trades
+// in proportion to their value. issuers adds to, or overrides, the ticker roots of Issuers
+func ParseNotes(r io.Reader, issuers map[string]string) ([]Note, error) {
+	scanner := bufio.NewScanner(r)
+	var notes []Note
+	var current *Note
+	var errs []error
+	expectDate := false
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		lower := strings.ToLower(strings.TrimSpace(line))
+
+		if noteHeader.MatchString(line) {
+			notes = append(notes, Note{})
+			current = &notes[len(notes)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		if current.Number == "" {
+			if match := noteNumberLabel.FindStringSubmatch(line); match != nil {
+				current.Number = match[1]
+			}
+		}
+
+		if strings.Contains(lower, "data pregão") || strings.Contains(lower, "data pregao") {
+			expectDate = true
+		}
+		if expectDate && current.Date == "" {
+			if match := date.FindStringSubmatch(line); match != nil {
+				parsed, _ := time.Parse("02/01/2006", match[1])
+				current.Date = parsed.Format(json.DateLayout)
+				if numberMatch := noteNumber.FindStringSubmatch(line); numberMatch != nil {
+					current.Number = numberMatch[1]
+				}
+				expectDate = false
+				continue
+			}
+		}
+
+		if match := trade.FindStringSubmatch(line); match != nil {
+			operation, ok, err := parseTrade(match, issuers)
+			if err != nil {
+				errs = append(errs, &LineError{Line: lineNumber, Text: strings.TrimSpace(line), Err: err})
+				continue
+			}
+			if ok {
+				operation.Date = current.Date
+				current.Operations = append(current.Operations, operation)
+			}
+			continue
+		}
+		if tradePrefix.MatchString(line) {
+			errs = append(errs, &LineError{Line: lineNumber, Text: strings.TrimSpace(line), Err: errors.New("unrecognized trade line")})
+			continue
+		}
+
+		for _, label := range feeLabels {
+			if strings.HasPrefix(lower, label.prefix) {
+				if values := number.FindAllString(line, -1); len(values) > 0 {
+					value, err := csv.ParseNumber(values[len(values)-1], ',')
+					if err == nil {
+						*label.fee(current) = value
+					}
+				}
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(notes) == 0 {
+		return nil, errors.New("no brokerage note found, expected a \"NOTA DE CORRETAGEM\" title")
+	}
+
+	for i := range notes {
+		apportionFees(&notes[i])
+		identifyTrades(&notes[i])
+	}
+	return notes, errors.Join(errs...)
+}
+
+// Operations returns the trades of every note, in order
+func Operations(notes []Note) []json.Operation {
+	operations := []json.Operation{}
+	for _, note := range notes {
+		operations = append(operations, note.Operations...)
+	}
+	return operations
+}
+
+// parseTrade turns a matched trade line into an operation. ok is false for markets that are not traded as shares
+func parseTrade(match []string, issuers map[string]string) (json.Operation, bool, error) {
+	side, rest, quantity, price := match[1], strings.Fields(match[2]), match[3], match[4]
+
+	if len(rest) < 2 {
+		return json.Operation{}, false, errors.New("missing market type or security")
+	}
+	market := strings.ToUpper(rest[0])
+	if !tradedMarkets[market] {
+		return json.Operation{}, false, nil
+	}
+
+	var operation json.Operation
+	var err error
+	if operation.Ticker, err = security(rest[1:], issuers); err != nil {
+		return operation, false, err
+	}
+	if operation.Operation, err = csv.ParseSide(side); err != nil {
+		return operation, false, err
+	}
+	if operation.Quantity, err = csv.ParseQuantity(quantity, ','); err != nil {
+		return operation, false, fmt.Errorf("invalid quantity %q", quantity)
+	}
+	if operation.UnitCost, err = csv.ParseNumber(price, ','); err != nil {
+		return operation, false, fmt.Errorf("invalid price %q", price)
+	}
+	return operation, true, nil
+}
+
+// security identifies the traded asset from the specification column. Layouts that print the ticker
+// (e.g. "PETR4 PN N2") use it, others print the issuer name and share class (e.g. "PETROBRAS PN"),
+// which are mapped to the ticker so every layout names the asset the same way
+func security(specification []string, issuers map[string]string) (string, error) {
+	for len(specification) > 1 && observation.MatchString(specification[len(specification)-1]) {
+		specification = specification[:len(specification)-1]
+	}
+
+	for _, token := range specification {
+		if ticker.MatchString(token) {
+			return strings.TrimSuffix(token, "F"), nil
+		}
+	}
+
+	var name []string
+	for _, token := range specification {
+		if !governance.MatchString(token) {
+			name = append(name, token)
+		}
+	}
+	if len(name) < 2 {
+		return "", fmt.Errorf("no share class in security %q", strings.Join(name, " "))
+	}
+
+	issuer, class := strings.Join(name[:len(name)-1], " "), name[len(name)-1]
+	suffix, ok := shareClasses[strings.ToUpper(class)]
+	if !ok {
+		return "", fmt.Errorf("unknown share class %q in security %q", class, strings.Join(name, " "))
+	}
+	root, ok := issuers[strings.ToUpper(issuer)]
+	if !ok {
+		root, ok = Issuers[strings.ToUpper(issuer)]
+	}
+	if !ok {
+		return "", fmt.Errorf("unknown issuer %q, its ticker cannot be told from the note", issuer)
+	}
+	return root + suffix, nil
+}
+
+// ParseIssuers reads ticker roots given as issuer=root pairs, e.g. "PETROBRAS=PETR,VALE=VALE"
+func ParseIssuers(mapping string) (map[string]string, error) {
+	issuers := map[string]string{}
+	if strings.TrimSpace(mapping) == "" {
+		return issuers, nil
+	}
+
+	for _, pair := range strings.Split(mapping, ",") {
+		issuer, root, ok := strings.Cut(pair, "=")
+		issuer, root = strings.ToUpper(strings.TrimSpace(issuer)), strings.ToUpper(strings.TrimSpace(root))
+		if !ok || issuer == "" || root == "" {
+			return nil, fmt.Errorf("invalid issuer mapping %q, want issuer=ticker root", pair)
+		}
+		issuers[issuer] = root
+	}
+	return issuers, nil
+}
+
+// apportionFees splits the note fees across the trades in proportion to their value,
+// the rounding difference goes to the last trade so the total is preserved
+func apportionFees(note *Note) {
+	total := note.Fees()
+	if total == 0 || len(note.Operations) == 0 {
+		return
+	}
+
+	var notional float64
+	for _, operation := range note.Operations {
+		notional += float64(operation.Quantity) * operation.UnitCost
+	}
+
+	remaining := total
+	last := len(note.Operations) - 1
+	for i := range note.Operations {
+		operation := &note.Operations[i]
+		if i == last {
+			operation.Fees = helpers.ToFixedDecimal(remaining, 2)
+			break
+		}
+		operation.Fees = helpers.ToFixedDecimal(total*float64(operation.Quantity)*operation.UnitCost/notional, 2)
+		remaining -= operation.Fees
+	}
+}
+
+// identifyTrades gives each trade of a note with a number the id "note-<number>/<n>", n being its
+// 1-based position in the note, so importing the same note twice is a no-op
+func identifyTrades(note *Note) {
+	if note.Number == "" {
+		return
+	}
+	for i := range note.Operations {
+		note.Operations[i].ID = fmt.Sprintf("note-%s/%d", note.Number, i+1)
+	}
+}
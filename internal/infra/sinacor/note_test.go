@@ -0,0 +1,164 @@
+package sinacor
+
+import (
+	"github.com/andreposman/capital-gains/internal/infra/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parseFile(t *testing.T, path string) []Note {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	notes, err := ParseNotes(file, nil)
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	return notes
+}
+
+func TestParseNotes_ClearLayout(t *testing.T) {
+	notes := parseFile(t, "testdata/clear.txt")
+
+	if len(notes) != 1 {
+		t.Fatalf("Assertion failed: expected 1 note, got %d", len(notes))
+	}
+	note := notes[0]
+	if note.Number != "1234567" || note.Date != "2024-03-15" {
+		t.Errorf("Assertion failed: note %q on %q, want 1234567 on 2024-03-15", note.Number, note.Date)
+	}
+	// IRRF is not a fee of the trades
+	if note.SettlementFee != 6.75 || note.Emoluments != 1.25 || note.Fees() != 8.00 {
+		t.Errorf("Assertion failed: settlement %.2f, emolumentos %.2f, fees %.2f, want 6.75, 1.25, 8.00",
+			note.SettlementFee, note.Emoluments, note.Fees())
+	}
+
+	// fees = 8.00 over 25,260.00 of trades; the option trade is skipped
+	expected := []json.Operation{
+		{ID: "note-1234567/1", Operation: "buy", UnitCost: 35.00, Quantity: 300, Ticker: "PETR4", Date: "2024-03-15", Fees: 3.33},
+		{ID: "note-1234567/2", Operation: "buy", UnitCost: 35.20, Quantity: 50, Ticker: "PETR4", Date: "2024-03-15", Fees: 0.56},
+		{ID: "note-1234567/3", Operation: "sell", UnitCost: 65.00, Quantity: 200, Ticker: "VALE3", Date: "2024-03-15", Fees: 4.11},
+	}
+	if !reflect.DeepEqual(note.Operations, expected) {
+		t.Errorf("Assertion failed: operations = %v, want %v", note.Operations, expected)
+	}
+}
+
+func TestParseNotes_XPLayout(t *testing.T) {
+	notes := parseFile(t, "testdata/xp.txt")
+
+	if len(notes) != 1 {
+		t.Fatalf("Assertion failed: expected 1 note, got %d", len(notes))
+	}
+	note := notes[0]
+	if note.Number != "98765" || note.Date != "2024-04-02" {
+		t.Errorf("Assertion failed: note %q on %q, want 98765 on 2024-04-02", note.Number, note.Date)
+	}
+	if note.Fees() != 12.00 {
+		t.Errorf("Assertion failed: fees = %.2f, want 12.00", note.Fees())
+	}
+
+	// fees = 12.00 over 22,000.00 of trades
+	expected := []json.Operation{
+		{ID: "note-98765/1", Operation: "sell", UnitCost: 40.00, Quantity: 300, Ticker: "PETR4", Date: "2024-04-02", Fees: 6.55},
+		{ID: "note-98765/2", Operation: "buy", UnitCost: 10.00, Quantity: 1000, Ticker: "ITSA4", Date: "2024-04-02", Fees: 5.45},
+	}
+	if !reflect.DeepEqual(note.Operations, expected) {
+		t.Errorf("Assertion failed: operations = %v, want %v", note.Operations, expected)
+	}
+}
+
+func TestParseNotes_MultipleNotes(t *testing.T) {
+	clear, _ := os.ReadFile("testdata/clear.txt")
+	xp, _ := os.ReadFile("testdata/xp.txt")
+
+	notes, err := ParseNotes(strings.NewReader(string(clear)+"\f\n"+string(xp)), nil)
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("Assertion failed: expected 2 notes, got %d", len(notes))
+	}
+	if operations := Operations(notes); len(operations) != 5 {
+		t.Errorf("Assertion failed: expected 5 operations, got %d", len(operations))
+	}
+}
+
+func TestParseNotes_NotANote(t *testing.T) {
+	_, err := ParseNotes(strings.NewReader("operation,unit-cost,quantity\n"), nil)
+
+	if err == nil {
+		t.Fatalf("Assertion failed: expected an error for a text without notes, but got nil")
+	}
+}
+
+func TestParseNotes_InvalidTradeLine(t *testing.T) {
+	input := "NOTA DE CORRETAGEM\nData pregão 01/04/2024\n1-BOVESPA C VISTA PETROBRAS PN 10,5 35,00 367,50 D\n"
+
+	_, err := ParseNotes(strings.NewReader(input), nil)
+
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Assertion failed: expected an error on line 3, but got: %v", err)
+	}
+}
+
+func TestParseNotes_IssuerNames(t *testing.T) {
+	const header = "NOTA DE CORRETAGEM\nData pregão 01/04/2024\n"
+	tests := []struct {
+		name     string
+		line     string
+		issuers  map[string]string
+		expected string
+		err      string
+	}{
+		{name: "share class and governance", line: "1-BOVESPA C VISTA ITAUUNIBANCO PN ED N1 100 30,00 3.000,00 D", expected: "ITUB4"},
+		{name: "name with spaces", line: "1-BOVESPA C VISTA LOJAS RENNER ON NM 100 15,00 1.500,00 D", expected: "LREN3"},
+		{name: "unit", line: "1-BOVESPA C VISTA KLABIN S/A UNT N2 100 20,00 2.000,00 D", expected: "KLBN11"},
+		{name: "given issuer", line: "1-BOVESPA C VISTA MINERVA ON NM 100 10,00 1.000,00 D", issuers: map[string]string{"MINERVA": "BEEF"}, expected: "BEEF3"},
+		{name: "unknown issuer", line: "1-BOVESPA C VISTA MINERVA ON NM 100 10,00 1.000,00 D", err: `unknown issuer "MINERVA"`},
+		{name: "unknown share class", line: "1-BOVESPA C VISTA PETROBRAS XYZ 100 10,00 1.000,00 D", err: `unknown share class "XYZ"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notes, err := ParseNotes(strings.NewReader(header+test.line+"\n"), test.issuers)
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) || !strings.Contains(err.Error(), "line 3") {
+					t.Fatalf("Assertion failed: expected an error %q on line 3, but got: %v", test.err, err)
+				}
+				if operations := Operations(notes); len(operations) != 0 {
+					t.Errorf("Assertion failed: expected no operations, got %v", operations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+			}
+			if operations := Operations(notes); len(operations) != 1 || operations[0].Ticker != test.expected {
+				t.Errorf("Assertion failed: operations = %v, want one %s trade", operations, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseIssuers(t *testing.T) {
+	issuers, err := ParseIssuers("minerva=beef, SLC AGRICOLA = SLCE")
+
+	if err != nil {
+		t.Fatalf("Assertion failed: expected no error, but got: %v", err)
+	}
+	if expected := map[string]string{"MINERVA": "BEEF", "SLC AGRICOLA": "SLCE"}; !reflect.DeepEqual(issuers, expected) {
+		t.Errorf("Assertion failed: issuers = %v, want %v", issuers, expected)
+	}
+	if _, err := ParseIssuers("MINERVA"); err == nil {
+		t.Errorf("Assertion failed: expected an error for a pair without a ticker root, but got nil")
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/application"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	accountsBucket = []byte("accounts")
+	// historyBucket has a nested bucket per account with its records keyed by sequence
+	historyBucket = []byte("history")
+)
+
+// BoltStore keeps the accounts as JSON in an embedded bbolt file: the account state under its id
+// and the operation log in a bucket per account
+type BoltStore struct {
+	db *bbolt.DB
+}
+
+// OpenBoltStore opens or creates the file at path. Only one process can have it open
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(accountsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) Get(id string) (application.Account, error) {
+	var account application.Account
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(accountsBucket).Get([]byte(id))
+		if value == nil {
+			return application.ErrAccountNotFound
+		}
+		return json.Unmarshal(value, &account)
+	})
+	return account, err
+}
+
+// Update runs fn inside a write transaction, so a failed update leaves the file untouched
+func (s *BoltStore) Update(id string, fn func(log []application.OperationRecord) (application.Commit, error)) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		log, err := readHistory(tx, id)
+		if err != nil {
+			return err
+		}
+		commit, err := fn(log)
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(commit.Account)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(accountsBucket).Put([]byte(id), value); err != nil {
+			return err
+		}
+
+		history, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return err
+		}
+		for _, record := range commit.Records {
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			key := sequenceKey(record.Sequence)
+			if history.Get(key) != nil {
+				return fmt.Errorf("operation %d of account %q is already in the log", record.Sequence, id)
+			}
+			if err := history.Put(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) History(id string) ([]application.OperationRecord, error) {
+	var records []application.OperationRecord
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(accountsBucket).Get([]byte(id)) == nil {
+			return application.ErrAccountNotFound
+		}
+		var err error
+		records, err = readHistory(tx, id)
+		return err
+	})
+	return records, err
+}
+
+func readHistory(tx *bbolt.Tx, id string) ([]application.OperationRecord, error) {
+	var records []application.OperationRecord
+	history := tx.Bucket(historyBucket).Bucket([]byte(id))
+	if history == nil {
+		return nil, nil
+	}
+	err := history.ForEach(func(_, value []byte) error {
+		var record application.OperationRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// sequenceKey is big endian so the keys sort in sequence order
+func sequenceKey(sequence int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(sequence))
+}
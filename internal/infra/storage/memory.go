@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"sync"
+)
+
+// MemoryStore keeps the accounts in memory, they are lost when the server stops
+type MemoryStore struct {
+	mu       sync.Mutex
+	accounts map[string]application.Account
+	history  map[string][]application.OperationRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: make(map[string]application.Account),
+		history:  make(map[string][]application.OperationRecord),
+	}
+}
+
+func (s *MemoryStore) Get(id string) (application.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[id]
+	if !ok {
+		return application.Account{}, application.ErrAccountNotFound
+	}
+	return clone(account), nil
+}
+
+func (s *MemoryStore) Update(id string, fn func(log []application.OperationRecord) (application.Commit, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// fn works on a copy, so a failed update leaves the log untouched
+	commit, err := fn(append([]application.OperationRecord(nil), s.history[id]...))
+	if err != nil {
+		return err
+	}
+	s.accounts[id] = clone(commit.Account)
+	s.history[id] = append(s.history[id], commit.Records...)
+	return nil
+}
+
+func (s *MemoryStore) History(id string) ([]application.OperationRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.accounts[id]; !ok {
+		return nil, application.ErrAccountNotFound
+	}
+	return append([]application.OperationRecord(nil), s.history[id]...), nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
+
+func clone(account application.Account) application.Account {
+	portfolios := make(map[string]domain.PortfolioState, len(account.Portfolios))
+	for ticker, state := range account.Portfolios {
+		portfolios[ticker] = state
+	}
+	account.Portfolios = portfolios
+	return account
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	_ "modernc.org/sqlite"
+	"sync"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS accounts (
+	id         TEXT PRIMARY KEY,
+	operations INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS portfolios (
+	account TEXT NOT NULL REFERENCES accounts (id),
+	ticker  TEXT NOT NULL,
+	state   TEXT NOT NULL,
+	PRIMARY KEY (account, ticker)
+);
+CREATE TABLE IF NOT EXISTS operations (
+	account      TEXT    NOT NULL REFERENCES accounts (id),
+	sequence     INTEGER NOT NULL,
+	operation_id TEXT    NOT NULL DEFAULT '',
+	type         TEXT    NOT NULL,
+	unit_cost    REAL    NOT NULL,
+	quantity     INTEGER NOT NULL,
+	ticker       TEXT    NOT NULL,
+	date         TEXT    NOT NULL,
+	fees         REAL    NOT NULL,
+	ref          TEXT    NOT NULL DEFAULT '',
+	tax          REAL    NOT NULL,
+	explanation  TEXT    NOT NULL,
+	adjustments  TEXT    NOT NULL DEFAULT 'null',
+	portfolio    TEXT    NOT NULL,
+	PRIMARY KEY (account, sequence)
+);
+`
+
+// SQLiteStore keeps the accounts in a SQLite file: the current portfolio of every ticker, and every
+// operation with its tax and the portfolio snapshot after it, queryable with plain SQL.
+// It uses a pure Go driver, so it needs no cgo
+type SQLiteStore struct {
+	db *sql.DB
+	// mu serializes the updates, SQLite would otherwise fail concurrent writes with SQLITE_BUSY
+	mu sync.Mutex
+}
+
+// OpenSQLiteStore opens or creates the database at path
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// addedColumns are the columns of the operations table added after its first version
+var addedColumns = []struct{ name, definition string }{
+	{"operation_id", `TEXT NOT NULL DEFAULT ''`},
+	{"ref", `TEXT NOT NULL DEFAULT ''`},
+	{"adjustments", `TEXT NOT NULL DEFAULT 'null'`},
+}
+
+// migrateSQLite upgrades databases created by earlier versions, CREATE TABLE IF NOT EXISTS
+// leaves their tables as they were
+func migrateSQLite(db *sql.DB) error {
+	for _, column := range addedColumns {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('operations') WHERE name = ?`, column.name).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE operations ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStore) Get(id string) (application.Account, error) {
+	return loadAccount(s.db, id)
+}
+
+// Update runs fn and saves the account and the records in a single transaction, rolled back on any error
+func (s *SQLiteStore) Update(id string, fn func(log []application.OperationRecord) (application.Commit, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	log, err := loadHistory(tx, id)
+	if err != nil {
+		return err
+	}
+
+	commit, err := fn(log)
+	if err != nil {
+		return err
+	}
+	if err := saveCommit(tx, commit); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) History(id string) ([]application.OperationRecord, error) {
+	if _, err := loadAccount(s.db, id); err != nil {
+		return nil, err
+	}
+	return loadHistory(s.db, id)
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+func loadHistory(db querier, id string) ([]application.OperationRecord, error) {
+	rows, err := db.Query(`SELECT sequence, operation_id, type, unit_cost, quantity, ticker, date, fees, ref, tax, explanation,
+		adjustments, portfolio FROM operations WHERE account = ? ORDER BY sequence`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []application.OperationRecord
+	for rows.Next() {
+		var record application.OperationRecord
+		var explanation, adjustments, portfolio string
+		operation := &record.Operation
+		err := rows.Scan(&record.Sequence, &operation.ID, &operation.Type, &operation.UnitCost, &operation.Quantity, &operation.Ticker,
+			&operation.Date, &operation.Fees, &operation.Ref, &record.Tax.Tax, &explanation, &adjustments, &portfolio)
+		if err != nil {
+			return nil, err
+		}
+		// null for a cancel or amend, which has no explanation
+		if err := json.Unmarshal([]byte(explanation), &record.Tax.Explanation); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(adjustments), &record.Tax.Adjustments); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(portfolio), &record.Portfolio); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// querier is what *sql.DB and *sql.Tx have in common
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func loadAccount(db querier, id string) (application.Account, error) {
+	account := application.NewAccount(id)
+	err := db.QueryRow(`SELECT operations FROM accounts WHERE id = ?`, id).Scan(&account.Operations)
+	if errors.Is(err, sql.ErrNoRows) {
+		return application.Account{}, application.ErrAccountNotFound
+	}
+	if err != nil {
+		return application.Account{}, err
+	}
+
+	rows, err := db.Query(`SELECT ticker, state FROM portfolios WHERE account = ?`, id)
+	if err != nil {
+		return application.Account{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ticker, state string
+		if err := rows.Scan(&ticker, &state); err != nil {
+			return application.Account{}, err
+		}
+		var portfolio domain.PortfolioState
+		if err := json.Unmarshal([]byte(state), &portfolio); err != nil {
+			return application.Account{}, err
+		}
+		account.Portfolios[ticker] = portfolio
+	}
+	return account, rows.Err()
+}
+
+func saveCommit(tx *sql.Tx, commit application.Commit) error {
+	account := commit.Account
+	_, err := tx.Exec(`INSERT INTO accounts (id, operations) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET operations = excluded.operations`, account.ID, account.Operations)
+	if err != nil {
+		return err
+	}
+
+	for ticker, portfolio := range account.Portfolios {
+		state, err := json.Marshal(portfolio)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO portfolios (account, ticker, state) VALUES (?, ?, ?)
+			ON CONFLICT (account, ticker) DO UPDATE SET state = excluded.state`, account.ID, ticker, string(state))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, record := range commit.Records {
+		explanation, err := json.Marshal(record.Tax.Explanation)
+		if err != nil {
+			return err
+		}
+		adjustments, err := json.Marshal(record.Tax.Adjustments)
+		if err != nil {
+			return err
+		}
+		portfolio, err := json.Marshal(record.Portfolio)
+		if err != nil {
+			return err
+		}
+		operation := record.Operation
+		_, err = tx.Exec(`INSERT INTO operations
+			(account, sequence, operation_id, type, unit_cost, quantity, ticker, date, fees, ref, tax, explanation, adjustments, portfolio)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			account.ID, record.Sequence, operation.ID, operation.Type, operation.UnitCost, operation.Quantity, operation.Ticker,
+			operation.Date, operation.Fees, operation.Ref, record.Tax.Tax, string(explanation), string(adjustments), string(portfolio))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
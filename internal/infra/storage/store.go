@@ -0,0 +1,9 @@
+package storage
+
+import "github.com/andreposman/capital-gains/internal/application"
+
+// Store keeps the state and the history of every account of the server
+type Store interface {
+	application.PortfolioRepository
+	application.OperationStore
+}
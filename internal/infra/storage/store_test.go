@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var petr4 = domain.PortfolioState{
+	TotalShares:     100,
+	AverageCost:     10.50,
+	AccumulatedLoss: 250,
+	Ledger:          []domain.LossEntry{{Origin: domain.Origin{Operation: 2}, Amount: 250, Remaining: 250}},
+}
+
+var records = []application.OperationRecord{
+	{
+		Sequence:  1,
+		Operation: application.Operation{ID: "note-1/1", Type: "buy", UnitCost: 10.50, Quantity: 200, Ticker: "PETR4", Date: "2024-01-02"},
+		Tax:       domain.Tax{Explanation: &domain.Explanation{AverageCostAfter: 10.50, Reason: domain.ReasonBuyNoTax}},
+		Portfolio: domain.PortfolioState{TotalShares: 200, AverageCost: 10.50},
+	},
+	{
+		Sequence:  2,
+		Operation: application.Operation{Type: "sell", UnitCost: 8.00, Quantity: 100, Ticker: "PETR4", Fees: 0.5},
+		Tax:       domain.Tax{Explanation: &domain.Explanation{AverageCostBefore: 10.50, AverageCostAfter: 10.50, Reason: domain.ReasonSaleAtLoss}},
+		Portfolio: petr4,
+	},
+	{
+		Sequence:  3,
+		Operation: application.Operation{Type: "amend", UnitCost: 10.00, Quantity: 200, Ref: "note-1/1"},
+		Tax:       domain.Tax{Adjustments: []domain.Adjustment{{Operation: 2, Before: 0, After: 20, Difference: 20}}},
+		Portfolio: petr4,
+	},
+}
+
+// testStore runs the same checks against every implementation
+func testStore(t *testing.T, open func() Store) {
+	store := open()
+
+	if _, err := store.Get("alice"); !errors.Is(err, application.ErrAccountNotFound) {
+		t.Errorf("Assertion failed: Get of a new account returned %v, want ErrAccountNotFound", err)
+	}
+	if _, err := store.History("alice"); !errors.Is(err, application.ErrAccountNotFound) {
+		t.Errorf("Assertion failed: History of a new account returned %v, want ErrAccountNotFound", err)
+	}
+
+	err := store.Update("alice", func(log []application.OperationRecord) (application.Commit, error) {
+		if len(log) != 0 {
+			t.Errorf("Assertion failed: Update of a new account got the log %+v", log)
+		}
+		account := application.NewAccount("alice")
+		account.Operations = 2
+		account.Portfolios["PETR4"] = petr4
+		return application.Commit{Account: account, Records: records}, nil
+	})
+	if err != nil {
+		t.Fatalf("Assertion failed: Update returned %v", err)
+	}
+
+	failure := errors.New("rejected")
+	err = store.Update("alice", func(log []application.OperationRecord) (application.Commit, error) {
+		if !reflect.DeepEqual(log, records) {
+			t.Errorf("Assertion failed: Update got the log %+v, want %+v", log, records)
+		}
+		log[0].Sequence = 99
+		return application.Commit{Records: records}, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Assertion failed: Update returned %v, want the error of fn", err)
+	}
+
+	// reopening checks that the file implementations persist
+	store.Close()
+	store = open()
+	defer store.Close()
+
+	account, err := store.Get("alice")
+	if err != nil {
+		t.Fatalf("Assertion failed: Get returned %v", err)
+	}
+	expected := application.Account{ID: "alice", Operations: 2, Portfolios: map[string]domain.PortfolioState{"PETR4": petr4}}
+	if !reflect.DeepEqual(account, expected) {
+		t.Errorf("Assertion failed: account = %+v, want %+v", account, expected)
+	}
+
+	history, err := store.History("alice")
+	if err != nil {
+		t.Fatalf("Assertion failed: History returned %v", err)
+	}
+	if !reflect.DeepEqual(history, records) {
+		t.Errorf("Assertion failed: history = %+v, want %+v", history, records)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testStore(t, func() Store { return store })
+}
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.db")
+	testStore(t, func() Store {
+		store, err := OpenBoltStore(path)
+		if err != nil {
+			t.Fatalf("Assertion failed: OpenBoltStore returned %v", err)
+		}
+		return store
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.sqlite")
+	testStore(t, func() Store {
+		store, err := OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatalf("Assertion failed: OpenSQLiteStore returned %v", err)
+		}
+		return store
+	})
+}
+
+func TestSQLiteStore_FailedWriteRollsBackTheCommit(t *testing.T) {
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "accounts.sqlite"))
+	if err != nil {
+		t.Fatalf("Assertion failed: OpenSQLiteStore returned %v", err)
+	}
+	defer store.Close()
+	store.Update("alice", func([]application.OperationRecord) (application.Commit, error) {
+		account := application.NewAccount("alice")
+		account.Operations = 1
+		account.Portfolios["PETR4"] = records[0].Portfolio
+		return application.Commit{Account: account, Records: records[:1]}, nil
+	})
+
+	// the positions are written first, then the second record fails on the duplicated sequence
+	err = store.Update("alice", func([]application.OperationRecord) (application.Commit, error) {
+		account := application.NewAccount("alice")
+		account.Operations = 3
+		account.Portfolios["PETR4"] = petr4
+		return application.Commit{Account: account, Records: []application.OperationRecord{records[1], records[1]}}, nil
+	})
+	if err == nil {
+		t.Fatalf("Assertion failed: Update with a duplicated sequence should fail")
+	}
+
+	account, _ := store.Get("alice")
+	history, _ := store.History("alice")
+	if account.Operations != 1 || account.Portfolios["PETR4"].TotalShares != 200 || len(history) != 1 {
+		t.Errorf("Assertion failed: expected the failed commit to leave no trace, got %+v and %d records", account, len(history))
+	}
+}
+
+func TestSQLiteStore_MigratesOperationID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "accounts.sqlite")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Assertion failed: sql.Open returned %v", err)
+	}
+	// the operations table as it was before operation ids
+	_, err = db.Exec(`CREATE TABLE operations (account TEXT NOT NULL, sequence INTEGER NOT NULL, type TEXT NOT NULL,
+		unit_cost REAL NOT NULL, quantity INTEGER NOT NULL, ticker TEXT NOT NULL, date TEXT NOT NULL, fees REAL NOT NULL,
+		tax REAL NOT NULL, explanation TEXT NOT NULL, portfolio TEXT NOT NULL, PRIMARY KEY (account, sequence))`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Assertion failed: creating the old table returned %v", err)
+	}
+
+	testStore(t, func() Store {
+		store, err := OpenSQLiteStore(path)
+		if err != nil {
+			t.Fatalf("Assertion failed: OpenSQLiteStore returned %v", err)
+		}
+		return store
+	})
+}
@@ -0,0 +1,111 @@
+package capitalgains
+
+import (
+	"context"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"log/slog"
+	"sort"
+)
+
+// Calculator calculates the tax of operations with its policies. It is safe for concurrent use,
+// since every Calculate and Session starts from empty positions
+type Calculator struct {
+	policy    Policy
+	precision int
+	classes   map[string]assetClass // by ticker
+	logger    *slog.Logger
+	processor application.OperationProcessor
+}
+
+// New returns a Calculator with DefaultPolicy and DefaultPrecision, changed by options
+func New(options ...Option) (*Calculator, error) {
+	c := &Calculator{
+		policy:    DefaultPolicy,
+		precision: DefaultPrecision,
+		classes:   make(map[string]assetClass),
+	}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	c.processor = application.OperationProcessor{Policy: c.policyOf, LossGroup: c.lossGroupOf, Logger: c.logger}
+	return c, nil
+}
+
+// policyOf is the domain policy of the position of ticker
+func (c *Calculator) policyOf(ticker string) domain.Policy {
+	policy := c.policy
+	if class, ok := c.classes[ticker]; ok {
+		policy = class.policy
+	}
+	return domain.Policy{ExemptionThreshold: policy.ExemptionThreshold, Rate: policy.Rate, Precision: c.precision}
+}
+
+// lossGroupOf is the asset class of ticker, whose tickers offset each other's profits with their losses.
+// The tickers that are not in an asset class are a group of their own
+func (c *Calculator) lossGroupOf(ticker string) string {
+	return c.classes[ticker].name
+}
+
+// Calculate returns the result of every operation, in order, starting from empty positions.
+// It stops at the first operation rejected, returned as an *OperationError, or when ctx is done,
+// returned as a *CanceledError, with the results of the operations before it
+func (c *Calculator) Calculate(ctx context.Context, operations []Operation) ([]Result, error) {
+	session := c.NewSession()
+	results := make([]Result, 0, len(operations))
+	for _, operation := range operations {
+		result, err := session.Process(ctx, operation)
+		if err != nil && ctx.Err() != nil {
+			return results, &CanceledError{Processed: len(results), Total: len(operations), Err: ctx.Err()}
+		}
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Session calculates operations one at a time, keeping the positions between calls, e.g. for a
+// stream of operations. A session is not safe for concurrent use
+type Session struct {
+	session *application.Session
+}
+
+// NewSession starts a session with empty positions
+func (c *Calculator) NewSession() *Session {
+	return &Session{session: c.processor.NewSession()}
+}
+
+// Process returns the result of the next operation. A rejected operation returns an *OperationError
+// and leaves the positions unchanged, so the session can go on. A cancel or amend recalculates the
+// later operations and returns the changes in their taxes as Adjustments. When ctx is done the
+// operation is not processed and the error of ctx is returned
+func (s *Session) Process(ctx context.Context, operation Operation) (Result, error) {
+	record, err := s.session.Record(ctx, toApplication(operation))
+	if err != nil && ctx.Err() != nil {
+		// the operation was not processed. One that was is returned even when ctx is done by now
+		return Result{}, ctx.Err()
+	}
+	if err != nil {
+		return Result{}, operationError(err)
+	}
+	return fromDomain(record.Tax), nil
+}
+
+// Positions returns the position of every ticker of the session, sorted by ticker
+func (s *Session) Positions() []Position {
+	var positions []Position
+	for ticker, state := range s.session.Account("").Portfolios {
+		positions = append(positions, Position{
+			Ticker:          ticker,
+			Shares:          state.TotalShares,
+			AverageCost:     state.AverageCost,
+			AccumulatedLoss: state.AccumulatedLoss,
+		})
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Ticker < positions[j].Ticker })
+	return positions
+}
@@ -0,0 +1,251 @@
+package capitalgains
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew_InvalidOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		option Option
+	}{
+		{"negative rate", WithPolicy(Policy{Rate: -0.1})},
+		{"rate over 1", WithAssetClass("fii", Policy{Rate: 20}, "HGLG11")},
+		{"negative threshold", WithPolicy(Policy{ExemptionThreshold: -1, Rate: 0.2})},
+		{"negative rounding", WithRounding(-1)},
+		{"unnamed asset class", WithAssetClass("", DefaultPolicy, "HGLG11")},
+		{"nil logger", WithLogger(nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if calculator, err := New(tt.option); err == nil {
+				t.Errorf("Assertion failed: expected an error, got %+v", calculator)
+			}
+		})
+	}
+}
+
+func TestNew_TickerInTwoAssetClasses(t *testing.T) {
+	_, err := New(
+		WithAssetClass("fii", Policy{Rate: 0.2}, "HGLG11"),
+		WithAssetClass("etf", Policy{Rate: 0.15}, "BOVA11", "HGLG11"),
+	)
+
+	if err == nil || err.Error() != "ticker HGLG11 is in asset classes fii and etf" {
+		t.Errorf("Assertion failed: New returned %v", err)
+	}
+}
+
+func TestCalculate_Policy(t *testing.T) {
+	calculator, _ := New(WithPolicy(Policy{ExemptionThreshold: 0, Rate: 0.15}))
+	operations := []Operation{
+		{Type: Buy, UnitCost: 10.00, Quantity: 100},
+		{Type: Sell, UnitCost: 15.00, Quantity: 100}, // profit 500, no exemption
+	}
+
+	results, err := calculator.Calculate(context.Background(), operations)
+
+	if err != nil || results[1].Tax != 75.00 || results[1].Explanation.Rate != 0.15 {
+		t.Errorf("Assertion failed: results = %+v, %v", results, err)
+	}
+}
+
+func TestCalculate_LossesStayInTheirAssetClass(t *testing.T) {
+	calculator, _ := New(WithAssetClass("fii", Policy{Rate: 0.20}, "HGLG11"))
+	operations := []Operation{
+		{Type: Buy, UnitCost: 20.00, Quantity: 10000, Ticker: "VALE3"},
+		{Type: Buy, UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"},
+		{Type: Buy, UnitCost: 100.00, Quantity: 100, Ticker: "HGLG11"},
+		{Type: Sell, UnitCost: 10.00, Quantity: 5000, Ticker: "VALE3"},  // loss 50k
+		{Type: Sell, UnitCost: 20.00, Quantity: 2500, Ticker: "PETR4"},  // profit 25k, offset by the VALE3 loss
+		{Type: Sell, UnitCost: 110.00, Quantity: 100, Ticker: "HGLG11"}, // profit 1k, the stock loss does not apply
+	}
+
+	results, err := calculator.Calculate(context.Background(), operations)
+
+	if err != nil || results[4].Tax != 0.00 || results[5].Tax != 200.00 {
+		t.Errorf("Assertion failed: results = %+v, %v", results, err)
+	}
+}
+
+func TestCalculate_Logger(t *testing.T) {
+	var logs bytes.Buffer
+	calculator, _ := New(WithLogger(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	operations := []Operation{
+		{Type: Buy, Ticker: "PETR4", UnitCost: 10.00, Quantity: 10000},
+		{Type: Sell, Ticker: "PETR4", UnitCost: 20.00, Quantity: 5000},
+	}
+
+	if _, err := calculator.Calculate(context.Background(), operations); err != nil {
+		t.Fatalf("Assertion failed: Calculate returned %v", err)
+	}
+	if !strings.Contains(logs.String(), `msg="tax assessed" ticker=PETR4`) {
+		t.Errorf("Assertion failed: logs = %q", logs.String())
+	}
+}
+
+func TestCalculate_Rounding(t *testing.T) {
+	calculator, _ := New(WithRounding(0))
+	operations := []Operation{
+		{Type: Buy, UnitCost: 10.00, Quantity: 3},
+		{Type: Buy, UnitCost: 11.00, Quantity: 1}, // average cost 10.25, rounded to 10
+	}
+
+	results, err := calculator.Calculate(context.Background(), operations)
+
+	if err != nil || results[1].Explanation.AverageCostAfter != 10 {
+		t.Errorf("Assertion failed: results = %+v, %v", results, err)
+	}
+}
+
+func TestCalculate_RejectedOperation(t *testing.T) {
+	calculator, _ := New()
+	operations := []Operation{
+		{Type: Buy, UnitCost: 10.00, Quantity: 100},
+		{Type: Sell, UnitCost: 10.00, Quantity: 200},
+		{Type: Sell, UnitCost: 10.00, Quantity: 50},
+	}
+
+	results, err := calculator.Calculate(context.Background(), operations)
+
+	var rejected *OperationError
+	if !errors.As(err, &rejected) || rejected.Operation != 2 || !errors.Is(err, ErrInsufficientShares) {
+		t.Errorf("Assertion failed: expected an OperationError for operation 2, got %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Assertion failed: expected the result of the first operation, got %+v", results)
+	}
+}
+
+func TestCalculate_CanceledContext(t *testing.T) {
+	calculator, _ := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := calculator.Calculate(ctx, []Operation{{Type: Buy, UnitCost: 10.00, Quantity: 100}})
+
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) || canceled.Processed != 0 || canceled.Total != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Assertion failed: expected a CanceledError, got %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Assertion failed: results = %+v", results)
+	}
+}
+
+// doneAfter is a context that is done once its error was checked checks times
+type doneAfter struct {
+	context.Context
+	checks int
+}
+
+func (c *doneAfter) Err() error {
+	if c.checks == 0 {
+		return context.Canceled
+	}
+	c.checks--
+	return nil
+}
+
+func TestSession_ProcessedBeforeCancel(t *testing.T) {
+	calculator, _ := New()
+	session := calculator.NewSession()
+	ctx := &doneAfter{Context: context.Background(), checks: 1} // done once the buy was processed
+
+	result, err := session.Process(ctx, Operation{Type: Buy, UnitCost: 10.00, Quantity: 100})
+
+	if err != nil || result.Tax != 0 {
+		t.Errorf("Assertion failed: expected the result of the processed buy, got %+v (%v)", result, err)
+	}
+	if positions := session.Positions(); len(positions) != 1 || positions[0].Shares != 100 {
+		t.Errorf("Assertion failed: positions = %+v", positions)
+	}
+}
+
+func TestCalculate_CanceledAfterOperation(t *testing.T) {
+	calculator, _ := New()
+	ctx := &doneAfter{Context: context.Background(), checks: 1}
+
+	results, err := calculator.Calculate(ctx, []Operation{
+		{Type: Buy, UnitCost: 10.00, Quantity: 100},
+		{Type: Sell, UnitCost: 20.00, Quantity: 50},
+	})
+
+	var canceled *CanceledError
+	if !errors.As(err, &canceled) || canceled.Processed != 1 || len(results) != 1 {
+		t.Errorf("Assertion failed: expected the buy processed before the cancel, got %+v (%v)", results, err)
+	}
+}
+
+func TestSession_UnknownReference(t *testing.T) {
+	calculator, _ := New()
+	session := calculator.NewSession()
+	session.Process(context.Background(), Operation{Type: Buy, UnitCost: 10.00, Quantity: 100})
+
+	_, err := session.Process(context.Background(), Operation{Type: Cancel, Ref: "missing"})
+
+	var rejected *OperationError
+	if !errors.Is(err, ErrUnknownReference) || !errors.As(err, &rejected) || rejected.Operation != 2 {
+		t.Errorf("Assertion failed: expected ErrUnknownReference at operation 2, got %v", err)
+	}
+	if positions := session.Positions(); len(positions) != 1 || positions[0].Shares != 100 {
+		t.Errorf("Assertion failed: positions = %+v", positions)
+	}
+}
+
+func TestSession_CorrectionKeepsAssetClassPolicy(t *testing.T) {
+	calculator, _ := New(WithAssetClass("fii", Policy{Rate: 0.20}, "HGLG11"))
+	session := calculator.NewSession()
+	ctx := context.Background()
+	session.Process(ctx, Operation{ID: "b1", Type: Buy, UnitCost: 100.00, Quantity: 100, Ticker: "HGLG11"})
+	session.Process(ctx, Operation{ID: "s1", Type: Sell, UnitCost: 110.00, Quantity: 100, Ticker: "HGLG11"})
+
+	result, err := session.Process(ctx, Operation{Type: Amend, Ref: "b1", UnitCost: 105.00, Quantity: 100})
+
+	// the replayed sale is still taxed without exemption
+	if err != nil || len(result.Adjustments) != 1 || result.Adjustments[0].After != 100.00 {
+		t.Errorf("Assertion failed: result = %+v, %v", result, err)
+	}
+}
+
+func TestSession_NumbersOperationsLikeAdjustments(t *testing.T) {
+	calculator, _ := New()
+	session := calculator.NewSession()
+	ctx := context.Background()
+	session.Process(ctx, Operation{ID: "b1", Type: Buy, UnitCost: 10.00, Quantity: 10000})
+
+	// neither the rejected sale nor the re-submitted buy take a number
+	_, err := session.Process(ctx, Operation{Type: Sell, UnitCost: 20.00, Quantity: 20000})
+	var rejected *OperationError
+	if !errors.As(err, &rejected) || rejected.Operation != 2 {
+		t.Fatalf("Assertion failed: expected operation 2 to be rejected, got %v", err)
+	}
+	session.Process(ctx, Operation{ID: "b1", Type: Buy, UnitCost: 10.00, Quantity: 10000})
+	session.Process(ctx, Operation{ID: "s1", Type: Sell, UnitCost: 20.00, Quantity: 5000})
+
+	result, err := session.Process(ctx, Operation{Type: Amend, Ref: "b1", UnitCost: 12.00, Quantity: 10000})
+
+	if err != nil || len(result.Adjustments) != 1 || result.Adjustments[0].Operation != 2 || result.Adjustments[0].ID != "s1" {
+		t.Errorf("Assertion failed: result = %+v, %v", result, err)
+	}
+}
+
+func TestSession_AdjustmentRounding(t *testing.T) {
+	calculator, _ := New(WithRounding(4), WithPolicy(Policy{ExemptionThreshold: 0, Rate: 0.20}))
+	session := calculator.NewSession()
+	ctx := context.Background()
+	session.Process(ctx, Operation{ID: "b1", Type: Buy, UnitCost: 10.00, Quantity: 1})
+	session.Process(ctx, Operation{ID: "s1", Type: Sell, UnitCost: 10.0123, Quantity: 1}) // profit 0.0123, tax 0.0025
+
+	result, err := session.Process(ctx, Operation{Type: Amend, Ref: "b1", UnitCost: 10.01, Quantity: 1}) // profit 0.0023, tax 0.0005
+
+	if err != nil || len(result.Adjustments) != 1 || result.Adjustments[0].Difference != -0.002 {
+		t.Errorf("Assertion failed: expected a difference of -0.002, got %+v, %v", result, err)
+	}
+}
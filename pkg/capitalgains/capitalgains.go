@@ -0,0 +1,140 @@
+// Package capitalgains calculates the capital gains tax of stock operations, to embed the calculator
+// in other services instead of running the binary
+package capitalgains
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/application"
+	"github.com/andreposman/capital-gains/internal/domain"
+)
+
+// operation types
+const (
+	Buy    = "buy"
+	Sell   = "sell"
+	Cancel = "cancel" // undoes the buy or sell whose ID is Ref
+	Amend  = "amend"  // replaces the unit cost, quantity and fees of the buy or sell whose ID is Ref
+)
+
+// Operation is a buy or sell of shares, or a correction of an earlier one
+type Operation struct {
+	ID       string // optional; an operation with the ID of an earlier one is not calculated again
+	Type     string
+	UnitCost float64
+	Quantity int
+	Ticker   string // optional; each ticker has its own position, operations without one share a position
+	Date     string // optional, YYYY-MM-DD
+	Fees     float64
+	Ref      string // ID of the operation a cancel or amend corrects
+}
+
+// Result is the tax of an operation and how it was reached
+type Result struct {
+	Tax         float64
+	Explanation Explanation
+	Adjustments []Adjustment // the taxes of earlier operations a cancel or amend changed
+}
+
+// Explanation is the audit trail of how the tax of an operation was reached
+type Explanation struct {
+	AverageCostBefore float64
+	AverageCostAfter  float64
+	SaleValue         float64
+	GrossProfit       float64 // negative for a loss
+	LossUsed          float64
+	LossAdded         float64
+	TaxableBase       float64
+	Rate              float64
+	Reason            string // e.g. TAXED_PROFIT or EXEMPT_UNDER_THRESHOLD
+}
+
+// Adjustment is the change in the tax of an earlier operation recomputed after a cancel or amend
+type Adjustment struct {
+	// Operation is the number of the operation whose tax changed. Operations are numbered from 1 in the
+	// order they are calculated; rejected operations and IDs re-submitted don't take a number
+	Operation  int
+	ID         string
+	Before     float64
+	After      float64
+	Difference float64 // after - before, negative when tax was overpaid
+}
+
+// Position is the state of the shares of a ticker
+type Position struct {
+	Ticker          string
+	Shares          int
+	AverageCost     float64
+	AccumulatedLoss float64 // deducted from future profits of every ticker of its asset class
+}
+
+var (
+	// ErrInsufficientShares is a sale of more shares than the position has
+	ErrInsufficientShares = domain.ErrInsufficientShares
+	// ErrUnknownReference is a cancel or amend whose Ref is not the ID of a buy or sell
+	ErrUnknownReference = application.ErrUnknownReference
+)
+
+// OperationError is an operation the calculator rejected; errors.Is matches its cause,
+// e.g. ErrInsufficientShares
+type OperationError struct {
+	Operation int // the number the operation would have taken, see Adjustment.Operation
+	Err       error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Operation, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError is a Calculate stopped by its context between two operations; errors.Is matches
+// context.Canceled or context.DeadlineExceeded
+type CanceledError struct {
+	Processed int // number of operations calculated, whose results are returned
+	Total     int
+	Err       error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("calculation canceled after %d of %d operations: %v", e.Processed, e.Total, e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// operationError turns a rejection of the application into an *OperationError, keeping its number
+func operationError(err error) error {
+	var rejected *application.OperationError
+	if errors.As(err, &rejected) {
+		return &OperationError{Operation: rejected.Operation, Err: rejected.Err}
+	}
+	return err
+}
+
+func toApplication(o Operation) application.Operation {
+	return application.Operation{
+		ID:       o.ID,
+		Type:     o.Type,
+		UnitCost: o.UnitCost,
+		Quantity: o.Quantity,
+		Ticker:   o.Ticker,
+		Date:     o.Date,
+		Fees:     o.Fees,
+		Ref:      o.Ref,
+	}
+}
+
+func fromDomain(tax domain.Tax) Result {
+	result := Result{Tax: tax.Tax}
+	if tax.Explanation != nil {
+		result.Explanation = Explanation(*tax.Explanation)
+	}
+	for _, adjustment := range tax.Adjustments {
+		result.Adjustments = append(result.Adjustments, Adjustment(adjustment))
+	}
+	return result
+}
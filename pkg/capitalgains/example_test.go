@@ -0,0 +1,72 @@
+package capitalgains_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/andreposman/capital-gains/pkg/capitalgains"
+)
+
+func ExampleCalculator_Calculate() {
+	calculator, err := capitalgains.New()
+	if err != nil {
+		panic(err)
+	}
+
+	results, err := calculator.Calculate(context.Background(), []capitalgains.Operation{
+		{Type: capitalgains.Buy, UnitCost: 10.00, Quantity: 10000},
+		{Type: capitalgains.Sell, UnitCost: 20.00, Quantity: 5000},
+		{Type: capitalgains.Sell, UnitCost: 5.00, Quantity: 5000},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	for _, result := range results {
+		fmt.Println(result.Tax, result.Explanation.Reason)
+	}
+	// Output:
+	// 0 BUY_NO_TAX
+	// 10000 TAXED_PROFIT
+	// 0 SALE_AT_LOSS
+}
+
+func ExampleWithAssetClass() {
+	// real estate funds have no exemption
+	calculator, err := capitalgains.New(
+		capitalgains.WithAssetClass("fii", capitalgains.Policy{Rate: 0.20}, "HGLG11", "KNRI11"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	results, _ := calculator.Calculate(context.Background(), []capitalgains.Operation{
+		{Type: capitalgains.Buy, UnitCost: 100.00, Quantity: 100, Ticker: "HGLG11"},
+		{Type: capitalgains.Sell, UnitCost: 110.00, Quantity: 100, Ticker: "HGLG11"},
+		{Type: capitalgains.Buy, UnitCost: 10.00, Quantity: 100, Ticker: "PETR4"},
+		{Type: capitalgains.Sell, UnitCost: 20.00, Quantity: 100, Ticker: "PETR4"},
+	})
+
+	fmt.Println(results[1].Tax, results[3].Tax)
+	// Output: 200 0
+}
+
+func ExampleSession() {
+	calculator, _ := capitalgains.New()
+	session := calculator.NewSession()
+	ctx := context.Background()
+
+	session.Process(ctx, capitalgains.Operation{ID: "b1", Type: capitalgains.Buy, UnitCost: 10.00, Quantity: 10000, Ticker: "PETR4"})
+	session.Process(ctx, capitalgains.Operation{ID: "s1", Type: capitalgains.Sell, UnitCost: 20.00, Quantity: 5000, Ticker: "PETR4"})
+
+	// the buy was at 15.00, not 10.00
+	result, err := session.Process(ctx, capitalgains.Operation{Type: capitalgains.Amend, Ref: "b1", UnitCost: 15.00, Quantity: 10000})
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("%+v\n", result.Adjustments)
+	fmt.Printf("%+v\n", session.Positions())
+	// Output:
+	// [{Operation:2 ID:s1 Before:10000 After:5000 Difference:-5000}]
+	// [{Ticker:PETR4 Shares:5000 AverageCost:15 AccumulatedLoss:0}]
+}
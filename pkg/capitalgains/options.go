@@ -0,0 +1,92 @@
+package capitalgains
+
+import (
+	"errors"
+	"fmt"
+	"github.com/andreposman/capital-gains/internal/domain"
+	"log/slog"
+)
+
+// Policy is the tax rules applied to the sales of a position
+type Policy struct {
+	ExemptionThreshold float64 // sales whose value is not over it are not taxed, 0 for no exemption
+	Rate               float64 // applied to the profit left after the accumulated losses
+}
+
+// DefaultPolicy is the rule for stocks: sales up to R$ 20.000,00 are exempt and profits pay 20%
+var DefaultPolicy = Policy{ExemptionThreshold: domain.DefaultPolicy.ExemptionThreshold, Rate: domain.DefaultPolicy.Rate}
+
+// DefaultPrecision is the number of decimal places values are rounded to, cents
+const DefaultPrecision = 2
+
+// Option configures a Calculator
+type Option func(*Calculator) error
+
+// WithPolicy sets the policy of the tickers that are not in an asset class, DefaultPolicy by default
+func WithPolicy(policy Policy) Option {
+	return func(c *Calculator) error {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+		c.policy = policy
+		return nil
+	}
+}
+
+// WithRounding rounds average costs, sale values and taxes to places decimal places, DefaultPrecision by default
+func WithRounding(places int) Option {
+	return func(c *Calculator) error {
+		if places < 0 {
+			return fmt.Errorf("rounding must be >= 0 decimal places, got %d", places)
+		}
+		c.precision = places
+		return nil
+	}
+}
+
+// WithAssetClass applies policy to the sales of tickers instead of the default policy, e.g. for
+// real estate funds, which have no exemption. The losses of an asset class only offset the profits of
+// its own tickers. A ticker can only be in one asset class
+func WithAssetClass(name string, policy Policy, tickers ...string) Option {
+	return func(c *Calculator) error {
+		if name == "" {
+			return errors.New("asset class name must not be empty")
+		}
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("asset class %s: %w", name, err)
+		}
+		for _, ticker := range tickers {
+			if class, ok := c.classes[ticker]; ok && class.name != name {
+				return fmt.Errorf("ticker %s is in asset classes %s and %s", ticker, class.name, name)
+			}
+			c.classes[ticker] = assetClass{name: name, policy: policy}
+		}
+		return nil
+	}
+}
+
+// WithLogger traces every operation and calculation step to logger at debug level, slog.Default by default
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Calculator) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+		c.logger = logger
+		return nil
+	}
+}
+
+type assetClass struct {
+	name   string
+	policy Policy
+}
+
+func (p Policy) validate() error {
+	if p.ExemptionThreshold < 0 {
+		return fmt.Errorf("exemption threshold must be >= 0, got %v", p.ExemptionThreshold)
+	}
+	if p.Rate < 0 || p.Rate > 1 {
+		return fmt.Errorf("rate must be between 0 and 1, got %v", p.Rate)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"fmt"
 	"math"
+	"os"
 	"runtime"
 )
 
@@ -49,5 +50,6 @@ func Greeting() {
 
 	msg := fmt.Sprintf(asciiArt, infoMsg)
 
-	fmt.Println(msg)
+	// stderr, so stdout only carries the results
+	fmt.Fprintln(os.Stderr, msg)
 }